@@ -0,0 +1,65 @@
+// Mockacs is a minimal ACS that drives simulated devices in end-to-end tests.
+// It sends scripted RPCs to every device that connects and exposes an API to
+// queue more requests, inspect recorded sessions and send connection
+// requests.
+//
+//nolint:gochecknoglobals
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/mockacs"
+)
+
+var (
+	addr       = flag.String("addr", ":7547", "Listen address. CWMP endpoint is served at / and the API at /api/")
+	scriptPath = flag.String("script", "", "Path to a JSON file with requests sent to every new device")
+	crUsername = flag.String("cr-username", "", "Connection request username")
+	crPassword = flag.String("cr-password", "", "Connection request password")
+)
+
+func main() {
+	flag.Parse()
+
+	opts := []mockacs.Option{mockacs.WithConnectionRequestAuth(*crUsername, *crPassword)}
+	if *scriptPath != "" {
+		script, err := mockacs.LoadScript(*scriptPath)
+		if err != nil {
+			log.Fatal("Failed to load script", log.Cause(err))
+		}
+		opts = append(opts, mockacs.WithScript(script...))
+	}
+	acs := mockacs.New(opts...)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", acs.APIHandler()))
+	mux.Handle("/", acs)
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Started mock ACS", log.F{"addr": *addr})
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("Server error", log.Cause(err))
+	}
+}
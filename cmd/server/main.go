@@ -9,26 +9,43 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/localhots/blip"
 	"github.com/localhots/blip/noctx/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/recording"
+	"github.com/localhots/SimulaTR69/scenario"
+	"github.com/localhots/SimulaTR69/script"
 	"github.com/localhots/SimulaTR69/simulator"
+	"github.com/localhots/SimulaTR69/simulator/metrics"
 )
 
 func main() {
 	ctx := context.Background()
 	log.Info("Loading configuration")
-	if err := simulator.LoadConfig(ctx); err != nil {
+	cfg, err := simulator.LoadConfig(ctx)
+	if err != nil {
 		log.Fatal("Failed to load config", log.Cause(err))
 	}
-	cfg := simulator.Config
 
 	logcfg := blip.DefaultConfig()
 	logcfg.Level = blipLevel(cfg.LogLevel)
 	log.Setup(logcfg)
 
+	if cfg.ReplayPath != "" {
+		runReplay(ctx, cfg)
+		return
+	}
+
 	log.Info("Loading datamodel", log.F{"path": cfg.DataModelPath})
 	defaults, err := datamodel.LoadDataModelFile(cfg.DataModelPath)
 	if err != nil {
@@ -38,6 +55,52 @@ func main() {
 		datamodel.NormalizeParameters(defaults)
 	}
 
+	var sc *scenario.Scenario
+	if cfg.ScenarioPath != "" {
+		log.Info("Loading scenario", log.F{"path": cfg.ScenarioPath})
+		sc, err = scenario.Load(cfg.ScenarioPath)
+		if err != nil {
+			log.Fatal("Failed to load scenario", log.Cause(err))
+		}
+	}
+
+	opts := startMetrics(cfg)
+	if cfg.FaultRulesPath != "" {
+		log.Info("Loading fault rules", log.F{"path": cfg.FaultRulesPath})
+		rules, err := simulator.LoadFaultRules(cfg.FaultRulesPath)
+		if err != nil {
+			log.Fatal("Failed to load fault rules", log.Cause(err))
+		}
+		opts = append(opts, simulator.WithFaultRules(rules...))
+	}
+	if cfg.ScriptPath != "" {
+		log.Info("Loading script", log.F{"path": cfg.ScriptPath})
+		scr, err := script.Load(cfg.ScriptPath)
+		if err != nil {
+			log.Fatal("Failed to load script", log.Cause(err))
+		}
+		opts = append(opts, simulator.WithHooks(scr.Hooks()))
+	}
+	tracingOpts, stopTracing := startTracing(ctx, cfg)
+	opts = append(opts, tracingOpts...)
+	if cfg.RecordPath != "" {
+		log.Info("Recording sessions", log.F{"path": cfg.RecordPath})
+		rec, err := recording.Create(cfg.RecordPath)
+		if err != nil {
+			log.Fatal("Failed to create recording", log.Cause(err))
+		}
+		defer rec.Close()
+		opts = append(opts, simulator.WithRecorder(rec))
+	}
+	if cfg.FleetSize > 0 {
+		runFleet(ctx, cfg, defaults, sc, opts)
+	} else {
+		runDevice(ctx, cfg, defaults, sc, opts)
+	}
+	stopTracing(ctx)
+}
+
+func runDevice(ctx context.Context, cfg simulator.Config, defaults map[string]datamodel.Parameter, sc *scenario.Scenario, opts []simulator.Option) {
 	log.Info("Loading state", log.F{"file": cfg.StateFilePath})
 	state, err := datamodel.LoadState(cfg.StateFilePath)
 	if err != nil {
@@ -57,21 +120,201 @@ func main() {
 		"serial_number": id.SerialNumber,
 	})
 
-	srv := simulator.New(dm)
+	srv := simulator.New(dm, append(opts, simulator.WithConfig(cfg))...)
+	started := make(chan struct{})
 	go func() {
 		if err := srv.Start(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal("Failed to start server", log.Cause(err))
 		}
+		close(started)
 	}()
+	admin := startAdmin(ctx, cfg, srv)
 
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	<-ch
-
+	var scErr error
+	if sc != nil {
+		scErr = runScenario(ctx, sc, started, srv)
+	} else {
+		waitForSignal()
+	}
 	log.Info("Stopping server...")
+	if err := admin.Stop(ctx); err != nil {
+		log.Error("Failed to stop admin server", log.Cause(err))
+	}
 	if err := srv.Stop(ctx); err != nil {
 		log.Fatal("Failed to stop server", log.Cause(err))
 	}
+	if scErr != nil {
+		log.Fatal("Scenario failed", log.Cause(scErr))
+	}
+}
+
+func runFleet(ctx context.Context, cfg simulator.Config, defaults map[string]datamodel.Parameter, sc *scenario.Scenario, opts []simulator.Option) {
+	fleet, err := simulator.NewFleet(cfg, datamodel.NewDefaults(defaults), opts...)
+	if err != nil {
+		log.Fatal("Failed to create fleet", log.Cause(err))
+	}
+
+	log.Info("Simulating fleet", log.F{"size": len(fleet.Simulators())})
+	started := make(chan struct{})
+	go func() {
+		if err := fleet.Start(ctx); err != nil {
+			log.Fatal("Failed to start fleet", log.Cause(err))
+		}
+		close(started)
+	}()
+	admin := startAdmin(ctx, cfg, fleet.Simulators()...)
+
+	var scErr error
+	if sc != nil {
+		devices := make([]scenario.Device, 0, len(fleet.Simulators()))
+		for _, s := range fleet.Simulators() {
+			devices = append(devices, s)
+		}
+		scErr = runScenario(ctx, sc, started, devices...)
+	} else {
+		waitForSignal()
+	}
+	log.Info("Stopping fleet...")
+	if err := admin.Stop(ctx); err != nil {
+		log.Error("Failed to stop admin server", log.Cause(err))
+	}
+	if err := fleet.Stop(ctx); err != nil {
+		log.Fatal("Failed to stop fleet", log.Cause(err))
+	}
+	if scErr != nil {
+		log.Fatal("Scenario failed", log.Cause(scErr))
+	}
+}
+
+// runReplay replays recorded sessions against the ACS and exits with a
+// non-zero status if the ACS behavior has diverged from the recording.
+func runReplay(ctx context.Context, cfg simulator.Config) {
+	log.Info("Loading recording", log.F{"path": cfg.ReplayPath})
+	sessions, err := recording.Load(cfg.ReplayPath)
+	if err != nil {
+		log.Fatal("Failed to load recording", log.Cause(err))
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	divergences, err := simulator.Replay(ctx, cfg, sessions)
+	if err != nil {
+		log.Fatal("Replay failed", log.Cause(err))
+	}
+	if len(divergences) > 0 {
+		for _, d := range divergences {
+			log.Error("Divergence", log.F{"divergence": d.String()})
+		}
+		log.Fatal("Replay diverged from recording", log.F{
+			"sessions": len(sessions),
+			"diverged": len(divergences),
+		})
+	}
+	log.Info("Replay completed", log.F{"sessions": len(sessions)})
+}
+
+// startMetrics starts the metrics server if it is enabled and returns options
+// that make simulators report their metrics to it.
+func startMetrics(cfg simulator.Config) []simulator.Option {
+	if cfg.MetricsAddr == "" {
+		return nil
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:              cfg.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start metrics server", log.Cause(err))
+		}
+	}()
+	log.Info("Started metrics server", log.F{
+		"addr":   cfg.MetricsAddr,
+		"labels": cfg.MetricsLabels,
+	})
+
+	factory := metrics.NewFactory(reg, cfg.MetricsLabels)
+	return []simulator.Option{simulator.WithMetricsFactory(factory)}
+}
+
+// startTracing sets up exporting of session traces to an OTLP collector if it
+// is enabled. It returns options that make simulators use the tracer provider
+// and a function that flushes remaining spans.
+func startTracing(ctx context.Context, cfg simulator.Config) ([]simulator.Option, func(context.Context)) {
+	if cfg.TracingEndpoint == "" {
+		return nil, func(context.Context) {}
+	}
+
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.TracingEndpoint))
+	if err != nil {
+		log.Fatal("Failed to create trace exporter", log.Cause(err))
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("simulatr69"),
+		)),
+	)
+	log.Info("Exporting traces", log.F{
+		"endpoint":     cfg.TracingEndpoint,
+		"sample_ratio": cfg.TracingSampleRatio,
+	})
+
+	return []simulator.Option{simulator.WithTracerProvider(tp)}, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Error("Failed to flush traces", log.Cause(err))
+		}
+	}
+}
+
+// startAdmin starts the admin server if it is enabled.
+func startAdmin(ctx context.Context, cfg simulator.Config, sims ...*simulator.Simulator) *simulator.AdminServer {
+	admin := simulator.NewAdminServer(sims...)
+	if cfg.AdminAddr == "" {
+		return admin
+	}
+	if err := admin.Start(ctx, cfg.AdminAddr); err != nil {
+		log.Fatal("Failed to start admin server", log.Cause(err))
+	}
+	return admin
+}
+
+// runScenario runs the scenario once the started channel is closed, a nil
+// channel means the devices are already started. The scenario is interrupted
+// if a signal is received.
+func runScenario(ctx context.Context, sc *scenario.Scenario, started <-chan struct{}, devices ...scenario.Device) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if started != nil {
+		select {
+		case <-started:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := sc.Run(ctx, devices); err != nil {
+		return err
+	}
+	log.Info("Scenario completed", log.F{"name": sc.Name})
+	return nil
+}
+
+func waitForSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	<-ch
 }
 
 func blipLevel(level string) blip.Level {
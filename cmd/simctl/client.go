@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+// client is an admin API client.
+type client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newClient(addr string, timeout time.Duration) *client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &client{
+		baseURL:    strings.TrimSuffix(addr, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// devices returns all devices which serial numbers match the given pattern,
+// as defined by path.Match.
+func (c *client) devices(ctx context.Context, pattern string) ([]simulator.DeviceSummary, error) {
+	var all []simulator.DeviceSummary
+	if err := c.do(ctx, http.MethodGet, "/devices", nil, &all); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid device selector: %w", err)
+	}
+	var matched []simulator.DeviceSummary
+	for _, d := range all {
+		if ok, _ := path.Match(pattern, d.SerialNumber); ok {
+			matched = append(matched, d)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no devices match %q", pattern)
+	}
+	return matched, nil
+}
+
+func (c *client) parameters(ctx context.Context, serial, prefix string) ([]simulator.ParameterInfo, error) {
+	var params []simulator.ParameterInfo
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "parameters?prefix="+url.QueryEscape(prefix)), nil, &params)
+	return params, err
+}
+
+func (c *client) parameter(ctx context.Context, serial, name string) (simulator.ParameterInfo, error) {
+	var p simulator.ParameterInfo
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "parameters", url.PathEscape(name)), nil, &p)
+	return p, err
+}
+
+func (c *client) setParameter(ctx context.Context, serial, name, value string) (simulator.ParameterInfo, error) {
+	var p simulator.ParameterInfo
+	body := map[string]string{"value": value}
+	err := c.do(ctx, http.MethodPut, devicePath(serial, "parameters", url.PathEscape(name)), body, &p)
+	return p, err
+}
+
+func (c *client) inform(ctx context.Context, serial string, events []string) error {
+	body := map[string][]string{"events": events}
+	return c.do(ctx, http.MethodPost, devicePath(serial, "inform"), body, nil)
+}
+
+func (c *client) reboot(ctx context.Context, serial string) error {
+	return c.do(ctx, http.MethodPost, devicePath(serial, "reboot"), nil, nil)
+}
+
+func (c *client) factoryReset(ctx context.Context, serial string) error {
+	return c.do(ctx, http.MethodPost, devicePath(serial, "factory-reset"), nil, nil)
+}
+
+func (c *client) offline(ctx context.Context, serial string, dur time.Duration) error {
+	body := map[string]string{"duration": dur.String()}
+	return c.do(ctx, http.MethodPost, devicePath(serial, "offline"), body, nil)
+}
+
+func (c *client) pending(ctx context.Context, serial string) (simulator.PendingInfo, error) {
+	var p simulator.PendingInfo
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "pending"), nil, &p)
+	return p, err
+}
+
+func (c *client) sessions(ctx context.Context, serial string) ([]simulator.SessionInfo, error) {
+	var sessions []simulator.SessionInfo
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "sessions"), nil, &sessions)
+	return sessions, err
+}
+
+func (c *client) state(ctx context.Context, serial string) (json.RawMessage, error) {
+	var state json.RawMessage
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "state"), nil, &state)
+	return state, err
+}
+
+func (c *client) faults(ctx context.Context, serial string) ([]simulator.FaultRuleStatus, error) {
+	var rules []simulator.FaultRuleStatus
+	err := c.do(ctx, http.MethodGet, devicePath(serial, "faults"), nil, &rules)
+	return rules, err
+}
+
+func (c *client) setFaultEnabled(ctx context.Context, serial, name string, enabled bool) ([]simulator.FaultRuleStatus, error) {
+	var rules []simulator.FaultRuleStatus
+	body := map[string]bool{"enabled": enabled}
+	err := c.do(ctx, http.MethodPut, devicePath(serial, "faults", url.PathEscape(name)), body, &rules)
+	return rules, err
+}
+
+// do makes a request to the admin API. Request body is encoded and response
+// body is decoded as JSON if provided.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return errors.New(resp.Status)
+		}
+		return errors.New(apiErr.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func devicePath(serial string, elems ...string) string {
+	p := "/devices/" + url.PathEscape(serial)
+	for _, e := range elems {
+		p += "/" + e
+	}
+	return p
+}
@@ -0,0 +1,429 @@
+// Simctl is a command line client for the simulator admin API. It allows to
+// inspect and drive simulated devices from shell scripts.
+//
+//nolint:gochecknoglobals
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+var (
+	addr     = flag.String("addr", envOr("SIMCTL_ADDR", "localhost:7548"), "Admin API address, can also be set with SIMCTL_ADDR")
+	selector = flag.String("d", "", "Device serial number or a pattern, e.g. SIM-00*. All devices are selected by default, commands that change devices require it")
+	jsonOut  = flag.Bool("json", false, "Print results in JSON format")
+	timeout  = flag.Duration("timeout", 30*time.Second, "Timeout of a single request to the admin API")
+)
+
+// commandFn runs a command against a single device.
+type commandFn func(ctx context.Context, c *client, serial string, args []string) (result, error)
+
+// result is a command result, printed either in JSON or in a human readable
+// format.
+type result interface {
+	print(w io.Writer)
+}
+
+type command struct {
+	usage   string
+	help    string
+	minArgs int
+	maxArgs int // -1 means unlimited
+	// mutating commands change devices, they are only run against devices
+	// selected explicitly
+	mutating bool
+	run      commandFn
+}
+
+var commands = map[string]command{
+	"get": {
+		usage:   "get <path>",
+		help:    "Print parameter values. Paths ending with a dot match all subparameters",
+		minArgs: 1, maxArgs: 1,
+		run: runGet,
+	},
+	"set": {
+		usage:   "set <path> <value>",
+		help:    "Set parameter value",
+		minArgs: 2, maxArgs: 2,
+		mutating: true,
+		run:      runSet,
+	},
+	"inform": {
+		usage:   "inform [event...]",
+		help:    `Start a session with the given events, e.g. "4 VALUE CHANGE"`,
+		minArgs: 0, maxArgs: -1,
+		mutating: true,
+		run:      runInform,
+	},
+	"reboot": {
+		usage:    "reboot",
+		help:     "Reboot the device",
+		mutating: true,
+		run:      runReboot,
+	},
+	"factory-reset": {
+		usage:    "factory-reset",
+		help:     "Reset the device to factory defaults",
+		mutating: true,
+		run:      runFactoryReset,
+	},
+	"offline": {
+		usage:   "offline <duration>",
+		help:    "Take the device offline for the given time, e.g. 2m",
+		minArgs: 1, maxArgs: 1,
+		mutating: true,
+		run:      runOffline,
+	},
+	"pending": {
+		usage: "pending",
+		help:  "Print pending tasks and events",
+		run:   runPending,
+	},
+	"sessions": {
+		usage: "sessions",
+		help:  "Print recent sessions with the ACS",
+		run:   runSessions,
+	},
+	"faults": {
+		usage: "faults",
+		help:  "Print fault injection rules",
+		run:   runFaults,
+	},
+	"enable-fault": {
+		usage:   "enable-fault <name>",
+		help:    "Enable a fault injection rule",
+		minArgs: 1, maxArgs: 1,
+		mutating: true,
+		run:      runToggleFault(true),
+	},
+	"disable-fault": {
+		usage:   "disable-fault <name>",
+		help:    "Disable a fault injection rule",
+		minArgs: 1, maxArgs: 1,
+		mutating: true,
+		run:      runToggleFault(false),
+	},
+	"dump": {
+		usage: "dump",
+		help:  "Print the device state",
+		run:   runDump,
+	},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	// Commands can run against many devices one after another, the timeout
+	// is applied to every request by the client
+	ctx := context.Background()
+	if err := run(ctx, newClient(*addr, *timeout), flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "simctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, c *client, name string, args []string) error {
+	pattern := *selector
+	if name == "devices" {
+		devices, err := c.devices(ctx, orAll(pattern))
+		if err != nil {
+			return err
+		}
+		if *jsonOut {
+			return printJSON(os.Stdout, devices)
+		}
+		devicesResult(devices).print(os.Stdout)
+		return nil
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		return fmt.Errorf("usage: simctl %s", cmd.usage)
+	}
+	if cmd.mutating && pattern == "" {
+		return fmt.Errorf("%s changes devices, select them with -d, e.g. -d '*' for all", name)
+	}
+	devices, err := c.devices(ctx, orAll(pattern))
+	if err != nil {
+		return err
+	}
+
+	serials := make([]string, len(devices))
+	results := make([]result, len(devices))
+	errs := make([]error, len(devices))
+	for i, d := range devices {
+		serials[i] = d.SerialNumber
+		results[i], errs[i] = cmd.run(ctx, c, d.SerialNumber, args)
+	}
+	return printResults(os.Stdout, serials, results, errs)
+}
+
+// printResults prints command results for all devices. Results of multiple
+// devices are printed under a header with the device serial number. It returns
+// an error if the command has failed for any device.
+func printResults(w io.Writer, serials []string, results []result, errs []error) error {
+	if *jsonOut {
+		out := make(map[string]any, len(serials))
+		for i, serial := range serials {
+			if errs[i] != nil {
+				out[serial] = map[string]string{"error": errs[i].Error()}
+			} else {
+				out[serial] = results[i]
+			}
+		}
+		if err := printJSON(w, out); err != nil {
+			return err
+		}
+	} else {
+		for i, serial := range serials {
+			if len(serials) == 1 {
+				// The error is returned to the caller
+				if errs[i] == nil {
+					results[i].print(w)
+				}
+				break
+			}
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "==> %s <==\n", serial)
+			if errs[i] != nil {
+				fmt.Fprintln(w, "error:", errs[i])
+			} else {
+				results[i].print(w)
+			}
+		}
+	}
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, serials[i])
+		}
+	}
+	if len(failed) > 0 {
+		if len(serials) == 1 {
+			return errs[0]
+		}
+		return fmt.Errorf("command failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+//
+// Commands
+//
+
+func runGet(ctx context.Context, c *client, serial string, args []string) (result, error) {
+	if strings.HasSuffix(args[0], ".") {
+		params, err := c.parameters(ctx, serial, args[0])
+		return paramsResult(params), err
+	}
+	p, err := c.parameter(ctx, serial, args[0])
+	return paramsResult{p}, err
+}
+
+func runSet(ctx context.Context, c *client, serial string, args []string) (result, error) {
+	p, err := c.setParameter(ctx, serial, args[0], args[1])
+	return paramsResult{p}, err
+}
+
+func runInform(ctx context.Context, c *client, serial string, args []string) (result, error) {
+	return statusResult{Status: "inform scheduled"}, c.inform(ctx, serial, args)
+}
+
+func runReboot(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	return statusResult{Status: "reboot scheduled"}, c.reboot(ctx, serial)
+}
+
+func runFactoryReset(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	return statusResult{Status: "factory reset scheduled"}, c.factoryReset(ctx, serial)
+}
+
+func runOffline(ctx context.Context, c *client, serial string, args []string) (result, error) {
+	dur, err := time.ParseDuration(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration: %w", err)
+	}
+	return statusResult{Status: "going offline for " + dur.String()}, c.offline(ctx, serial, dur)
+}
+
+func runPending(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	p, err := c.pending(ctx, serial)
+	return pendingResult(p), err
+}
+
+func runSessions(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	sessions, err := c.sessions(ctx, serial)
+	return sessionsResult(sessions), err
+}
+
+func runFaults(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	rules, err := c.faults(ctx, serial)
+	return faultsResult(rules), err
+}
+
+func runToggleFault(enabled bool) commandFn {
+	return func(ctx context.Context, c *client, serial string, args []string) (result, error) {
+		rules, err := c.setFaultEnabled(ctx, serial, args[0], enabled)
+		return faultsResult(rules), err
+	}
+}
+
+func runDump(ctx context.Context, c *client, serial string, _ []string) (result, error) {
+	state, err := c.state(ctx, serial)
+	return stateResult(state), err
+}
+
+//
+// Results
+//
+
+type (
+	devicesResult  []simulator.DeviceSummary
+	paramsResult   []simulator.ParameterInfo
+	pendingResult  simulator.PendingInfo
+	sessionsResult []simulator.SessionInfo
+	faultsResult   []simulator.FaultRuleStatus
+	stateResult    json.RawMessage
+	statusResult   struct {
+		Status string `json:"status"`
+	}
+)
+
+func (r devicesResult) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL NUMBER\tMANUFACTURER\tPRODUCT CLASS\tBOOTSTRAPPED\tDOWN UNTIL")
+	for _, d := range r {
+		downUntil := "-"
+		if d.DownUntil != nil {
+			downUntil = d.DownUntil.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", d.SerialNumber, d.Manufacturer, d.ProductClass, d.Bootstrapped, downUntil)
+	}
+	_ = tw.Flush()
+}
+
+func (r paramsResult) print(w io.Writer) {
+	for _, p := range r {
+		if !p.Object {
+			fmt.Fprintf(w, "%s = %s\n", p.Path, p.Value)
+		}
+	}
+}
+
+func (r pendingResult) print(w io.Writer) {
+	fmt.Fprintf(w, "Queued inform triggers: %d\n", r.QueuedInformTriggers)
+	fmt.Fprintf(w, "Events: %s\n", orNone(strings.Join(r.Events, ", ")))
+	if len(r.Tasks) == 0 {
+		fmt.Fprintln(w, "Tasks: -")
+		return
+	}
+	fmt.Fprintln(w, "Tasks:")
+	for _, t := range r.Tasks {
+		fmt.Fprintf(w, "  %s (added %s)\n", t.Name, t.AddedAt.Format(time.RFC3339))
+	}
+}
+
+func (r sessionsResult) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tDURATION\tEVENTS\tMESSAGES\tERROR")
+	for _, s := range r {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			s.StartedAt.Format(time.RFC3339),
+			s.FinishedAt.Sub(s.StartedAt).Round(time.Millisecond),
+			orNone(strings.Join(s.Events, ", ")),
+			orNone(strings.Join(s.Messages, " > ")),
+			orNone(s.Error),
+		)
+	}
+	_ = tw.Flush()
+}
+
+func (r faultsResult) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tMETHOD\tCODE\tPATHS\tENABLED\tMATCHED\tFAULTED")
+	for _, r := range r {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%t\t%d\t%d\n",
+			r.Name, r.Method, r.Code, orNone(strings.Join(r.Paths, ",")),
+			!r.Disabled, r.Matched, r.Faulted)
+	}
+	_ = tw.Flush()
+}
+
+func (r stateResult) print(w io.Writer) {
+	fmt.Fprintln(w, string(r))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r stateResult) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func (r statusResult) print(w io.Writer) {
+	fmt.Fprintln(w, r.Status)
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// orAll returns the pattern that selects all devices if none is given.
+func orAll(pattern string) string {
+	if pattern == "" {
+		return "*"
+	}
+	return pattern
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: simctl [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  devices\tList devices\n")
+	for _, name := range []string{"get", "set", "inform", "reboot", "factory-reset", "offline", "pending", "sessions", "faults", "enable-fault", "disable-fault", "dump"} {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w, "\nFlags:")
+	flag.PrintDefaults()
+}
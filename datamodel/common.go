@@ -43,6 +43,7 @@ const (
 	pathSerialNumber                = "DeviceInfo.SerialNumber"
 	pathSoftwareVersion             = "DeviceInfo.SoftwareVersion"
 	pathUptime                      = "DeviceInfo.UpTime"
+	pathManagementServerURL         = "ManagementServer.URL"
 	pathConnectionRequestURL        = "ManagementServer.ConnectionRequestURL"
 	pathConnectionRequestUsername   = "ManagementServer.ConnectionRequestUsername"
 	pathConnectionRequestPassword   = "ManagementServer.ConnectionRequestPassword"
@@ -58,6 +59,18 @@ func (dm *DataModel) SetSerialNumber(val string) {
 	dm.SetValue(pathSerialNumber, val)
 }
 
+// ACSURL returns the URL of the ACS.
+func (dm *DataModel) ACSURL() string {
+	p, _ := dm.GetValue(pathManagementServerURL)
+	return p.GetValue()
+}
+
+// SeedACSURL sets the initial URL of the ACS. It will be overridden by any
+// changes made by the ACS.
+func (dm *DataModel) SeedACSURL(val string) {
+	dm.SeedValue(pathManagementServerURL, val)
+}
+
 // ConnectionRequestURL returns the connection request URL.
 func (dm *DataModel) ConnectionRequestURL() Parameter {
 	p, _ := dm.GetValue(pathConnectionRequestURL)
@@ -81,6 +94,12 @@ func (dm *DataModel) SetUDPConnectionRequestAddress(val string) {
 	dm.SetValue(pathUDPConnectionRequestAddress, val)
 }
 
+// ConnReqJabberID returns the Jabber ID used for XMPP connection requests.
+func (dm *DataModel) ConnReqJabberID() Parameter {
+	p, _ := dm.GetValue(pathConnReqJabberID)
+	return p
+}
+
 // ConnectionRequestUsername returns the connection request username.
 func (dm *DataModel) ConnectionRequestUsername() Parameter {
 	p, _ := dm.GetValue(pathConnectionRequestUsername)
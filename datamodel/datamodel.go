@@ -80,10 +80,8 @@ func (dm *DataModel) GetAll(path string) (params []Parameter, ok bool) {
 		return []Parameter{p}, ok
 	}
 
-	dm.values.forEach(func(p Parameter) (cont bool) {
-		if strings.HasPrefix(p.Path, path) {
-			params = append(params, p)
-		}
+	dm.values.forEachPrefix(path, func(p Parameter) (cont bool) {
+		params = append(params, p)
 		return true
 	})
 
@@ -123,6 +121,20 @@ func (dm *DataModel) SetValue(path, val string) {
 	dm.values.save(param)
 }
 
+// SeedValue sets the initial value of a given parameter. Seeded values take
+// precedence over the defaults but not over the changes made to the
+// datamodel. Seeded values are not saved to the state file and are preserved
+// after a factory reset.
+func (dm *DataModel) SeedValue(path, val string) {
+	path = dm.prefixedPath(path)
+	param, ok := dm.values.base(path)
+	if !ok {
+		param = newParameter(path)
+	}
+	param.Value = val
+	dm.values.seed(param)
+}
+
 // SetValues saves multiple parameter values.
 func (dm *DataModel) SetValues(params []Parameter) {
 	for _, p := range params {
@@ -183,7 +195,7 @@ func (dm *DataModel) AddObject(name string) (int, error) {
 
 	reg := regexp.MustCompile(`^` + name + `\.(\d+)`)
 	var maxIndex int
-	dm.values.forEach(func(p Parameter) (cont bool) {
+	dm.values.forEachPrefix(name+".", func(p Parameter) (cont bool) {
 		m := reg.FindStringSubmatch(p.Path)
 		if len(m) < 2 {
 			return true
@@ -211,6 +223,7 @@ func (dm *DataModel) AddObject(name string) (int, error) {
 
 // DeleteObject deletes the given object.
 func (dm *DataModel) DeleteObject(name string) {
+	name = dm.prefixedPath(name)
 	objName := strings.TrimSuffix(name, ".")
 	// TODO: Improve this check. See if parent is writable
 	dm.values.delete(objName)
@@ -221,6 +234,7 @@ func (dm *DataModel) DeleteObject(name string) {
 // set to true the list of parameters goes one level deeper.
 func (dm *DataModel) ParameterNames(path string, nextLevel bool) []Parameter {
 	var reg *regexp.Regexp
+	var prefix string
 	if path == "" {
 		if nextLevel {
 			reg = regexp.MustCompile(`^[^\.]+$`)
@@ -229,6 +243,7 @@ func (dm *DataModel) ParameterNames(path string, nextLevel bool) []Parameter {
 		}
 	} else {
 		path = strings.TrimSuffix(path, ".")
+		prefix = path + "."
 		path = strings.ReplaceAll(path, ".", "\\.")
 
 		if nextLevel {
@@ -239,7 +254,7 @@ func (dm *DataModel) ParameterNames(path string, nextLevel bool) []Parameter {
 	}
 
 	params := []Parameter{}
-	dm.values.forEach(func(p Parameter) (cont bool) {
+	dm.values.forEachPrefix(prefix, func(p Parameter) (cont bool) {
 		if reg.MatchString(p.Path) {
 			params = append(params, p)
 		}
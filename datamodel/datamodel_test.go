@@ -193,6 +193,31 @@ func TestSetValue(t *testing.T) {
 	assert.Equal(t, "New Description", param.Value)
 }
 
+func TestSeedValue(t *testing.T) {
+	const path = "Device.ManagementServer.URL"
+	state := newState()
+	dm := New(state.WithDefaults(map[string]Parameter{
+		path: {
+			Path:     path,
+			Writable: true,
+			Type:     "xsd:string",
+			Value:    "http://default/acs",
+		},
+	}))
+
+	dm.SeedACSURL("http://seed/acs")
+	assert.Equal(t, "http://seed/acs", dm.ACSURL())
+	assert.Empty(t, dm.values.Changes)
+	param, _ := dm.GetValue(path)
+	assert.Equal(t, "xsd:string", param.Type)
+
+	dm.SetValue(path, "http://changed/acs")
+	assert.Equal(t, "http://changed/acs", dm.ACSURL())
+
+	dm.Reset()
+	assert.Equal(t, "http://seed/acs", dm.ACSURL())
+}
+
 func TestSetValuesEmpty(t *testing.T) {
 	dm := New(newState())
 	dm.SetValues([]Parameter{})
@@ -0,0 +1,71 @@
+package datamodel
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Defaults is an immutable set of default parameters, usually loaded from a
+// datamodel file. Defaults are indexed by path and are safe to share between
+// any number of states, each state only keeps its own changes.
+type Defaults struct {
+	params map[string]Parameter
+	// paths is a sorted list of parameter paths used for prefix lookups.
+	paths []string
+}
+
+// NewDefaults creates an immutable set of default parameters. Parameters are
+// copied, later changes to the given map have no effect on the defaults.
+func NewDefaults(params map[string]Parameter) *Defaults {
+	d := &Defaults{
+		params: make(map[string]Parameter, len(params)),
+		paths:  slices.Sorted(maps.Keys(params)),
+	}
+	for path, p := range params {
+		// Generators are stateful, every state creates its own instances
+		if p.genfn != nil {
+			p.gen = nil
+		}
+		d.params[path] = p
+	}
+	return d
+}
+
+// Len returns the number of default parameters.
+func (d *Defaults) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.paths)
+}
+
+func (d *Defaults) get(path string) (p Parameter, ok bool) {
+	if d == nil {
+		return p, false
+	}
+	p, ok = d.params[path]
+	return
+}
+
+// forEach calls fn for every parameter in lexicographical order of their paths
+// until fn returns false. It returns false if the iteration was stopped.
+func (d *Defaults) forEach(fn func(Parameter) (cont bool)) bool {
+	return d.forEachPrefix("", fn)
+}
+
+// forEachPrefix calls fn for every parameter which path starts with the given
+// prefix until fn returns false. It returns false if the iteration was
+// stopped.
+func (d *Defaults) forEachPrefix(prefix string, fn func(Parameter) (cont bool)) bool {
+	if d == nil {
+		return true
+	}
+	i, _ := slices.BinarySearch(d.paths, prefix)
+	for ; i < len(d.paths) && strings.HasPrefix(d.paths[i], prefix); i++ {
+		if !fn(d.params[d.paths[i]]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package datamodel
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestDefaultsForEachPrefix(t *testing.T) {
+	d := NewDefaults(map[string]Parameter{
+		"Device.A":   {Path: "Device.A"},
+		"Device.B.1": {Path: "Device.B.1"},
+		"Device.B.2": {Path: "Device.B.2"},
+		"Device.BC":  {Path: "Device.BC"},
+	})
+	var paths []string
+	d.forEachPrefix("Device.B.", func(p Parameter) bool {
+		paths = append(paths, p.Path)
+		return true
+	})
+	assert.Equal(t, []string{"Device.B.1", "Device.B.2"}, paths)
+
+	var nilDefaults *Defaults
+	assert.Equal(t, 0, nilDefaults.Len())
+	_, ok := nilDefaults.get("Device.A")
+	assert.False(t, ok)
+}
+
+func TestSharedDefaultsGenerators(t *testing.T) {
+	p := Parameter{
+		Path:  "Device.Stats.Counter",
+		Type:  rpc.TypeGenerator,
+		Value: "trendWithNoise(startValue=0, step=1, noiseScale=0) as xsd:int",
+	}
+	require.NoError(t, p.initGenerator())
+	d := NewDefaults(map[string]Parameter{p.Path: p})
+
+	dm1 := New(newState().WithSharedDefaults(d))
+	dm2 := New(newState().WithSharedDefaults(d))
+	value := func(dm *DataModel) string {
+		p, _ := dm.GetValue("Device.Stats.Counter")
+		return p.GetValue()
+	}
+	assert.Equal(t, "1", value(dm1))
+	assert.Equal(t, "2", value(dm1))
+	assert.Equal(t, "1", value(dm2))
+
+	// Factory reset restarts generators
+	dm1.Reset()
+	assert.Equal(t, "1", value(dm1))
+}
+
+func TestSharedDefaultsMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping memory test in short mode")
+	}
+
+	const numParams = 20000
+	const numDevices = 1000
+	params := make(map[string]Parameter, numParams)
+	for i := range numParams {
+		path := fmt.Sprintf("Device.Test.%d.Value", i)
+		params[path] = Parameter{Path: path, Type: rpc.XSD(rpc.TypeString), Value: "value"}
+	}
+	d := NewDefaults(params)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	dms := make([]*DataModel, numDevices)
+	for i := range dms {
+		dm := New(newState().WithSharedDefaults(d))
+		dm.SetSerialNumber(fmt.Sprintf("SIM-%04d", i))
+		dm.SetValue("Device.Test.1.Value", "changed")
+		dms[i] = dm
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(dms)
+
+	// Heap can shrink if the GC frees more than the devices use, compare as
+	// signed values so the difference doesn't wrap around
+	perDevice := (int64(after.HeapAlloc) - int64(before.HeapAlloc)) / numDevices
+	t.Logf("Memory per device: %d bytes", perDevice)
+	assert.Less(t, perDevice, int64(16<<10))
+}
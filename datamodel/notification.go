@@ -1,15 +1,21 @@
 package datamodel
 
 import (
+	"slices"
+
 	"github.com/localhots/SimulaTR69/rpc"
 )
 
 // NotifyParams returns a list of parameters that should be included in the next
-// inform message. This will always include forced parameters.
+// inform message. This will always include forced parameters and the Jabber ID
+// used for XMPP connection requests, if there is one.
 func (dm *DataModel) NotifyParams() []string {
 	params := dm.ForcedInformParameters()
+	if p, ok := dm.GetValue(pathConnReqJabberID); ok && p.GetValue() != "" {
+		params = append(params, p.Path)
+	}
 	dm.values.forEach(func(p Parameter) (cont bool) {
-		if p.Notification == rpc.AttributeNotificationPassive {
+		if p.Notification == rpc.AttributeNotificationPassive && !slices.Contains(params, p.Path) {
 			params = append(params, p.Path)
 		}
 		return true
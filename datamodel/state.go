@@ -1,36 +1,70 @@
 package datamodel
 
 import (
+	"encoding/json"
 	"strings"
 	"sync"
+
+	"github.com/localhots/SimulaTR69/datamodel/noise"
 )
 
 // State represents the state of parameters with support for tracking changes,
 // deletions, and default values. It uses a read-write mutex to ensure thread-
 // safe access and modifications.
+//
+// Seeds are values that take precedence over defaults but are not persisted
+// and survive a reset. They are used for values provided by the environment.
+//
+// Defaults are shared and never modified, a state only stores its own changes
+// and instances of the generators used by the parameters it has accessed.
 type State struct {
 	Bootstrapped bool                 `json:"Bootstrapped"`
 	Changes      map[string]Parameter `json:"Changes"`
 	Deleted      map[string]struct{}  `json:"Deleted"`
-	defaults     map[string]Parameter
+	defaults     *Defaults
+	seeds        map[string]Parameter
+	generators   map[string]noise.Generator
 	lock         sync.RWMutex
+	genLock      sync.Mutex
 }
 
 func newState() *State {
 	return &State{
-		Changes:  make(map[string]Parameter),
-		Deleted:  make(map[string]struct{}),
-		defaults: make(map[string]Parameter),
+		Changes: make(map[string]Parameter),
+		Deleted: make(map[string]struct{}),
 	}
 }
 
 // WithDefaults sets the default parameters for the state and returns the
-// updated state. It allows chaining of state modifications.
+// updated state. It allows chaining of state modifications. Use
+// WithSharedDefaults to share the same defaults between multiple states.
 func (s *State) WithDefaults(dm map[string]Parameter) *State {
-	s.defaults = dm
+	return s.WithSharedDefaults(NewDefaults(dm))
+}
+
+// WithSharedDefaults sets the default parameters for the state and returns the
+// updated state. The same defaults can be used by any number of states.
+func (s *State) WithSharedDefaults(d *Defaults) *State {
+	s.defaults = d
 	return s
 }
 
+// MarshalJSON implements json.Marshaler. It allows the state to be saved
+// while it is being modified.
+func (s *State) MarshalJSON() ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return json.Marshal(struct {
+		Bootstrapped bool
+		Changes      map[string]Parameter
+		Deleted      map[string]struct{}
+	}{
+		Bootstrapped: s.Bootstrapped,
+		Changes:      s.Changes,
+		Deleted:      s.Deleted,
+	})
+}
+
 func (s *State) get(name string) (p Parameter, ok bool) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -38,35 +72,110 @@ func (s *State) get(name string) (p Parameter, ok bool) {
 	if _, ok := s.Deleted[name]; ok {
 		return p, false
 	}
-	if p, ok = s.Changes[name]; ok {
-		return
+	if p, ok = s.Changes[name]; !ok {
+		if p, ok = s.seeds[name]; !ok {
+			p, ok = s.defaults.get(name)
+		}
+	}
+	if ok {
+		p = s.withGenerator(p)
 	}
-	p, ok = s.defaults[name]
 	return
 }
 
+// base returns a parameter ignoring any changes made to it.
+func (s *State) base(name string) (p Parameter, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if p, ok = s.seeds[name]; ok {
+		return
+	}
+	return s.defaults.get(name)
+}
+
 func (s *State) forEach(fn func(Parameter) (cont bool)) {
+	s.forEachPrefix("", fn)
+}
+
+// forEachPrefix calls fn for every parameter which path starts with the given
+// prefix until fn returns false.
+func (s *State) forEachPrefix(prefix string, fn func(Parameter) (cont bool)) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
 	for _, p := range s.Changes {
-		if cont := fn(p); !cont {
+		if !strings.HasPrefix(p.Path, prefix) {
+			continue
+		}
+		if cont := fn(s.withGenerator(p)); !cont {
 			return
 		}
 	}
-	for _, p := range s.defaults {
-		// Skip if deleted
-		if _, ok := s.Deleted[p.Path]; ok {
-			continue
-		}
-		// Skip if present in the state
-		if _, ok := s.Changes[p.Path]; ok {
+	for _, p := range s.seeds {
+		// Skip if deleted or present in the state
+		if !strings.HasPrefix(p.Path, prefix) || s.shadowed(p.Path) {
 			continue
 		}
-		if cont := fn(p); !cont {
+		if cont := fn(s.withGenerator(p)); !cont {
 			return
 		}
 	}
+	s.defaults.forEachPrefix(prefix, func(p Parameter) (cont bool) {
+		// Skip if deleted or present in the state
+		if s.shadowed(p.Path) {
+			return true
+		}
+		// Skip if seeded
+		if _, ok := s.seeds[p.Path]; ok {
+			return true
+		}
+		return fn(s.withGenerator(p))
+	})
+}
+
+func (s *State) shadowed(name string) bool {
+	if _, ok := s.Deleted[name]; ok {
+		return true
+	}
+	_, ok := s.Changes[name]
+	return ok
+}
+
+// withGenerator attaches a generator instance owned by this state to the
+// parameter if it uses one. Generators are created on first access.
+func (s *State) withGenerator(p Parameter) Parameter {
+	if p.genfn == nil {
+		return p
+	}
+
+	s.genLock.Lock()
+	defer s.genLock.Unlock()
+
+	gen, ok := s.generators[p.Path]
+	if !ok {
+		var err error
+		// Generator definitions are validated when the datamodel is loaded
+		if gen, err = p.genfn.Generator(); err != nil {
+			return p
+		}
+		if s.generators == nil {
+			s.generators = make(map[string]noise.Generator)
+		}
+		s.generators[p.Path] = gen
+	}
+	p.gen = gen
+	return p
+}
+
+func (s *State) seed(p Parameter) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.seeds == nil {
+		s.seeds = make(map[string]Parameter)
+	}
+	s.seeds[p.Path] = p
 }
 
 func (s *State) save(p Parameter) {
@@ -84,7 +193,9 @@ func (s *State) delete(name string) {
 	if _, ok := s.Changes[name]; ok {
 		delete(s.Changes, name)
 		s.Deleted[name] = struct{}{}
-	} else if _, ok := s.defaults[name]; ok {
+	} else if _, ok := s.defaults.get(name); ok {
+		s.Deleted[name] = struct{}{}
+	} else if _, ok := s.seeds[name]; ok {
 		s.Deleted[name] = struct{}{}
 	}
 }
@@ -99,7 +210,11 @@ func (s *State) deletePrefix(prefix string) {
 			s.Deleted[p.Path] = struct{}{}
 		}
 	}
-	for _, p := range s.defaults {
+	s.defaults.forEachPrefix(prefix, func(p Parameter) (cont bool) {
+		s.Deleted[p.Path] = struct{}{}
+		return true
+	})
+	for _, p := range s.seeds {
 		if strings.HasPrefix(p.Path, prefix) {
 			s.Deleted[p.Path] = struct{}{}
 		}
@@ -113,4 +228,8 @@ func (s *State) reset() {
 	s.Bootstrapped = false
 	s.Changes = make(map[string]Parameter)
 	s.Deleted = make(map[string]struct{})
+
+	s.genLock.Lock()
+	s.generators = nil
+	s.genLock.Unlock()
 }
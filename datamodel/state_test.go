@@ -26,7 +26,10 @@ func TestStateWithDefaults(t *testing.T) {
 		},
 	}
 	state = state.WithDefaults(defaults)
-	assert.Equal(t, defaults, state.defaults)
+	assert.Equal(t, 1, state.defaults.Len())
+	p, ok := state.defaults.get("Device.DeviceInfo.Description")
+	assert.True(t, ok)
+	assert.Equal(t, defaults["Device.DeviceInfo.Description"], p)
 }
 
 func TestStateGet(t *testing.T) {
@@ -117,7 +117,7 @@ func (dm *DataModel) SaveState(stateFile string) error {
 		return nil
 	}
 
-	b, err := json.MarshalIndent(dm.values, "", "  ")
+	b, err := dm.MarshalState()
 	if err != nil {
 		return fmt.Errorf("marshal datamodel: %w", err)
 	}
@@ -127,3 +127,9 @@ func (dm *DataModel) SaveState(stateFile string) error {
 	}
 	return nil
 }
+
+// MarshalState returns the state in the same format as it is saved to the
+// state file.
+func (dm *DataModel) MarshalState() ([]byte, error) {
+	return json.MarshalIndent(dm.values, "", "  ")
+}
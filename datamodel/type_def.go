@@ -57,6 +57,28 @@ func parseTypeDef(str string) (*typeDef, error) {
 	return td.normalize(), nil
 }
 
+// InRange returns false if the value is outside of the range of the given
+// type definition, e.g. 500 for unsignedInt(0:100). Ranges limit values of
+// numeric types and lengths of other types. Values that can't be parsed are
+// not checked.
+func InRange(typ, val string) bool {
+	td, err := parseTypeDef(typ)
+	if err != nil || td.max == nil {
+		return true
+	}
+	n := int64(len(val))
+	switch td.name {
+	case rpc.TypeInt, rpc.TypeLong, rpc.TypeUnsignedInt, rpc.TypeUnsignedLong:
+		if n, err = strconv.ParseInt(strings.TrimSpace(val), 10, 64); err != nil {
+			return true
+		}
+	}
+	if td.min != nil && n < int64(*td.min) {
+		return false
+	}
+	return n <= int64(*td.max)
+}
+
 func (td *typeDef) String() string {
 	if td.min != nil {
 		return fmt.Sprintf("%s(%d:%d)", rpc.XSD(td.name), *td.min, *td.max)
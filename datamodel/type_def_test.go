@@ -72,3 +72,14 @@ func TestParseTypeDef(t *testing.T) {
 		require.Nil(t, td)
 	})
 }
+
+func TestInRange(t *testing.T) {
+	assert.True(t, InRange("xsd:unsignedInt(0:100)", "100"))
+	assert.False(t, InRange("xsd:unsignedInt(0:100)", "500"))
+	assert.False(t, InRange("xsd:int(10:50)", "-5"))
+	assert.True(t, InRange("xsd:int(10)", "-5"))
+	assert.True(t, InRange("xsd:string(4)", "abcd"))
+	assert.False(t, InRange("xsd:string(4)", "abcde"))
+	assert.True(t, InRange("xsd:string", "anything"))
+	assert.True(t, InRange("xsd:int(10:50)", "not a number"))
+}
@@ -0,0 +1,181 @@
+package datamodel
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XMPPConnection describes an XMPP connection configured in the
+// Device.XMPP.Connection.{i}. object.
+type XMPPConnection struct {
+	Path              string
+	Enable            bool
+	Username          string
+	Password          string
+	Domain            string
+	Resource          string
+	UseTLS            bool
+	KeepAliveInterval int64
+	Servers           []XMPPServer
+}
+
+// XMPPServer describes an XMPP server configured in the
+// Device.XMPP.Connection.{i}.Server.{i}. object.
+type XMPPServer struct {
+	Address  string
+	Port     int
+	Priority int
+}
+
+const (
+	pathConnReqXMPPConnection   = "ManagementServer.ConnReqXMPPConnection"
+	pathConnReqJabberID         = "ManagementServer.ConnReqJabberID"
+	pathConnReqAllowedJabberIDs = "ManagementServer.ConnReqAllowedJabberIDs"
+
+	defaultXMPPPort = 5222
+)
+
+// ConnReqXMPPConnection returns the XMPP connection that is used for
+// connection requests. It returns false if no connection is referenced by
+// the ManagementServer.ConnReqXMPPConnection parameter or if the referenced
+// connection doesn't exist.
+func (dm *DataModel) ConnReqXMPPConnection() (XMPPConnection, bool) {
+	p, ok := dm.GetValue(pathConnReqXMPPConnection)
+	if !ok || p.GetValue() == "" {
+		return XMPPConnection{}, false
+	}
+	return dm.XMPPConnection(p.GetValue())
+}
+
+// XMPPConnection returns the XMPP connection defined at the given path, e.g.
+// Device.XMPP.Connection.1.
+func (dm *DataModel) XMPPConnection(path string) (XMPPConnection, bool) {
+	path = strings.TrimSuffix(path, ".")
+	if !dm.objectExists(path) {
+		return XMPPConnection{}, false
+	}
+
+	conn := XMPPConnection{
+		Path:              path,
+		Enable:            dm.boolValue(path+".Enable", true),
+		Username:          dm.firstValue(path + ".Username"),
+		Password:          dm.firstValue(path + ".Password"),
+		Domain:            dm.firstValue(path + ".Domain"),
+		Resource:          dm.firstValue(path + ".Resource"),
+		UseTLS:            dm.boolValue(path+".UseTLS", false),
+		KeepAliveInterval: dm.intValue(path+".KeepAliveInterval", -1),
+	}
+
+	servers := map[string]*XMPPServer{}
+	disabled := map[string]bool{}
+	prefix := path + ".Server."
+	dm.values.forEachPrefix(prefix, func(p Parameter) (cont bool) {
+		rest := strings.TrimPrefix(p.Path, prefix)
+		idx, field, ok := strings.Cut(rest, ".")
+		if !ok {
+			return true
+		}
+		srv, ok := servers[idx]
+		if !ok {
+			srv = &XMPPServer{Port: defaultXMPPPort}
+			servers[idx] = srv
+		}
+		switch field {
+		case "ServerAddress":
+			srv.Address = p.GetValue()
+		case "Port":
+			if port, err := strconv.Atoi(p.GetValue()); err == nil && port > 0 {
+				srv.Port = port
+			}
+		case "Priority":
+			if prio, err := strconv.Atoi(p.GetValue()); err == nil {
+				srv.Priority = prio
+			}
+		case "Enable":
+			if b, err := strconv.ParseBool(p.GetValue()); err == nil && !b {
+				disabled[idx] = true
+			}
+		}
+		return true
+	})
+	for idx, srv := range servers {
+		if srv.Address != "" && !disabled[idx] {
+			conn.Servers = append(conn.Servers, *srv)
+		}
+	}
+	// Lower values have higher priority
+	sort.SliceStable(conn.Servers, func(i, j int) bool {
+		return conn.Servers[i].Priority < conn.Servers[j].Priority
+	})
+
+	return conn, true
+}
+
+// objectExists returns true if the object is defined in the datamodel or if
+// it has any parameters. Datamodel files often omit object rows.
+func (dm *DataModel) objectExists(path string) bool {
+	if _, ok := dm.values.get(path); ok {
+		return true
+	}
+	var found bool
+	dm.values.forEachPrefix(path+".", func(Parameter) (cont bool) {
+		found = true
+		return false
+	})
+	return found
+}
+
+// SetXMPPConnectionStatus updates the status of the XMPP connection defined at
+// the given path, and the Jabber ID assigned to it by the server.
+func (dm *DataModel) SetXMPPConnectionStatus(path, status, jid string) {
+	path = strings.TrimSuffix(path, ".")
+	dm.SetValue(path+".Status", status)
+	dm.SetValue(path+".JabberID", jid)
+}
+
+// SetConnReqJabberID sets the Jabber ID used for connection requests.
+func (dm *DataModel) SetConnReqJabberID(jid string) {
+	dm.SetValue(pathConnReqJabberID, jid)
+}
+
+// ConnReqAllowedJabberIDs returns a list of Jabber IDs that are allowed to
+// make connection requests. An empty list means that any Jabber ID is allowed.
+func (dm *DataModel) ConnReqAllowedJabberIDs() []string {
+	p, ok := dm.GetValue(pathConnReqAllowedJabberIDs)
+	if !ok {
+		return nil
+	}
+
+	var ids []string
+	for id := range strings.SplitSeq(p.GetValue(), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (dm *DataModel) boolValue(path string, fallback bool) bool {
+	p, ok := dm.values.get(path)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(p.GetValue())
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func (dm *DataModel) intValue(path string, fallback int64) int64 {
+	p, ok := dm.values.get(path)
+	if !ok {
+		return fallback
+	}
+	i, err := strconv.ParseInt(p.GetValue(), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
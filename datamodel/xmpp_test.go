@@ -0,0 +1,54 @@
+package datamodel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestXMPPConnectionWithoutObject(t *testing.T) {
+	dm := New(newState().WithDefaults(map[string]Parameter{
+		"Device.ManagementServer.ConnReqXMPPConnection": {
+			Path:  "Device.ManagementServer.ConnReqXMPPConnection",
+			Value: "Device.XMPP.Connection.1.",
+		},
+		"Device.XMPP.Connection.1.Username": {
+			Path:  "Device.XMPP.Connection.1.Username",
+			Value: "cpe",
+		},
+		"Device.XMPP.Connection.1.Server.1.ServerAddress": {
+			Path:  "Device.XMPP.Connection.1.Server.1.ServerAddress",
+			Value: "127.0.0.1",
+		},
+	}))
+
+	conn, ok := dm.ConnReqXMPPConnection()
+	require.True(t, ok)
+	assert.Equal(t, "Device.XMPP.Connection.1", conn.Path)
+	assert.Equal(t, "cpe", conn.Username)
+	assert.Equal(t, []XMPPServer{{Address: "127.0.0.1", Port: defaultXMPPPort}}, conn.Servers)
+
+	_, ok = dm.XMPPConnection("Device.XMPP.Connection.2")
+	assert.False(t, ok)
+}
+
+func TestNotifyParamsJabberID(t *testing.T) {
+	dm := New(newState().WithDefaults(map[string]Parameter{
+		"Device.ManagementServer.ConnReqJabberID": {
+			Path:         "Device.ManagementServer.ConnReqJabberID",
+			Value:        "cpe@xmpp.example.com/sim",
+			Notification: rpc.AttributeNotificationPassive,
+		},
+	}))
+
+	var n int
+	for _, p := range dm.NotifyParams() {
+		if p == "Device.ManagementServer.ConnReqJabberID" {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n)
+}
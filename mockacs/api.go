@@ -0,0 +1,70 @@
+package mockacs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// APIHandler returns a handler of the API that controls the mock ACS from
+// tests that are not written in Go.
+//
+//	GET  /devices
+//	GET  /devices/{serial}/sessions
+//	POST /devices/{serial}/requests            [{"method": "...", ...}]
+//	POST /devices/{serial}/connection-request
+func (s *Server) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", s.handleListDevices)
+	mux.HandleFunc("GET /devices/{serial}/sessions", s.handleSessions)
+	mux.HandleFunc("POST /devices/{serial}/requests", s.handleEnqueue)
+	mux.HandleFunc("POST /devices/{serial}/connection-request", s.handleConnectionRequest)
+	return mux
+}
+
+func (s *Server) handleListDevices(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.Devices())
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := s.Sessions(r.PathValue("serial"))
+	if sessions == nil {
+		sessions = []Session{}
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	var reqs []Request
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(`expected [{"method": "...", ...}]`))
+		return
+	}
+	if err := s.Enqueue(r.PathValue("serial"), reqs...); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleConnectionRequest(w http.ResponseWriter, r *http.Request) {
+	err := s.ConnectionRequest(r.Context(), r.PathValue("serial"))
+	switch {
+	case errors.Is(err, ErrDeviceNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,59 @@
+package mockacs
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI(t *testing.T) {
+	t.Parallel()
+
+	acs := New()
+	srv := httptest.NewServer(acs.APIHandler())
+	defer srv.Close()
+
+	call := func(method, path, body string) (int, string) {
+		req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	t.Run("enqueue", func(t *testing.T) {
+		status, _ := call(http.MethodPost, "/devices/ABC/requests", `[{"method": "GetParameterValues", "names": ["Device."]}]`)
+		assert.Equal(t, http.StatusNoContent, status)
+		status, body := call(http.MethodPost, "/devices/ABC/requests", `[{"method": "Upload"}]`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, body, "unsupported method")
+		status, _ = call(http.MethodPost, "/devices/ABC/requests", `{}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+	t.Run("devices", func(t *testing.T) {
+		// Devices with queued requests are not listed until they connect
+		status, body := call(http.MethodGet, "/devices", "")
+		assert.Equal(t, http.StatusOK, status)
+		var devices []Device
+		require.NoError(t, json.Unmarshal([]byte(body), &devices))
+		assert.Empty(t, devices)
+	})
+	t.Run("sessions", func(t *testing.T) {
+		status, body := call(http.MethodGet, "/devices/ABC/sessions", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `[]`, body)
+	})
+	t.Run("connection request", func(t *testing.T) {
+		status, _ := call(http.MethodPost, "/devices/ABC/connection-request", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
@@ -0,0 +1,116 @@
+package mockacs
+
+import (
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// newRequestEnvelope creates an envelope that carries the given request.
+func newRequestEnvelope(id string, r Request) *rpc.EnvelopeEncoder {
+	env := rpc.NewEnvelope(id)
+	b := &env.Body
+	switch r.Method {
+	case "GetRPCMethods":
+		b.GetRPCMethods = &rpc.EmptyPayload{}
+	case "GetParameterValues":
+		b.GetParameterValues = &rpc.GetParameterValuesRequestEncoder{
+			ParameterNames: rpc.ParameterNamesEncoder{
+				ArrayType: rpc.ArrayType(rpc.XSD(rpc.TypeString), len(r.Names)),
+				Names:     r.Names,
+			},
+		}
+	case "SetParameterValues":
+		values := make([]rpc.ParameterValueEncoder, 0, len(r.Values))
+		for _, p := range r.Values {
+			typ := p.Type
+			if typ == "" {
+				typ = rpc.XSD(rpc.TypeString)
+			}
+			values = append(values, rpc.ParameterValueEncoder{
+				Name:  p.Name,
+				Value: rpc.ValueEncoder{Type: typ, Value: p.Value},
+			})
+		}
+		b.SetParameterValues = &rpc.SetParameterValuesRequestEncoder{
+			ParameterList: rpc.ParameterListEncoder{
+				ArrayType:       rpc.ArrayType("cwmp:ParameterValueStruct", len(values)),
+				ParameterValues: values,
+			},
+			ParameterKey: r.ParameterKey,
+		}
+	case "GetParameterNames":
+		b.GetParameterNames = &rpc.GetParameterNamesRequestEncoder{ParameterPath: r.Path, NextLevel: r.NextLevel}
+	case "AddObject":
+		b.AddObject = &rpc.AddObjectRequestEncoder{ObjectName: r.Path, ParameterKey: r.ParameterKey}
+	case "DeleteObject":
+		b.DeleteObject = &rpc.DeleteObjectRequestEncoder{ObjectName: r.Path, ParameterKey: r.ParameterKey}
+	case "Download":
+		b.Download = &rpc.DownloadRequestEncoder{
+			CommandKey:     r.CommandKey,
+			FileType:       r.FileType,
+			URL:            r.URL,
+			Username:       r.Username,
+			Password:       r.Password,
+			FileSize:       r.FileSize,
+			TargetFileName: r.TargetFileName,
+			DelaySeconds:   r.DelaySeconds,
+		}
+	case "Reboot":
+		b.Reboot = &rpc.RebootRequestEncoder{CommandKey: r.CommandKey}
+	case "FactoryReset":
+		b.FactoryReset = &rpc.EmptyPayload{}
+	}
+	return env
+}
+
+// newMessage converts a decoded envelope into a message.
+func newMessage(env *rpc.EnvelopeDecoder) Message {
+	b := env.Body
+	m := Message{Method: env.Method()}
+	switch {
+	case b.Inform != nil:
+		for _, e := range b.Inform.Event.Events {
+			m.Events = append(m.Events, e.EventCode)
+		}
+		m.Parameters = parameters(b.Inform.ParameterList)
+	case b.TransferComplete != nil:
+		m.CommandKey = b.TransferComplete.CommandKey
+		m.Fault = transferFault(b.TransferComplete.Fault)
+	case b.AutonomousTransferComplete != nil:
+		m.Fault = transferFault(b.AutonomousTransferComplete.Fault)
+	case b.GetRPCMethodsResponse != nil:
+		m.Methods = b.GetRPCMethodsResponse.MethodList.Methods
+	case b.GetParameterValuesResponse != nil:
+		m.Parameters = parameters(b.GetParameterValuesResponse.ParameterList)
+	case b.SetParameterValuesResponse != nil:
+		m.Status = b.SetParameterValuesResponse.Status
+	case b.GetParameterNamesResponse != nil:
+		m.Names = b.GetParameterNamesResponse.ParameterList.Parameters
+	case b.AddObjectResponse != nil:
+		m.InstanceNumber = b.AddObjectResponse.InstanceNumber
+		m.Status = b.AddObjectResponse.Status
+	case b.DeleteObjectResponse != nil:
+		m.Status = b.DeleteObjectResponse.Status
+	case b.DownloadResponse != nil:
+		m.Status = b.DownloadResponse.Status
+	case b.Fault != nil:
+		f := b.Fault.Detail.Fault
+		m.Fault = &f
+	}
+	return m
+}
+
+func parameters(l rpc.ParameterValueList) []Parameter {
+	params := make([]Parameter, 0, len(l.ParameterValues))
+	for _, v := range l.ParameterValues {
+		params = append(params, Parameter{Name: v.Name, Type: v.Value.Type, Value: v.Value.Value})
+	}
+	return params
+}
+
+// transferFault returns nil if the transfer has succeeded.
+func transferFault(f rpc.FaultStruct) *rpc.FaultStruct {
+	if f.FaultCode == 0 {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,384 @@
+// Package mockacs implements a minimal ACS that is used to drive simulated
+// devices in end-to-end tests. It accepts Informs, sends scripted RPCs to
+// devices, records messages received from them and sends connection requests.
+//
+// Requests are queued per device and sent one by one in the next session with
+// the device. A script can be set to queue the same requests for every device
+// that connects for the first time.
+package mockacs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// ErrDeviceNotFound is returned when a device has never connected to the ACS.
+var ErrDeviceNotFound = errors.New("device not found")
+
+const sessionCookie = "mockacs_session"
+
+// Server is a mock ACS. It is safe for concurrent use.
+type Server struct {
+	script     []Request
+	crUsername string
+	crPassword string
+	client     *http.Client
+
+	devices  map[string]*device
+	sessions map[string]*Session
+	seq      int
+	// changed is closed and replaced every time a session ends
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+// Device describes a device that has connected to the ACS.
+type Device struct {
+	rpc.DeviceID
+	ConnectionRequestURL string    `json:"connection_request_url"`
+	LastInform           time.Time `json:"last_inform"`
+}
+
+// Session is a session with a device.
+type Session struct {
+	ID           int       `json:"id"`
+	SerialNumber string    `json:"serial_number"`
+	Started      time.Time `json:"started"`
+	// Messages are messages received from the device, starting with Inform.
+	Messages []Message `json:"messages"`
+
+	pending *Request
+}
+
+// Message is a message received from a device. Only the fields relevant to
+// the method are set.
+type Message struct {
+	Method string `json:"method"`
+	// Request is the method of the ACS request the message responds to.
+	Request        string                    `json:"request,omitempty"`
+	Events         []string                  `json:"events,omitempty"`
+	Parameters     []Parameter               `json:"parameters,omitempty"`
+	Names          []rpc.ParameterInfoStruct `json:"names,omitempty"`
+	Methods        []string                  `json:"methods,omitempty"`
+	Status         int                       `json:"status"`
+	InstanceNumber int                       `json:"instance_number,omitempty"`
+	CommandKey     string                    `json:"command_key,omitempty"`
+	Fault          *rpc.FaultStruct          `json:"fault,omitempty"`
+}
+
+type device struct {
+	info     Device
+	queue    []Request
+	sessions []Session
+}
+
+// Option configures the mock ACS.
+type Option func(s *Server)
+
+// WithScript sets requests that are queued for every new device.
+func WithScript(reqs ...Request) Option {
+	return func(s *Server) {
+		s.script = reqs
+	}
+}
+
+// WithConnectionRequestAuth sets credentials used to sign connection
+// requests.
+func WithConnectionRequestAuth(username, password string) Option {
+	return func(s *Server) {
+		s.crUsername = username
+		s.crPassword = password
+	}
+}
+
+// New creates a mock ACS.
+func New(opts ...Option) *Server {
+	s := &Server{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		devices:  make(map[string]*device),
+		sessions: make(map[string]*Session),
+		changed:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Enqueue adds requests to the queue of the device. They are sent in the
+// next session.
+func (s *Server) Enqueue(serial string, reqs ...Request) error {
+	for _, r := range reqs {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	d := s.device(serial)
+	d.queue = append(d.queue, reqs...)
+	return nil
+}
+
+// Devices returns devices that have connected to the ACS.
+func (s *Server) Devices() []Device {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	devices := make([]Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		if !d.info.LastInform.IsZero() {
+			devices = append(devices, d.info)
+		}
+	}
+	slices.SortFunc(devices, func(a, b Device) int {
+		return a.LastInform.Compare(b.LastInform)
+	})
+	return devices
+}
+
+// Sessions returns finished sessions with the device.
+func (s *Server) Sessions(serial string) []Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if d, ok := s.devices[serial]; ok {
+		return slices.Clone(d.sessions)
+	}
+	return nil
+}
+
+// WaitSessions waits until at least n sessions with the device are finished
+// and returns all of them.
+func (s *Server) WaitSessions(ctx context.Context, serial string, n int) ([]Session, error) {
+	for {
+		s.lock.Lock()
+		changed := s.changed
+		var sessions []Session
+		if d, ok := s.devices[serial]; ok && len(d.sessions) >= n {
+			sessions = slices.Clone(d.sessions)
+		}
+		s.lock.Unlock()
+		if sessions != nil {
+			return sessions, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ConnectionRequest asks the device to start a session. Requests are signed
+// if connection request credentials are set.
+func (s *Server) ConnectionRequest(ctx context.Context, serial string) error {
+	s.lock.Lock()
+	d, ok := s.devices[serial]
+	var crURL string
+	if ok {
+		crURL = d.info.ConnectionRequestURL
+	}
+	s.lock.Unlock()
+	if crURL == "" {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, serial)
+	}
+
+	u, err := url.Parse(crURL)
+	if err != nil {
+		return fmt.Errorf("parse connection request URL: %w", err)
+	}
+	if s.crUsername != "" {
+		q := u.Query()
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		id, cn := rand.Text(), rand.Text()
+		q.Set("ts", ts)
+		q.Set("id", id)
+		q.Set("un", s.crUsername)
+		q.Set("cn", cn)
+		q.Set("sig", sign(ts+id+s.crUsername+cn, s.crPassword))
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("create connection request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send connection request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("connection request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ServeHTTP implements the CWMP endpoint of the ACS.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var env *rpc.EnvelopeDecoder
+	if len(bytes.TrimSpace(b)) > 0 {
+		if env, err = rpc.Decode(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if env != nil && env.Body.Inform != nil {
+		sess := s.startSession(env)
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: strconv.Itoa(sess.ID)})
+		resp := rpc.NewEnvelope(env.Header.ID.Value)
+		resp.Body.InformResponse = &rpc.InformResponseEncoder{MaxEnvelopes: rpc.MaxEnvelopes}
+		s.respond(w, resp)
+		return
+	}
+
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		http.Error(w, "session not found", http.StatusBadRequest)
+		return
+	}
+	sess, ok := s.sessions[c.Value]
+	if !ok {
+		http.Error(w, "session not found", http.StatusBadRequest)
+		return
+	}
+
+	if env != nil {
+		msg := newMessage(env)
+		switch {
+		case env.Body.TransferComplete != nil:
+			sess.Messages = append(sess.Messages, msg)
+			resp := rpc.NewEnvelope(env.Header.ID.Value)
+			resp.Body.TransferCompleteResponse = &rpc.EmptyPayload{}
+			s.respond(w, resp)
+			return
+		case env.Body.AutonomousTransferComplete != nil:
+			sess.Messages = append(sess.Messages, msg)
+			resp := rpc.NewEnvelope(env.Header.ID.Value)
+			resp.Body.AutonomousTransferCompleteResponse = &rpc.EmptyPayload{}
+			s.respond(w, resp)
+			return
+		case sess.pending != nil:
+			msg.Request = sess.pending.Method
+		}
+		sess.Messages = append(sess.Messages, msg)
+		sess.pending = nil
+	}
+
+	d := s.devices[sess.SerialNumber]
+	if len(d.queue) == 0 {
+		s.endSession(c.Value, sess)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	req := d.queue[0]
+	d.queue = d.queue[1:]
+	sess.pending = &req
+	s.seq++
+	s.respond(w, newRequestEnvelope("mockacs-"+strconv.Itoa(s.seq), req))
+}
+
+func (s *Server) startSession(env *rpc.EnvelopeDecoder) *Session {
+	inform, msg := env.Body.Inform, newMessage(env)
+	serial := inform.DeviceId.SerialNumber
+	d := s.device(serial)
+	// Script is queued in the first session, before requests enqueued
+	// explicitly
+	if d.info.LastInform.IsZero() {
+		d.queue = append(slices.Clone(s.script), d.queue...)
+	}
+	d.info.DeviceID = inform.DeviceId
+	d.info.LastInform = time.Now()
+	for _, p := range msg.Parameters {
+		if p.Name == "Device.ManagementServer.ConnectionRequestURL" ||
+			p.Name == "InternetGatewayDevice.ManagementServer.ConnectionRequestURL" {
+			d.info.ConnectionRequestURL = p.Value
+		}
+	}
+
+	s.seq++
+	sess := &Session{
+		ID:           s.seq,
+		SerialNumber: serial,
+		Started:      time.Now(),
+		Messages:     []Message{msg},
+	}
+	s.sessions[strconv.Itoa(sess.ID)] = sess
+	log.Info("Session started", log.F{
+		"serial_number": serial,
+		"session":       sess.ID,
+		"events":        msg.Events,
+	})
+	return sess
+}
+
+func (s *Server) endSession(id string, sess *Session) {
+	delete(s.sessions, id)
+	sess.pending = nil
+	d := s.devices[sess.SerialNumber]
+	d.sessions = append(d.sessions, *sess)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	log.Info("Session ended", log.F{
+		"serial_number": sess.SerialNumber,
+		"session":       sess.ID,
+		"messages":      len(sess.Messages),
+	})
+}
+
+func (s *Server) device(serial string) *device {
+	d, ok := s.devices[serial]
+	if !ok {
+		d = &device{}
+		d.info.SerialNumber = serial
+		s.devices[serial] = d
+	}
+	return d
+}
+
+func (s *Server) respond(w http.ResponseWriter, env *rpc.EnvelopeEncoder) {
+	b, err := env.Encode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+func sign(input, key string) string {
+	h := hmac.New(sha1.New, []byte(key))
+	h.Write([]byte(input))
+	return hex.EncodeToString(h.Sum(nil))
+}
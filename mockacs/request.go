@@ -0,0 +1,138 @@
+package mockacs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnsupportedMethod is returned for requests the mock ACS can't send.
+var ErrUnsupportedMethod = errors.New("unsupported method")
+
+// Request is an RPC sent to a device. Only the fields relevant to the method
+// are used.
+type Request struct {
+	// Method is the RPC method, e.g. GetParameterValues.
+	Method string `json:"method"`
+	// Names are parameter names requested with GetParameterValues.
+	Names []string `json:"names,omitempty"`
+	// Values are parameters set with SetParameterValues.
+	Values []Parameter `json:"values,omitempty"`
+	// Path is the parameter path for GetParameterNames and the object name
+	// for AddObject and DeleteObject.
+	Path string `json:"path,omitempty"`
+	// NextLevel is used by GetParameterNames.
+	NextLevel    bool   `json:"next_level,omitempty"`
+	ParameterKey string `json:"parameter_key,omitempty"`
+	CommandKey   string `json:"command_key,omitempty"`
+
+	// Download arguments.
+	FileType       string `json:"file_type,omitempty"`
+	URL            string `json:"url,omitempty"`
+	Username       string `json:"username,omitempty"`
+	Password       string `json:"password,omitempty"`
+	FileSize       int    `json:"file_size,omitempty"`
+	TargetFileName string `json:"target_file_name,omitempty"`
+	DelaySeconds   int    `json:"delay_seconds,omitempty"`
+}
+
+// Parameter is a parameter value.
+type Parameter struct {
+	Name string `json:"name"`
+	// Type is the XML schema type, e.g. xsd:boolean. Defaults to xsd:string.
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value"`
+}
+
+// GetRPCMethods creates a GetRPCMethods request.
+func GetRPCMethods() Request {
+	return Request{Method: "GetRPCMethods"}
+}
+
+// GetParameterValues creates a GetParameterValues request.
+func GetParameterValues(names ...string) Request {
+	return Request{Method: "GetParameterValues", Names: names}
+}
+
+// SetParameterValues creates a SetParameterValues request.
+func SetParameterValues(values ...Parameter) Request {
+	return Request{Method: "SetParameterValues", Values: values}
+}
+
+// GetParameterNames creates a GetParameterNames request.
+func GetParameterNames(path string, nextLevel bool) Request {
+	return Request{Method: "GetParameterNames", Path: path, NextLevel: nextLevel}
+}
+
+// AddObject creates an AddObject request. Object name must end with a dot.
+func AddObject(name string) Request {
+	return Request{Method: "AddObject", Path: name}
+}
+
+// DeleteObject creates a DeleteObject request. Object name must end with an
+// instance number followed by a dot.
+func DeleteObject(name string) Request {
+	return Request{Method: "DeleteObject", Path: name}
+}
+
+// Download creates a Download request.
+func Download(fileType, url string, fileSize int) Request {
+	return Request{Method: "Download", FileType: fileType, URL: url, FileSize: fileSize}
+}
+
+// Reboot creates a Reboot request.
+func Reboot(commandKey string) Request {
+	return Request{Method: "Reboot", CommandKey: commandKey}
+}
+
+// FactoryReset creates a FactoryReset request.
+func FactoryReset() Request {
+	return Request{Method: "FactoryReset"}
+}
+
+// Validate checks that the request can be sent.
+func (r Request) Validate() error {
+	switch r.Method {
+	case "GetRPCMethods", "Reboot", "FactoryReset":
+	case "GetParameterValues":
+		if len(r.Names) == 0 {
+			return errors.New("GetParameterValues: names are required")
+		}
+	case "SetParameterValues":
+		if len(r.Values) == 0 {
+			return errors.New("SetParameterValues: values are required")
+		}
+	case "GetParameterNames", "AddObject", "DeleteObject":
+		if r.Path == "" {
+			return fmt.Errorf("%s: path is required", r.Method)
+		}
+	case "Download":
+		if r.URL == "" || r.FileType == "" {
+			return errors.New("Download: url and file type are required")
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedMethod, r.Method)
+	}
+	return nil
+}
+
+// LoadScript reads a list of requests from a JSON file.
+func LoadScript(filePath string) ([]Request, error) {
+	// Assume the file is trusted
+	//nolint:gosec
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read script: %w", err)
+	}
+	var reqs []Request
+	if err := json.Unmarshal(b, &reqs); err != nil {
+		return nil, fmt.Errorf("parse script: %w", err)
+	}
+	for i, r := range reqs {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("request %d: %w", i+1, err)
+		}
+	}
+	return reqs, nil
+}
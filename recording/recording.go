@@ -0,0 +1,158 @@
+// Package recording implements recording of sessions with the ACS. Recordings
+// are stored in JSON Lines format, one message per line, and can be replayed
+// against an ACS to find out if its behavior has changed.
+package recording
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message directions.
+const (
+	// DirectionCPE is a message sent by the device to the ACS.
+	DirectionCPE = "cpe"
+	// DirectionACS is a message received by the device from the ACS.
+	DirectionACS = "acs"
+)
+
+// Entry is a single recorded message.
+type Entry struct {
+	SerialNumber string `json:"serial_number"`
+	// Run identifies a single run of the simulator. Session numbers start
+	// over with every run, so sessions of different runs appended to the same
+	// file are told apart by it.
+	Run string `json:"run,omitempty"`
+	// Session is the sequence number of the session, unique per device within
+	// a run.
+	Session   int       `json:"session"`
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Method    string    `json:"method"`
+	// Status is the HTTP status of the ACS response.
+	Status int    `json:"status,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Session is a recorded session with the ACS.
+type Session struct {
+	SerialNumber string
+	Run          string
+	ID           int
+	Entries      []Entry
+}
+
+// NewRunID returns a random run identifier.
+func NewRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recorder writes recorded messages. It is safe for concurrent use, which
+// allows multiple devices to share a single recording.
+type Recorder struct {
+	w    io.Writer
+	c    io.Closer
+	lock sync.Mutex
+}
+
+// NewRecorder creates a recorder that writes messages to the given writer.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Create creates a recorder that appends messages to the given file.
+func Create(path string) (*Recorder, error) {
+	// Assume the path is trusted
+	//nolint:gosec
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open recording file: %w", err)
+	}
+	return &Recorder{w: f, c: f}, nil
+}
+
+// Record writes a message to the recording.
+func (r *Recorder) Record(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode entry: %w", err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, err := r.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the recording file.
+func (r *Recorder) Close() error {
+	if r.c == nil {
+		return nil
+	}
+	return r.c.Close()
+}
+
+// Load reads recorded sessions from the given file.
+func Load(path string) ([]Session, error) {
+	// Assume the file is trusted
+	//nolint:gosec
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open recording file: %w", err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads recorded sessions. Sessions are ordered by their first message.
+func Read(r io.Reader) ([]Session, error) {
+	type key struct {
+		serial string
+		run    string
+		id     int
+	}
+	var sessions []Session
+	index := map[key]int{}
+
+	sc := bufio.NewScanner(r)
+	// Envelopes with all parameter values can get large
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e.Direction != DirectionCPE && e.Direction != DirectionACS {
+			return nil, fmt.Errorf("line %d: invalid direction %q", line, e.Direction)
+		}
+		k := key{e.SerialNumber, e.Run, e.Session}
+		i, ok := index[k]
+		if !ok {
+			i = len(sessions)
+			index[k] = i
+			sessions = append(sessions, Session{SerialNumber: e.SerialNumber, Run: e.Run, ID: e.Session})
+		}
+		sessions[i].Entries = append(sessions[i].Entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+	return sessions, nil
+}
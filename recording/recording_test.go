@@ -0,0 +1,47 @@
+package recording
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	entries := []Entry{
+		{SerialNumber: "A", Run: "r1", Session: 1, Direction: DirectionCPE, Method: "Inform", Body: "<inform/>"},
+		{SerialNumber: "B", Run: "r1", Session: 1, Direction: DirectionCPE, Method: "Inform", Body: "<inform/>"},
+		{SerialNumber: "A", Run: "r1", Session: 1, Direction: DirectionACS, Method: "InformResponse", Status: 200},
+		{SerialNumber: "A", Run: "r1", Session: 2, Direction: DirectionCPE, Method: "Inform"},
+		// Session numbers start over with a new run
+		{SerialNumber: "A", Run: "r2", Session: 1, Direction: DirectionCPE, Method: "Inform"},
+	}
+	for _, e := range entries {
+		require.NoError(t, r.Record(e))
+	}
+	require.NoError(t, r.Close())
+
+	sessions, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, sessions, 4)
+	assert.Equal(t, "A", sessions[0].SerialNumber)
+	assert.Equal(t, 1, sessions[0].ID)
+	assert.Equal(t, []Entry{entries[0], entries[2]}, sessions[0].Entries)
+	assert.Equal(t, "B", sessions[1].SerialNumber)
+	assert.Equal(t, 2, sessions[2].ID)
+	assert.Equal(t, "r2", sessions[3].Run)
+	assert.Equal(t, []Entry{entries[4]}, sessions[3].Entries)
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := Read(strings.NewReader(""))
+	require.Error(t, err)
+	_, err = Read(strings.NewReader(`{"serial_number":"A","direction":"up"}`))
+	require.ErrorContains(t, err, "invalid direction")
+	_, err = Read(strings.NewReader(`{`))
+	require.ErrorContains(t, err, "line 1")
+}
@@ -0,0 +1,394 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is a deviation of a message from the CWMP schema rules.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Element string `json:"element,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Element == "" {
+		return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Rule, v.Element, v.Message)
+}
+
+// Conformance rules checked in strict mode.
+const (
+	RuleXML            = "xml"
+	RuleBOM            = "bom"
+	RuleNamespace      = "namespace"
+	RuleMustUnderstand = "must_understand"
+	RuleBody           = "body"
+	RuleArrayType      = "array_type"
+	RuleArraySize      = "array_size"
+	RuleRequired       = "required"
+)
+
+// nsCWMPPrefix is the prefix of all CWMP namespace versions.
+const nsCWMPPrefix = "urn:dslforum-org:cwmp-1-"
+
+var (
+	utf8BOM        = []byte{0xEF, 0xBB, 0xBF}
+	arrayTypeRegex = regexp.MustCompile(`^(?:[\w-]+:)?(\w+)\[(\d*)\]$`)
+)
+
+// Elements that are SOAP arrays, by method. Arrays must have the arrayType
+// attribute.
+var arrayElements = map[string][]string{
+	"SetParameterValues":     {"ParameterList"},
+	"GetParameterValues":     {"ParameterNames"},
+	"SetParameterAttributes": {"ParameterList", "ParameterList/SetParameterAttributesStruct/AccessList"},
+	"GetParameterAttributes": {"ParameterNames"},
+	"SetVouchers":            {"VoucherList"},
+	"ScheduleDownload":       {"TimeWindowList"},
+	"ChangeDUState":          {"Operations"},
+}
+
+// Fields that every ACS message must have, by method. Nested fields are
+// separated with a slash and checked in every array item.
+var requiredFields = map[string][]string{
+	"SetParameterValues": {
+		"ParameterList", "ParameterKey",
+		"ParameterList/ParameterValueStruct/Name", "ParameterList/ParameterValueStruct/Value",
+	},
+	"GetParameterValues": {"ParameterNames"},
+	"GetParameterNames":  {"ParameterPath", "NextLevel"},
+	"SetParameterAttributes": {
+		"ParameterList",
+		"ParameterList/SetParameterAttributesStruct/Name",
+		"ParameterList/SetParameterAttributesStruct/NotificationChange",
+		"ParameterList/SetParameterAttributesStruct/Notification",
+		"ParameterList/SetParameterAttributesStruct/AccessListChange",
+		"ParameterList/SetParameterAttributesStruct/AccessList",
+	},
+	"GetParameterAttributes": {"ParameterNames"},
+	"AddObject":              {"ObjectName", "ParameterKey"},
+	"DeleteObject":           {"ObjectName", "ParameterKey"},
+	"Reboot":                 {"CommandKey"},
+	"Download": {
+		"CommandKey", "FileType", "URL", "Username", "Password", "FileSize",
+		"TargetFileName", "DelaySeconds", "SuccessURL", "FailureURL",
+	},
+	"Upload":         {"CommandKey", "FileType", "URL", "Username", "Password", "DelaySeconds"},
+	"ScheduleInform": {"DelaySeconds", "CommandKey"},
+	"SetVouchers":    {"VoucherList"},
+	"GetOptions":     {"OptionName"},
+	"InformResponse": {"MaxEnvelopes"},
+	"KickedResponse": {"NextURL"},
+	"ScheduleDownload": {
+		"CommandKey", "FileType", "URL", "Username", "Password", "FileSize",
+		"TargetFileName", "TimeWindowList",
+	},
+	"CancelTransfer": {"CommandKey"},
+	"ChangeDUState":  {"Operations", "CommandKey"},
+	"Fault":          {"faultcode", "faultstring", "detail", "detail/Fault/FaultCode", "detail/Fault/FaultString"},
+}
+
+// Header elements defined by CWMP.
+var knownHeaders = map[string]bool{
+	"ID":                    true,
+	"HoldRequests":          true,
+	"NoMoreRequests":        true,
+	"SessionTimeout":        true,
+	"SupportedCWMPVersions": true,
+	"UseCWMPVersion":        true,
+}
+
+// Header elements that must be sent with mustUnderstand="1".
+var mustUnderstandHeaders = map[string]bool{
+	"ID":           true,
+	"HoldRequests": true,
+}
+
+// DecodeStrict decodes a message sent by the ACS and validates it against the
+// CWMP schema rules. Violations don't prevent decoding, unless the message is
+// not a well-formed XML document. In that case an error is returned along
+// with the violations found.
+func DecodeStrict(b []byte) (*EnvelopeDecoder, []Violation, error) {
+	var violations []Violation
+	if bytes.HasPrefix(b, utf8BOM) {
+		violations = append(violations, Violation{Rule: RuleBOM, Message: "message starts with a byte order mark"})
+	}
+	root, err := parseTree(newDecoder(b, true))
+	if err != nil {
+		violations = append(violations, Violation{Rule: RuleXML, Message: err.Error()})
+		return nil, violations, fmt.Errorf("decode envelope: %w", err)
+	}
+	env, err := Decode(b)
+	if err != nil {
+		return nil, violations, err
+	}
+	violations = append(violations, checkEnvelope(root)...)
+	return env, violations, nil
+}
+
+// newDecoder creates an XML decoder. Non-strict decoders accept HTML
+// entities and unclosed elements. Both accept a byte order mark and ASCII
+// and Latin-1 encodings.
+func newDecoder(b []byte, strict bool) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(b, utf8BOM)))
+	d.CharsetReader = charsetReader
+	if !strict {
+		d.Strict = false
+		d.AutoClose = xml.HTMLAutoClose
+		d.Entity = xml.HTMLEntity
+	}
+	return d
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		b, err := io.ReadAll(input)
+		if err != nil {
+			return nil, fmt.Errorf("read input: %w", err)
+		}
+		buf := make([]byte, 0, len(b))
+		for _, c := range b {
+			buf = utf8.AppendRune(buf, rune(c))
+		}
+		return bytes.NewReader(buf), nil
+	default:
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+}
+
+// node is an element of a parsed XML document.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+}
+
+func parseTree(d *xml.Decoder) (*node, error) {
+	var stack []*node
+	var root *node
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("parse xml: no root element")
+	}
+	return root, nil
+}
+
+func (n *node) attr(local string) (xml.Attr, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Local == local {
+			return a, true
+		}
+	}
+	return xml.Attr{}, false
+}
+
+func (n *node) child(local string) *node {
+	for _, c := range n.children {
+		if c.name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns all descendants that match the slash separated path.
+func (n *node) find(path string) []*node {
+	nodes := []*node{n}
+	for _, name := range strings.Split(path, "/") {
+		var next []*node
+		for _, p := range nodes {
+			for _, c := range p.children {
+				if c.name.Local == name {
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func checkEnvelope(root *node) []Violation {
+	var vs []Violation
+	add := func(rule, elem, format string, args ...any) {
+		vs = append(vs, Violation{Rule: rule, Element: elem, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if root.name.Local != "Envelope" {
+		add(RuleBody, root.name.Local, "root element must be Envelope")
+		return vs
+	}
+	if root.name.Space != NSEnv {
+		add(RuleNamespace, "Envelope", "unexpected namespace %q", root.name.Space)
+	}
+
+	cwmpNS := map[string]bool{}
+	checkCWMP := func(path string, n *node) {
+		if !strings.HasPrefix(n.name.Space, nsCWMPPrefix) {
+			add(RuleNamespace, path, "unexpected namespace %q", n.name.Space)
+			return
+		}
+		cwmpNS[n.name.Space] = true
+	}
+
+	if header := root.child("Header"); header != nil {
+		if header.name.Space != NSEnv {
+			add(RuleNamespace, "Header", "unexpected namespace %q", header.name.Space)
+		}
+		for _, h := range header.children {
+			path := "Header/" + h.name.Local
+			mu, ok := h.attr("mustUnderstand")
+			if ok && mu.Name.Space != NSEnv {
+				add(RuleNamespace, path, "mustUnderstand attribute has unexpected namespace %q", mu.Name.Space)
+			}
+			if !knownHeaders[h.name.Local] {
+				if ok && mu.Value == "1" {
+					add(RuleMustUnderstand, path, "unknown header must be understood")
+				}
+				continue
+			}
+			checkCWMP(path, h)
+			if mustUnderstandHeaders[h.name.Local] && (!ok || mu.Value != "1") {
+				add(RuleMustUnderstand, path, `%s header must have mustUnderstand="1"`, h.name.Local)
+			}
+		}
+	}
+
+	body := root.child("Body")
+	if body == nil {
+		add(RuleBody, "Envelope", "Body is missing")
+		return vs
+	}
+	if body.name.Space != NSEnv {
+		add(RuleNamespace, "Body", "unexpected namespace %q", body.name.Space)
+	}
+	if len(body.children) != 1 {
+		add(RuleBody, "Body", "Body must contain exactly one element, got %d", len(body.children))
+	}
+	for _, m := range body.children {
+		method := m.name.Local
+		path := "Body/" + method
+		if method == "Fault" {
+			if m.name.Space != NSEnv {
+				add(RuleNamespace, path, "unexpected namespace %q", m.name.Space)
+			}
+		} else {
+			checkCWMP(path, m)
+		}
+
+		for _, field := range requiredFields[method] {
+			checkRequired(m, path, field, add)
+		}
+		for _, field := range arrayElements[method] {
+			for _, a := range m.find(field) {
+				if _, ok := a.attr("arrayType"); !ok {
+					add(RuleArrayType, path+"/"+field, "arrayType attribute is missing")
+				}
+			}
+		}
+		checkArrays(m, path, add)
+
+		if method == "SetParameterValues" {
+			for _, v := range m.find("ParameterList/ParameterValueStruct/Value") {
+				if a, ok := v.attr("type"); !ok || a.Name.Space != NSXSI {
+					add(RuleRequired, path+"/ParameterList/ParameterValueStruct/Value", "xsi:type attribute is missing")
+				}
+			}
+		}
+	}
+
+	if len(cwmpNS) > 1 {
+		spaces := make([]string, 0, len(cwmpNS))
+		for ns := range cwmpNS {
+			spaces = append(spaces, ns)
+		}
+		slices.Sort(spaces)
+		add(RuleNamespace, "", "mixed CWMP namespaces: %s", strings.Join(spaces, ", "))
+	}
+	return vs
+}
+
+// checkRequired reports a violation if a field is missing. For nested fields
+// every parent element is checked.
+func checkRequired(m *node, path, field string, add func(rule, elem, format string, args ...any)) {
+	parents := []*node{m}
+	parentPath, name := "", field
+	if i := strings.LastIndex(field, "/"); i >= 0 {
+		parentPath, name = field[:i], field[i+1:]
+		parents = m.find(parentPath)
+		parentPath = "/" + parentPath
+	}
+	for _, p := range parents {
+		if p.child(name) == nil {
+			add(RuleRequired, path+parentPath, "%s is missing", name)
+		}
+	}
+}
+
+// checkArrays reports arrays which size or item type doesn't match their
+// arrayType attribute.
+func checkArrays(n *node, path string, add func(rule, elem, format string, args ...any)) {
+	if a, ok := n.attr("arrayType"); ok {
+		if a.Name.Space != NSEnc {
+			add(RuleNamespace, path, "arrayType attribute has unexpected namespace %q", a.Name.Space)
+		}
+		m := arrayTypeRegex.FindStringSubmatch(a.Value)
+		switch {
+		case m == nil:
+			add(RuleArrayType, path, "invalid arrayType %q", a.Value)
+		case m[2] != "":
+			size, _ := strconv.Atoi(m[2])
+			if size != len(n.children) {
+				add(RuleArraySize, path, "arrayType %q declares %d items, got %d", a.Value, size, len(n.children))
+			}
+		}
+		if m != nil {
+			for _, c := range n.children {
+				if c.name.Local != m[1] {
+					add(RuleArrayType, path, "arrayType %q doesn't match item %s", a.Value, c.name.Local)
+					break
+				}
+			}
+		}
+	}
+	for _, c := range n.children {
+		checkArrays(c, path+"/"+c.name.Local, add)
+	}
+}
@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeStrictConformingMessages(t *testing.T) {
+	files := []string{
+		"get_rpc_methods_request.xml",
+		"set_parameter_values_request.xml",
+		"get_parameter_values_request.xml",
+		"get_parameter_names_request.xml",
+		"set_parameter_attributes_request.xml",
+		"get_parameter_attributes_request.xml",
+		"add_object_request.xml",
+		"delete_object_request.xml",
+		"reboot_request.xml",
+		"download_request.xml",
+		"upload_request.xml",
+		"factory_reset_request.xml",
+		"get_queued_transfers_request.xml",
+		"get_all_queued_transfers_request.xml",
+		"schedule_inform_request.xml",
+		"set_vouchers_request.xml",
+		"get_options_request.xml",
+		"inform_response.xml",
+		"transfer_complete_response.xml",
+		"autonomous_transfer_complete_response.xml",
+		"request_download_response.xml",
+		"kicked_response.xml",
+		"schedule_download_request.xml",
+		"cancel_transfer_request.xml",
+		"change_du_state_request.xml",
+		"du_state_change_complete_response.xml",
+		"autonomous_du_state_change_complete_response.xml",
+		"fault_response.xml",
+	}
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			b, err := os.ReadFile("test_data/" + file)
+			require.NoError(t, err)
+			env, violations, err := DecodeStrict(b)
+			require.NoError(t, err)
+			assert.NotEqual(t, "Unknown", env.Method())
+			assert.Empty(t, violations)
+		})
+	}
+}
+
+// quirkyMessage has a BOM, non-standard prefixes, mixed CWMP namespaces, a
+// missing arrayType, Latin-1 encoding and an HTML entity.
+var quirkyMessage = append([]byte("\xef\xbb\xbf"), []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cwmp="urn:dslforum-org:cwmp-1-0" xmlns:cwmp2="urn:dslforum-org:cwmp-1-2" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<SOAP-ENV:Header><cwmp:ID SOAP-ENV:mustUnderstand="1">42</cwmp:ID></SOAP-ENV:Header>
+<SOAP-ENV:Body>
+<cwmp2:SetParameterValues>
+<ParameterList>
+<ParameterValueStruct><Name>Device.DeviceInfo.ProvisioningCode</Name><Value xsi:type="xsd:string">caf`+"\xe9"+`&nbsp;</Value></ParameterValueStruct>
+</ParameterList>
+<ParameterKey>key</ParameterKey>
+</cwmp2:SetParameterValues>
+</SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`)...)
+
+func TestDecodeLenient(t *testing.T) {
+	_, err := Decode(quirkyMessage)
+	require.Error(t, err)
+
+	env, err := DecodeLenient(quirkyMessage)
+	require.NoError(t, err)
+	assert.Equal(t, "42", env.Header.ID.Value)
+	require.NotNil(t, env.Body.SetParameterValues)
+	pv := env.Body.SetParameterValues.ParameterList.ParameterValues
+	require.Len(t, pv, 1)
+	assert.Equal(t, "café ", pv[0].Value.Value)
+}
+
+func TestDecodeStrictViolations(t *testing.T) {
+	rulesOf := func(violations []Violation) []string {
+		rules := make([]string, 0, len(violations))
+		for _, v := range violations {
+			rules = append(rules, v.Rule)
+		}
+		return rules
+	}
+
+	// Malformed messages are rejected
+	_, violations, err := DecodeStrict(quirkyMessage)
+	require.Error(t, err)
+	assert.ElementsMatch(t, []string{RuleBOM, RuleXML}, rulesOf(violations), violations)
+
+	wellFormed := bytes.Replace(quirkyMessage, []byte("&nbsp;"), nil, 1)
+	_, violations, err = DecodeStrict(wellFormed)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{RuleBOM, RuleArrayType, RuleNamespace}, rulesOf(violations), violations)
+
+	const msg = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:cwmp="urn:dslforum-org:cwmp-1-0">
+<soapenv:Header><cwmp:ID>1</cwmp:ID><cwmp:HoldRequests>0</cwmp:HoldRequests></soapenv:Header>
+<soapenv:Body>
+<cwmp:GetParameterValues>
+<ParameterNames soapenc:arrayType="xsd:string[2]"><string>Device.</string></ParameterNames>
+</cwmp:GetParameterValues>
+<cwmp:Reboot></cwmp:Reboot>
+</soapenv:Body>
+</soapenv:Envelope>`
+	_, violations, err = DecodeStrict([]byte(msg))
+	require.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Rule: RuleMustUnderstand, Element: "Header/ID", Message: `ID header must have mustUnderstand="1"`},
+		{Rule: RuleMustUnderstand, Element: "Header/HoldRequests", Message: `HoldRequests header must have mustUnderstand="1"`},
+		{Rule: RuleBody, Element: "Body", Message: "Body must contain exactly one element, got 2"},
+		{Rule: RuleArraySize, Element: "Body/GetParameterValues/ParameterNames", Message: `arrayType "xsd:string[2]" declares 2 items, got 1`},
+		{Rule: RuleRequired, Element: "Body/Reboot", Message: "CommandKey is missing"},
+	}, violations)
+}
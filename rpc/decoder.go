@@ -26,6 +26,7 @@ type IDDecoder struct {
 }
 
 type BodyDecoder struct {
+	// ACS messages
 	GetRPCMethods          *EmptyPayload
 	SetParameterValues     *SetParameterValuesRequest
 	GetParameterValues     *GetParameterValuesRequest
@@ -47,11 +48,53 @@ type BodyDecoder struct {
 	InformResponse                     *InformResponse
 	TransferCompleteResponse           *EmptyPayload
 	AutonomousTransferCompleteResponse *EmptyPayload
-	Fault                              *FaultPayload
+	RequestDownloadResponse            *EmptyPayload
+	KickedResponse                     *KickedResponse
+
+	ScheduleDownload                        *ScheduleDownloadRequest
+	CancelTransfer                          *CancelTransferRequest
+	ChangeDUState                           *ChangeDUStateRequest
+	DUStateChangeCompleteResponse           *EmptyPayload
+	AutonomousDUStateChangeCompleteResponse *EmptyPayload
+
+	// CPE messages
+	Inform                         *InformRequest
+	TransferComplete               *TransferCompleteRequest
+	AutonomousTransferComplete     *AutonomousTransferCompleteRequest
+	RequestDownload                *RequestDownloadRequest
+	Kicked                         *KickedRequest
+	GetRPCMethodsResponse          *GetRPCMethodsResponse
+	SetParameterValuesResponse     *SetParameterValuesResponse
+	GetParameterValuesResponse     *GetParameterValuesResponse
+	GetParameterNamesResponse      *GetParameterNamesResponse
+	SetParameterAttributesResponse *EmptyPayload
+	GetParameterAttributesResponse *GetParameterAttributesResponse
+	AddObjectResponse              *AddObjectResponse
+	DeleteObjectResponse           *DeleteObjectResponse
+	RebootResponse                 *EmptyPayload
+	DownloadResponse               *TransferResponse
+	UploadResponse                 *TransferResponse
+	FactoryResetResponse           *EmptyPayload
+	GetQueuedTransfersResponse     *GetQueuedTransfersResponse
+	GetAllQueuedTransfersResponse  *GetAllQueuedTransfersResponse
+	ScheduleInformResponse         *EmptyPayload
+	SetVouchersResponse            *EmptyPayload
+	GetOptionsResponse             *GetOptionsResponse
+
+	ScheduleDownloadResponse        *EmptyPayload
+	CancelTransferResponse          *EmptyPayload
+	ChangeDUStateResponse           *EmptyPayload
+	DUStateChangeComplete           *DUStateChangeCompleteRequest
+	AutonomousDUStateChangeComplete *AutonomousDUStateChangeCompleteRequest
+
+	// Vendor specific messages, or any other unknown ones
+	Vendor *RawMessage `xml:",any"`
+
+	Fault *FaultPayload
 }
 
 //
-// Request payloads
+// ACS payloads
 //
 
 type SetParameterValuesRequest struct {
@@ -175,7 +218,12 @@ func (r DownloadRequest) Debug(ctx context.Context, logger *blip.Logger) {
 }
 
 type UploadRequest struct {
-	CommandKey string
+	CommandKey   string
+	FileType     string
+	URL          string
+	Username     string
+	Password     string
+	DelaySeconds int
 }
 
 func (r UploadRequest) Debug(ctx context.Context, logger *blip.Logger) {
@@ -199,12 +247,173 @@ type GetOptionsRequest struct {
 	OptionName string
 }
 
+type ScheduleDownloadRequest struct {
+	CommandKey     string
+	FileType       string
+	URL            string
+	Username       string
+	Password       string
+	FileSize       uint
+	TargetFileName string
+	TimeWindowList struct {
+		ArrayType string             `xml:"arrayType,attr"`
+		Windows   []TimeWindowStruct `xml:"TimeWindowStruct"`
+	}
+}
+
+type CancelTransferRequest struct {
+	CommandKey string
+}
+
+type ChangeDUStateRequest struct {
+	Operations struct {
+		ArrayType  string                   `xml:"arrayType,attr"`
+		Operations []OperationStructDecoder `xml:"OperationStruct"`
+	}
+	CommandKey string
+}
+
 type EmptyPayload struct{}
 
 type InformResponse struct {
 	MaxEnvelopes int
 }
 
+type KickedResponse struct {
+	NextURL string
+}
+
+//
+// CPE payloads
+//
+
+type InformRequest struct {
+	DeviceId DeviceID
+	Event    struct {
+		ArrayType string        `xml:"arrayType,attr"`
+		Events    []EventStruct `xml:"EventStruct"`
+	}
+	MaxEnvelopes  int
+	CurrentTime   string
+	RetryCount    int
+	ParameterList ParameterValueList
+}
+
+type TransferCompleteRequest struct {
+	CommandKey   string
+	Fault        FaultStruct `xml:"FaultStruct"`
+	StartTime    string
+	CompleteTime string
+}
+
+type AutonomousTransferCompleteRequest struct {
+	AnnounceURL    string
+	TransferURL    string
+	IsDownload     bool
+	FileType       string
+	FileSize       uint
+	TargetFileName string
+	Fault          FaultStruct `xml:"FaultStruct"`
+	StartTime      string
+	CompleteTime   string
+}
+
+type RequestDownloadRequest struct {
+	FileType    string
+	FileTypeArg struct {
+		ArrayType string      `xml:"arrayType,attr"`
+		Args      []ArgStruct `xml:"ArgStruct"`
+	}
+}
+
+type KickedRequest struct {
+	Command string
+	Referer string
+	Arg     string
+	Next    string
+}
+
+type DUStateChangeCompleteRequest struct {
+	Results struct {
+		ArrayType string           `xml:"arrayType,attr"`
+		Results   []OpResultStruct `xml:"OpResultStruct"`
+	}
+	CommandKey string
+}
+
+type AutonomousDUStateChangeCompleteRequest struct {
+	Results struct {
+		ArrayType string                `xml:"arrayType,attr"`
+		Results   []AutonOpResultStruct `xml:"AutonOpResultStruct"`
+	}
+}
+
+type GetRPCMethodsResponse struct {
+	MethodList struct {
+		ArrayType string   `xml:"arrayType,attr"`
+		Methods   []string `xml:"string"`
+	}
+}
+
+type SetParameterValuesResponse struct {
+	Status int
+}
+
+type GetParameterValuesResponse struct {
+	ParameterList ParameterValueList
+}
+
+type GetParameterNamesResponse struct {
+	ParameterList struct {
+		ArrayType  string                `xml:"arrayType,attr"`
+		Parameters []ParameterInfoStruct `xml:"ParameterInfoStruct"`
+	}
+}
+
+type GetParameterAttributesResponse struct {
+	ParameterList struct {
+		ArrayType           string                            `xml:"arrayType,attr"`
+		ParameterAttributes []ParameterAttributeStructDecoder `xml:"ParameterAttributeStruct"`
+	}
+}
+
+type AddObjectResponse struct {
+	InstanceNumber int
+	Status         int
+}
+
+type DeleteObjectResponse struct {
+	Status int
+}
+
+// TransferResponse is a response to Download and Upload requests.
+type TransferResponse struct {
+	Status       int
+	StartTime    string
+	CompleteTime string
+}
+
+type GetQueuedTransfersResponse struct {
+	TransferList struct {
+		ArrayType string                 `xml:"arrayType,attr"`
+		Transfers []QueuedTransferStruct `xml:"QueuedTransferStruct"`
+	}
+}
+
+type GetAllQueuedTransfersResponse struct {
+	TransferList struct {
+		ArrayType string                    `xml:"arrayType,attr"`
+		Transfers []AllQueuedTransferStruct `xml:"AllQueuedTransferStruct"`
+	}
+}
+
+type GetOptionsResponse struct {
+	OptionList struct {
+		ArrayType string         `xml:"arrayType,attr"`
+		Options   []OptionStruct `xml:"OptionStruct"`
+	}
+}
+
 type FaultPayload struct {
 	FaultCode   string             `xml:"faultcode"`
 	FaultString string             `xml:"faultstring"`
@@ -232,6 +441,32 @@ type ParameterValueDecoder struct {
 	}
 }
 
+type ParameterValueList struct {
+	ArrayType       string                  `xml:"arrayType,attr"`
+	ParameterValues []ParameterValueDecoder `xml:"ParameterValueStruct"`
+}
+
+type ParameterAttributeStructDecoder struct {
+	Name         string
+	Notification AttributeNotification
+	AccessList   struct {
+		ArrayType string   `xml:"arrayType,attr"`
+		Values    []string `xml:"string"`
+	}
+}
+
+// OperationStructDecoder is one of install, update or uninstall operations
+// of a ChangeDUState request, the operation is identified by Type.
+type OperationStructDecoder struct {
+	Type            string `xml:"type,attr"`
+	URL             string
+	UUID            string
+	Username        string
+	Password        string
+	Version         string
+	ExecutionEnvRef string
+}
+
 type SetParameterAttributesStruct struct {
 	Name               string
 	NotificationChange bool
@@ -243,10 +478,22 @@ type SetParameterAttributesStruct struct {
 	}
 }
 
-// Decode attempts to decode given payload into a SOAP envelope.
+// Decode attempts to decode given payload into a SOAP envelope. The payload
+// must be a well-formed XML document, namespaces and prefixes are ignored.
+// Use DecodeStrict to validate messages.
 func Decode(b []byte) (*EnvelopeDecoder, error) {
+	return decode(b, true)
+}
+
+// DecodeLenient is like Decode but also accepts malformed XML documents with
+// HTML entities and unclosed elements.
+func DecodeLenient(b []byte) (*EnvelopeDecoder, error) {
+	return decode(b, false)
+}
+
+func decode(b []byte, strict bool) (*EnvelopeDecoder, error) {
 	var env EnvelopeDecoder
-	err := xml.Unmarshal(b, &env)
+	err := newDecoder(b, strict).Decode(&env)
 	if err != nil {
 		return nil, fmt.Errorf("decode envelope: %w", err)
 	}
@@ -292,8 +539,82 @@ func (env EnvelopeDecoder) Method() string {
 		return "GetOptions"
 	case env.Body.Fault != nil:
 		return "Fault"
+	case env.Body.InformResponse != nil:
+		return "InformResponse"
 	case env.Body.TransferCompleteResponse != nil:
 		return "TransferCompleteResponse"
+	case env.Body.AutonomousTransferCompleteResponse != nil:
+		return "AutonomousTransferCompleteResponse"
+	case env.Body.RequestDownloadResponse != nil:
+		return "RequestDownloadResponse"
+	case env.Body.KickedResponse != nil:
+		return "KickedResponse"
+	case env.Body.ScheduleDownload != nil:
+		return "ScheduleDownload"
+	case env.Body.CancelTransfer != nil:
+		return "CancelTransfer"
+	case env.Body.ChangeDUState != nil:
+		return "ChangeDUState"
+	case env.Body.DUStateChangeCompleteResponse != nil:
+		return "DUStateChangeCompleteResponse"
+	case env.Body.AutonomousDUStateChangeCompleteResponse != nil:
+		return "AutonomousDUStateChangeCompleteResponse"
+	case env.Body.Inform != nil:
+		return "Inform"
+	case env.Body.TransferComplete != nil:
+		return "TransferComplete"
+	case env.Body.AutonomousTransferComplete != nil:
+		return "AutonomousTransferComplete"
+	case env.Body.RequestDownload != nil:
+		return "RequestDownload"
+	case env.Body.Kicked != nil:
+		return "Kicked"
+	case env.Body.GetRPCMethodsResponse != nil:
+		return "GetRPCMethodsResponse"
+	case env.Body.SetParameterValuesResponse != nil:
+		return "SetParameterValuesResponse"
+	case env.Body.GetParameterValuesResponse != nil:
+		return "GetParameterValuesResponse"
+	case env.Body.GetParameterNamesResponse != nil:
+		return "GetParameterNamesResponse"
+	case env.Body.SetParameterAttributesResponse != nil:
+		return "SetParameterAttributesResponse"
+	case env.Body.GetParameterAttributesResponse != nil:
+		return "GetParameterAttributesResponse"
+	case env.Body.AddObjectResponse != nil:
+		return "AddObjectResponse"
+	case env.Body.DeleteObjectResponse != nil:
+		return "DeleteObjectResponse"
+	case env.Body.RebootResponse != nil:
+		return "RebootResponse"
+	case env.Body.DownloadResponse != nil:
+		return "DownloadResponse"
+	case env.Body.UploadResponse != nil:
+		return "UploadResponse"
+	case env.Body.FactoryResetResponse != nil:
+		return "FactoryResetResponse"
+	case env.Body.GetQueuedTransfersResponse != nil:
+		return "GetQueuedTransfersResponse"
+	case env.Body.GetAllQueuedTransfersResponse != nil:
+		return "GetAllQueuedTransfersResponse"
+	case env.Body.ScheduleInformResponse != nil:
+		return "ScheduleInformResponse"
+	case env.Body.SetVouchersResponse != nil:
+		return "SetVouchersResponse"
+	case env.Body.GetOptionsResponse != nil:
+		return "GetOptionsResponse"
+	case env.Body.ScheduleDownloadResponse != nil:
+		return "ScheduleDownloadResponse"
+	case env.Body.CancelTransferResponse != nil:
+		return "CancelTransferResponse"
+	case env.Body.ChangeDUStateResponse != nil:
+		return "ChangeDUStateResponse"
+	case env.Body.DUStateChangeComplete != nil:
+		return "DUStateChangeComplete"
+	case env.Body.AutonomousDUStateChangeComplete != nil:
+		return "AutonomousDUStateChangeComplete"
+	case env.Body.Vendor != nil:
+		return env.Body.Vendor.XMLName.Local
 	default:
 		return "Unknown"
 	}
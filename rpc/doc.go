@@ -6,4 +6,8 @@
 // It ensures proper XML formatting and namespace handling as per the TR-069
 // specifications. The package also includes support for generating fault
 // responses and encoding messages with optional pretty-printing.
+//
+// Encoding and decoding is symmetric: messages sent by an ACS can be encoded
+// and messages sent by a CPE can be decoded as well, so the package can be
+// used to build an ACS or a protocol test tool.
 package rpc
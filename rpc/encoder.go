@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"strings"
 )
 
 type EnvelopeEncoder struct {
@@ -29,6 +30,7 @@ type IDEncoder struct {
 }
 
 type BodyEncoder struct {
+	// CPE messages
 	Inform                            *InformRequestEncoder                     `xml:"cwmp:Inform,omitempty"`
 	GetRPCMethodsResponse             *GetRPCMethodsResponseEncoder             `xml:"cwmp:GetRPCMethodsResponse,omitempty"`
 	SetParameterValuesResponse        *SetParameterValuesResponseEncoder        `xml:"cwmp:SetParameterValuesResponse,omitempty"`
@@ -40,14 +42,62 @@ type BodyEncoder struct {
 	DeleteObjectResponse              *DeleteObjectResponseEncoder              `xml:"cwmp:DeleteObjectResponse,omitempty"`
 	RebootResponse                    *RebootResponseEncoder                    `xml:"cwmp:RebootResponse,omitempty"`
 	DownloadResponse                  *DownloadResponseEncoder                  `xml:"cwmp:DownloadResponse,omitempty"`
+	UploadResponse                    *UploadResponseEncoder                    `xml:"cwmp:UploadResponse,omitempty"`
 	FactoryResetResponse              *FactoryResetResponseEncoder              `xml:"cwmp:FactoryResetResponse,omitempty"`
+	GetQueuedTransfersResponse        *GetQueuedTransfersResponseEncoder        `xml:"cwmp:GetQueuedTransfersResponse,omitempty"`
+	GetAllQueuedTransfersResponse     *GetAllQueuedTransfersResponseEncoder     `xml:"cwmp:GetAllQueuedTransfersResponse,omitempty"`
+	ScheduleInformResponse            *EmptyPayload                             `xml:"cwmp:ScheduleInformResponse,omitempty"`
+	SetVouchersResponse               *EmptyPayload                             `xml:"cwmp:SetVouchersResponse,omitempty"`
+	GetOptionsResponse                *GetOptionsResponseEncoder                `xml:"cwmp:GetOptionsResponse,omitempty"`
 	TransferCompleteRequest           *TransferCompleteRequestEncoder           `xml:"cwmp:TransferComplete,omitempty"`
 	AutonomousTransferCompleteRequest *AutonomousTransferCompleteRequestEncoder `xml:"cwmp:AutonomousTransferComplete,omitempty"`
-	Fault                             *FaultEncoder                             `xml:"soapenv:Fault,omitempty"`
+	RequestDownload                   *RequestDownloadRequestEncoder            `xml:"cwmp:RequestDownload,omitempty"`
+	Kicked                            *KickedRequestEncoder                     `xml:"cwmp:Kicked,omitempty"`
+
+	ScheduleDownloadResponse        *EmptyPayload                           `xml:"cwmp:ScheduleDownloadResponse,omitempty"`
+	CancelTransferResponse          *EmptyPayload                           `xml:"cwmp:CancelTransferResponse,omitempty"`
+	ChangeDUStateResponse           *EmptyPayload                           `xml:"cwmp:ChangeDUStateResponse,omitempty"`
+	DUStateChangeComplete           *DUStateChangeCompleteRequestEncoder    `xml:"cwmp:DUStateChangeComplete,omitempty"`
+	AutonomousDUStateChangeComplete *AutonomousDUStateChangeCompleteEncoder `xml:"cwmp:AutonomousDUStateChangeComplete,omitempty"`
+
+	// ACS messages
+	GetRPCMethods                      *EmptyPayload                         `xml:"cwmp:GetRPCMethods,omitempty"`
+	SetParameterValues                 *SetParameterValuesRequestEncoder     `xml:"cwmp:SetParameterValues,omitempty"`
+	GetParameterValues                 *GetParameterValuesRequestEncoder     `xml:"cwmp:GetParameterValues,omitempty"`
+	GetParameterNames                  *GetParameterNamesRequestEncoder      `xml:"cwmp:GetParameterNames,omitempty"`
+	SetParameterAttributes             *SetParameterAttributesRequestEncoder `xml:"cwmp:SetParameterAttributes,omitempty"`
+	GetParameterAttributes             *GetParameterAttributesRequestEncoder `xml:"cwmp:GetParameterAttributes,omitempty"`
+	AddObject                          *AddObjectRequestEncoder              `xml:"cwmp:AddObject,omitempty"`
+	DeleteObject                       *DeleteObjectRequestEncoder           `xml:"cwmp:DeleteObject,omitempty"`
+	Reboot                             *RebootRequestEncoder                 `xml:"cwmp:Reboot,omitempty"`
+	Download                           *DownloadRequestEncoder               `xml:"cwmp:Download,omitempty"`
+	Upload                             *UploadRequestEncoder                 `xml:"cwmp:Upload,omitempty"`
+	FactoryReset                       *EmptyPayload                         `xml:"cwmp:FactoryReset,omitempty"`
+	GetQueuedTransfers                 *EmptyPayload                         `xml:"cwmp:GetQueuedTransfers,omitempty"`
+	GetAllQueuedTransfers              *EmptyPayload                         `xml:"cwmp:GetAllQueuedTransfers,omitempty"`
+	ScheduleInform                     *ScheduleInformRequestEncoder         `xml:"cwmp:ScheduleInform,omitempty"`
+	SetVouchers                        *SetVouchersRequestEncoder            `xml:"cwmp:SetVouchers,omitempty"`
+	GetOptions                         *GetOptionsRequestEncoder             `xml:"cwmp:GetOptions,omitempty"`
+	InformResponse                     *InformResponseEncoder                `xml:"cwmp:InformResponse,omitempty"`
+	TransferCompleteResponse           *EmptyPayload                         `xml:"cwmp:TransferCompleteResponse,omitempty"`
+	AutonomousTransferCompleteResponse *EmptyPayload                         `xml:"cwmp:AutonomousTransferCompleteResponse,omitempty"`
+	RequestDownloadResponse            *EmptyPayload                         `xml:"cwmp:RequestDownloadResponse,omitempty"`
+	KickedResponse                     *KickedResponseEncoder                `xml:"cwmp:KickedResponse,omitempty"`
+
+	ScheduleDownload                        *ScheduleDownloadRequestEncoder `xml:"cwmp:ScheduleDownload,omitempty"`
+	CancelTransfer                          *CancelTransferRequestEncoder   `xml:"cwmp:CancelTransfer,omitempty"`
+	ChangeDUState                           *ChangeDUStateRequestEncoder    `xml:"cwmp:ChangeDUState,omitempty"`
+	DUStateChangeCompleteResponse           *EmptyPayload                   `xml:"cwmp:DUStateChangeCompleteResponse,omitempty"`
+	AutonomousDUStateChangeCompleteResponse *EmptyPayload                   `xml:"cwmp:AutonomousDUStateChangeCompleteResponse,omitempty"`
+
+	// Vendor specific messages
+	Vendor *RawMessage `xml:",omitempty"`
+
+	Fault *FaultEncoder `xml:"soapenv:Fault,omitempty"`
 }
 
 //
-// Payloads
+// CPE payloads
 //
 
 type InformRequestEncoder struct {
@@ -105,6 +155,48 @@ type DownloadResponseEncoder struct {
 
 type FactoryResetResponseEncoder struct{}
 
+type UploadResponseEncoder struct {
+	Status       int
+	StartTime    string
+	CompleteTime string
+}
+
+type GetQueuedTransfersResponseEncoder struct {
+	TransferList struct {
+		ArrayType string                 `xml:"soapenc:arrayType,attr"`
+		Transfers []QueuedTransferStruct `xml:"QueuedTransferStruct"`
+	}
+}
+
+type GetAllQueuedTransfersResponseEncoder struct {
+	TransferList struct {
+		ArrayType string                    `xml:"soapenc:arrayType,attr"`
+		Transfers []AllQueuedTransferStruct `xml:"AllQueuedTransferStruct"`
+	}
+}
+
+type GetOptionsResponseEncoder struct {
+	OptionList struct {
+		ArrayType string         `xml:"soapenc:arrayType,attr"`
+		Options   []OptionStruct `xml:"OptionStruct"`
+	}
+}
+
+type RequestDownloadRequestEncoder struct {
+	FileType    string
+	FileTypeArg struct {
+		ArrayType string      `xml:"soapenc:arrayType,attr"`
+		Args      []ArgStruct `xml:"ArgStruct"`
+	}
+}
+
+type KickedRequestEncoder struct {
+	Command string
+	Referer string
+	Arg     string
+	Next    string
+}
+
 type TransferCompleteRequestEncoder struct {
 	CommandKey   string
 	Fault        any `xml:"FaultStruct,omitempty"`
@@ -124,6 +216,156 @@ type AutonomousTransferCompleteRequestEncoder struct {
 	CompleteTime   string
 }
 
+type DUStateChangeCompleteRequestEncoder struct {
+	Results struct {
+		ArrayType string           `xml:"soapenc:arrayType,attr"`
+		Results   []OpResultStruct `xml:"OpResultStruct"`
+	}
+	CommandKey string
+}
+
+type AutonomousDUStateChangeCompleteEncoder struct {
+	Results struct {
+		ArrayType string                `xml:"soapenc:arrayType,attr"`
+		Results   []AutonOpResultStruct `xml:"AutonOpResultStruct"`
+	}
+}
+
+//
+// ACS payloads
+//
+
+type SetParameterValuesRequestEncoder struct {
+	ParameterList ParameterListEncoder
+	ParameterKey  string
+}
+
+type GetParameterValuesRequestEncoder struct {
+	ParameterNames ParameterNamesEncoder
+}
+
+type GetParameterNamesRequestEncoder struct {
+	ParameterPath string
+	NextLevel     bool
+}
+
+type SetParameterAttributesRequestEncoder struct {
+	ParameterList struct {
+		ArrayType           string                                `xml:"soapenc:arrayType,attr"`
+		ParameterAttributes []SetParameterAttributesStructEncoder `xml:"SetParameterAttributesStruct"`
+	}
+}
+
+type SetParameterAttributesStructEncoder struct {
+	Name               string
+	NotificationChange bool
+	Notification       AttributeNotification
+	AccessListChange   bool
+	AccessList         AccessListEncoder
+}
+
+type GetParameterAttributesRequestEncoder struct {
+	ParameterNames ParameterNamesEncoder
+}
+
+type AddObjectRequestEncoder struct {
+	ObjectName   string
+	ParameterKey string
+}
+
+type DeleteObjectRequestEncoder struct {
+	ObjectName   string
+	ParameterKey string
+}
+
+type RebootRequestEncoder struct {
+	CommandKey string
+}
+
+type DownloadRequestEncoder struct {
+	CommandKey     string
+	FileType       string
+	URL            string
+	Username       string
+	Password       string
+	FileSize       int
+	TargetFileName string
+	DelaySeconds   int
+	SuccessURL     string
+	FailureURL     string
+}
+
+type UploadRequestEncoder struct {
+	CommandKey   string
+	FileType     string
+	URL          string
+	Username     string
+	Password     string
+	DelaySeconds int
+}
+
+type ScheduleInformRequestEncoder struct {
+	DelaySeconds int64
+	CommandKey   string
+}
+
+type SetVouchersRequestEncoder struct {
+	VoucherList struct {
+		ArrayType string   `xml:"soapenc:arrayType,attr"`
+		Values    []string `xml:"base64"`
+	}
+}
+
+type GetOptionsRequestEncoder struct {
+	OptionName string
+}
+
+type ScheduleDownloadRequestEncoder struct {
+	CommandKey     string
+	FileType       string
+	URL            string
+	Username       string
+	Password       string
+	FileSize       uint
+	TargetFileName string
+	TimeWindowList struct {
+		ArrayType string             `xml:"soapenc:arrayType,attr"`
+		Windows   []TimeWindowStruct `xml:"TimeWindowStruct"`
+	}
+}
+
+type CancelTransferRequestEncoder struct {
+	CommandKey string
+}
+
+type ChangeDUStateRequestEncoder struct {
+	Operations struct {
+		ArrayType  string                   `xml:"soapenc:arrayType,attr"`
+		Operations []OperationStructEncoder `xml:"OperationStruct"`
+	}
+	CommandKey string
+}
+
+// OperationStructEncoder is one of install, update or uninstall operations
+// of a ChangeDUState request, the operation is selected with Type.
+type OperationStructEncoder struct {
+	Type            string `xml:"xsi:type,attr"`
+	URL             string `xml:",omitempty"`
+	UUID            string `xml:",omitempty"`
+	Username        string `xml:",omitempty"`
+	Password        string `xml:",omitempty"`
+	Version         string `xml:",omitempty"`
+	ExecutionEnvRef string `xml:",omitempty"`
+}
+
+type InformResponseEncoder struct {
+	MaxEnvelopes int
+}
+
+type KickedResponseEncoder struct {
+	NextURL string
+}
+
 type FaultEncoder struct {
 	FaultCode   string             `xml:"faultcode"`
 	FaultString string             `xml:"faultstring"`
@@ -154,6 +396,11 @@ type AccessListEncoder struct {
 	Values    []string `xml:"string"`
 }
 
+type ParameterNamesEncoder struct {
+	ArrayType string   `xml:"soapenc:arrayType,attr"`
+	Names     []string `xml:"string"`
+}
+
 type MethodListEncoder struct {
 	ArrayType string   `xml:"soapenc:arrayType,attr"`
 	Methods   []string `xml:"string"`
@@ -196,6 +443,68 @@ type SetParameterValuesFault struct {
 	FaultString   string
 }
 
+type QueuedTransferStruct struct {
+	CommandKey string
+	State      int
+}
+
+type AllQueuedTransferStruct struct {
+	CommandKey     string
+	State          int
+	IsDownload     bool
+	FileType       string
+	FileSize       uint
+	TargetFileName string
+}
+
+type OptionStruct struct {
+	OptionName     string
+	VoucherSN      string
+	State          int
+	Mode           int
+	StartDate      string
+	ExpirationDate string
+	IsTransferable bool
+}
+
+type TimeWindowStruct struct {
+	WindowStart uint
+	WindowEnd   uint
+	WindowMode  string
+	UserMessage string
+	MaxRetries  int
+}
+
+type OpResultStruct struct {
+	UUID                 string
+	DeploymentUnitRef    string
+	Version              string
+	CurrentState         string
+	Resolved             bool
+	ExecutionUnitRefList string
+	StartTime            string
+	CompleteTime         string
+	Fault                FaultStruct
+}
+
+type AutonOpResultStruct struct {
+	UUID                 string
+	DeploymentUnitRef    string
+	Version              string
+	CurrentState         string
+	Resolved             bool
+	ExecutionUnitRefList string
+	StartTime            string
+	CompleteTime         string
+	Fault                FaultStruct
+	OperationPerformed   string
+}
+
+type ArgStruct struct {
+	Name  string
+	Value string
+}
+
 type NoFaultStruct struct {
 	Status int `xml:",chardata"`
 }
@@ -256,12 +565,94 @@ func (ee *EnvelopeEncoder) Method() string {
 		return "RebootResponse"
 	case ee.Body.DownloadResponse != nil:
 		return "DownloadResponse"
+	case ee.Body.UploadResponse != nil:
+		return "UploadResponse"
 	case ee.Body.FactoryResetResponse != nil:
 		return "FactoryResetResponse"
+	case ee.Body.GetQueuedTransfersResponse != nil:
+		return "GetQueuedTransfersResponse"
+	case ee.Body.GetAllQueuedTransfersResponse != nil:
+		return "GetAllQueuedTransfersResponse"
+	case ee.Body.ScheduleInformResponse != nil:
+		return "ScheduleInformResponse"
+	case ee.Body.SetVouchersResponse != nil:
+		return "SetVouchersResponse"
+	case ee.Body.GetOptionsResponse != nil:
+		return "GetOptionsResponse"
 	case ee.Body.TransferCompleteRequest != nil:
 		return "TransferCompleteRequest"
 	case ee.Body.AutonomousTransferCompleteRequest != nil:
 		return "AutonomousTransferCompleteRequest"
+	case ee.Body.RequestDownload != nil:
+		return "RequestDownload"
+	case ee.Body.Kicked != nil:
+		return "Kicked"
+	case ee.Body.ScheduleDownloadResponse != nil:
+		return "ScheduleDownloadResponse"
+	case ee.Body.CancelTransferResponse != nil:
+		return "CancelTransferResponse"
+	case ee.Body.ChangeDUStateResponse != nil:
+		return "ChangeDUStateResponse"
+	case ee.Body.DUStateChangeComplete != nil:
+		return "DUStateChangeComplete"
+	case ee.Body.AutonomousDUStateChangeComplete != nil:
+		return "AutonomousDUStateChangeComplete"
+	case ee.Body.GetRPCMethods != nil:
+		return "GetRPCMethods"
+	case ee.Body.SetParameterValues != nil:
+		return "SetParameterValues"
+	case ee.Body.GetParameterValues != nil:
+		return "GetParameterValues"
+	case ee.Body.GetParameterNames != nil:
+		return "GetParameterNames"
+	case ee.Body.SetParameterAttributes != nil:
+		return "SetParameterAttributes"
+	case ee.Body.GetParameterAttributes != nil:
+		return "GetParameterAttributes"
+	case ee.Body.AddObject != nil:
+		return "AddObject"
+	case ee.Body.DeleteObject != nil:
+		return "DeleteObject"
+	case ee.Body.Reboot != nil:
+		return "Reboot"
+	case ee.Body.Download != nil:
+		return "Download"
+	case ee.Body.Upload != nil:
+		return "Upload"
+	case ee.Body.FactoryReset != nil:
+		return "FactoryReset"
+	case ee.Body.GetQueuedTransfers != nil:
+		return "GetQueuedTransfers"
+	case ee.Body.GetAllQueuedTransfers != nil:
+		return "GetAllQueuedTransfers"
+	case ee.Body.ScheduleInform != nil:
+		return "ScheduleInform"
+	case ee.Body.SetVouchers != nil:
+		return "SetVouchers"
+	case ee.Body.GetOptions != nil:
+		return "GetOptions"
+	case ee.Body.InformResponse != nil:
+		return "InformResponse"
+	case ee.Body.TransferCompleteResponse != nil:
+		return "TransferCompleteResponse"
+	case ee.Body.AutonomousTransferCompleteResponse != nil:
+		return "AutonomousTransferCompleteResponse"
+	case ee.Body.RequestDownloadResponse != nil:
+		return "RequestDownloadResponse"
+	case ee.Body.KickedResponse != nil:
+		return "KickedResponse"
+	case ee.Body.ScheduleDownload != nil:
+		return "ScheduleDownload"
+	case ee.Body.CancelTransfer != nil:
+		return "CancelTransfer"
+	case ee.Body.ChangeDUState != nil:
+		return "ChangeDUState"
+	case ee.Body.DUStateChangeCompleteResponse != nil:
+		return "DUStateChangeCompleteResponse"
+	case ee.Body.AutonomousDUStateChangeCompleteResponse != nil:
+		return "AutonomousDUStateChangeCompleteResponse"
+	case ee.Body.Vendor != nil:
+		return strings.TrimPrefix(ee.Body.Vendor.XMLName.Local, "cwmp:")
 	case ee.Body.Fault != nil:
 		return "Fault"
 	default:
@@ -0,0 +1,502 @@
+package rpc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoundTrip checks that every message in test_data decodes the same way
+// as the message built with encoders, which makes the package usable on both
+// sides of the protocol.
+func TestRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		method string
+		build  func(b *BodyEncoder)
+	}{
+		// ACS messages
+		"get_rpc_methods_request.xml": {"GetRPCMethods", func(b *BodyEncoder) {
+			b.GetRPCMethods = &EmptyPayload{}
+		}},
+		"set_parameter_values_request.xml": {"SetParameterValues", func(b *BodyEncoder) {
+			b.SetParameterValues = &SetParameterValuesRequestEncoder{
+				ParameterList: ParameterListEncoder{
+					ArrayType: ArrayType("cwmp:ParameterValueStruct", 2),
+					ParameterValues: []ParameterValueEncoder{
+						{Name: "Device.ManagementServer.ConnectionRequestUsername", Value: ValueEncoder{Type: XSD(TypeString), Value: "G3000E-9799109101"}},
+						{Name: "Device.ManagementServer.ConnectionRequestPassword", Value: ValueEncoder{Type: XSD(TypeString), Value: "secret"}},
+					},
+				},
+				ParameterKey: "n/a",
+			}
+		}},
+		"get_parameter_values_request.xml": {"GetParameterValues", func(b *BodyEncoder) {
+			b.GetParameterValues = &GetParameterValuesRequestEncoder{ParameterNames: testParameterNames("Device.DeviceSummary.")}
+		}},
+		"get_invalid_parameter_values_request.xml": {"GetParameterValues", func(b *BodyEncoder) {
+			b.GetParameterValues = &GetParameterValuesRequestEncoder{ParameterNames: testParameterNames("Device.DeviceSummary.NonExisting")}
+		}},
+		"get_parameter_names_request.xml": {"GetParameterNames", func(b *BodyEncoder) {
+			b.GetParameterNames = &GetParameterNamesRequestEncoder{ParameterPath: "Device.", NextLevel: false}
+		}},
+		"set_parameter_attributes_request.xml": {"SetParameterAttributes", func(b *BodyEncoder) {
+			var r SetParameterAttributesRequestEncoder
+			r.ParameterList.ArrayType = ArrayType("cwmp:SetParameterAttributesStruct", 1)
+			r.ParameterList.ParameterAttributes = []SetParameterAttributesStructEncoder{{
+				Name:               "Device.DeviceSummary",
+				NotificationChange: true,
+				Notification:       AttributeNotificationPassive,
+				AccessListChange:   true,
+				AccessList:         AccessListEncoder{ArrayType: ArrayType(XSD(TypeString), 1), Values: []string{"Subscriber"}},
+			}}
+			b.SetParameterAttributes = &r
+		}},
+		"get_parameter_attributes_request.xml": {"GetParameterAttributes", func(b *BodyEncoder) {
+			b.GetParameterAttributes = &GetParameterAttributesRequestEncoder{ParameterNames: testParameterNames("Device.DeviceInfo.VendorConfigFile.1.Version")}
+		}},
+		"add_object_request.xml": {"AddObject", func(b *BodyEncoder) {
+			b.AddObject = &AddObjectRequestEncoder{ObjectName: "Device.NAT.PortMapping.", ParameterKey: "123"}
+		}},
+		"delete_object_request.xml": {"DeleteObject", func(b *BodyEncoder) {
+			b.DeleteObject = &DeleteObjectRequestEncoder{ObjectName: "Device.NAT.PortMapping.", ParameterKey: "123"}
+		}},
+		"reboot_request.xml": {"Reboot", func(b *BodyEncoder) {
+			b.Reboot = &RebootRequestEncoder{CommandKey: "example"}
+		}},
+		"download_request.xml": {"Download", func(b *BodyEncoder) {
+			b.Download = &DownloadRequestEncoder{
+				CommandKey:     "FirmwareUpgrade",
+				FileType:       FileTypeFirmwareUpgradeImage,
+				URL:            "https://acme-networks.com/firmware/downloads/firmware.bin",
+				Username:       "cpe",
+				Password:       "secret",
+				FileSize:       184258350,
+				TargetFileName: "firmware.bin",
+				SuccessURL:     "http://success",
+				FailureURL:     "http://failure",
+			}
+		}},
+		"upload_request.xml": {"Upload", func(b *BodyEncoder) {
+			b.Upload = testUploadRequest()
+		}},
+		"factory_reset_request.xml": {"FactoryReset", func(b *BodyEncoder) {
+			b.FactoryReset = &EmptyPayload{}
+		}},
+		"get_queued_transfers_request.xml": {"GetQueuedTransfers", func(b *BodyEncoder) {
+			b.GetQueuedTransfers = &EmptyPayload{}
+		}},
+		"get_all_queued_transfers_request.xml": {"GetAllQueuedTransfers", func(b *BodyEncoder) {
+			b.GetAllQueuedTransfers = &EmptyPayload{}
+		}},
+		"schedule_inform_request.xml": {"ScheduleInform", func(b *BodyEncoder) {
+			b.ScheduleInform = &ScheduleInformRequestEncoder{DelaySeconds: 300, CommandKey: "later"}
+		}},
+		"set_vouchers_request.xml": {"SetVouchers", func(b *BodyEncoder) {
+			b.SetVouchers = testSetVouchersRequest()
+		}},
+		"get_options_request.xml": {"GetOptions", func(b *BodyEncoder) {
+			b.GetOptions = &GetOptionsRequestEncoder{OptionName: "X_ACME_Feature"}
+		}},
+		"inform_response.xml": {"InformResponse", func(b *BodyEncoder) {
+			b.InformResponse = &InformResponseEncoder{MaxEnvelopes: MaxEnvelopes}
+		}},
+		"transfer_complete_response.xml": {"TransferCompleteResponse", func(b *BodyEncoder) {
+			b.TransferCompleteResponse = &EmptyPayload{}
+		}},
+		"autonomous_transfer_complete_response.xml": {"AutonomousTransferCompleteResponse", func(b *BodyEncoder) {
+			b.AutonomousTransferCompleteResponse = &EmptyPayload{}
+		}},
+		"request_download_response.xml": {"RequestDownloadResponse", func(b *BodyEncoder) {
+			b.RequestDownloadResponse = &EmptyPayload{}
+		}},
+		"kicked_response.xml": {"KickedResponse", func(b *BodyEncoder) {
+			b.KickedResponse = &KickedResponseEncoder{NextURL: "https://acme-networks.com/portal/done"}
+		}},
+		"schedule_download_request.xml": {"ScheduleDownload", func(b *BodyEncoder) {
+			b.ScheduleDownload = testScheduleDownloadRequest()
+		}},
+		"cancel_transfer_request.xml": {"CancelTransfer", func(b *BodyEncoder) {
+			b.CancelTransfer = &CancelTransferRequestEncoder{CommandKey: "FirmwareUpgrade"}
+		}},
+		"change_du_state_request.xml": {"ChangeDUState", func(b *BodyEncoder) {
+			b.ChangeDUState = testChangeDUStateRequest()
+		}},
+		"du_state_change_complete_response.xml": {"DUStateChangeCompleteResponse", func(b *BodyEncoder) {
+			b.DUStateChangeCompleteResponse = &EmptyPayload{}
+		}},
+		"autonomous_du_state_change_complete_response.xml": {"AutonomousDUStateChangeCompleteResponse", func(b *BodyEncoder) {
+			b.AutonomousDUStateChangeCompleteResponse = &EmptyPayload{}
+		}},
+
+		// CPE messages
+		"inform_request.xml": {"Inform", func(b *BodyEncoder) {
+			vals := []ParameterValueEncoder{
+				{Name: "Device.DeviceInfo.HardwareVersion", Value: ValueEncoder{Type: XSD(TypeString), Value: "1.0"}},
+				{Name: "Device.DeviceInfo.ProvisioningCode", Value: ValueEncoder{Type: XSD(TypeString), Value: "provisioning.code"}},
+				{Name: "Device.DeviceInfo.SoftwareVersion", Value: ValueEncoder{Type: XSD(TypeString), Value: "G3000E-1.2.3"}},
+				{Name: "Device.ManagementServer.AliasBasedAddressing", Value: ValueEncoder{Type: XSD(TypeBoolean), Value: "1"}},
+				{Name: "Device.ManagementServer.ConnectionRequestURL", Value: ValueEncoder{Type: XSD(TypeString), Value: "http://192.168.1.1:7547/acs"}},
+				{Name: "Device.ManagementServer.ParameterKey", Value: ValueEncoder{Type: XSD(TypeString), Value: "n/a"}},
+				{Name: "Device.RootDataModelVersion", Value: ValueEncoder{Type: XSD(TypeString), Value: "2.11"}},
+				{Name: "Device.X_ACME_WANDetection.PPPUserName", Value: ValueEncoder{Type: XSD(TypeString), Value: "username"}},
+				{Name: "Device.X_ACME_WANDetection.WANIPAddress", Value: ValueEncoder{Type: XSD(TypeString), Value: "192.168.1.1"}},
+				{Name: "Device.X_ACME_WANDetection.WANMACAddress", Value: ValueEncoder{Type: XSD(TypeString), Value: "de:ca:de:11:22:33"}},
+			}
+			b.Inform = &InformRequestEncoder{
+				DeviceId: DeviceID{
+					Manufacturer: "ACME Networks",
+					OUI:          "DECADE",
+					ProductClass: "G3000E",
+					SerialNumber: "G3000E-9799109101",
+				},
+				Event: EventEncoder{
+					ArrayType: ArrayType("cwmp:EventStruct", 1),
+					Events:    []EventStruct{{EventCode: EventBootstrap}},
+				},
+				MaxEnvelopes: MaxEnvelopes,
+				CurrentTime:  "2024-06-10T01:33:00Z",
+				ParameterList: ParameterListEncoder{
+					ArrayType:       ArrayType("cwmp:ParameterValueStruct", len(vals)),
+					ParameterValues: vals,
+				},
+			}
+		}},
+		"transfer_complete_success_request.xml": {"TransferComplete", func(b *BodyEncoder) {
+			b.TransferCompleteRequest = &TransferCompleteRequestEncoder{
+				CommandKey:   "upgrade",
+				Fault:        NoFaultStruct{},
+				StartTime:    "2024-06-10T23:04:00Z",
+				CompleteTime: "2024-06-10T23:05:00Z",
+			}
+		}},
+		"transfer_complete_fault_request.xml": {"TransferComplete", func(b *BodyEncoder) {
+			b.TransferCompleteRequest = &TransferCompleteRequestEncoder{
+				CommandKey:   "upgrade",
+				Fault:        FaultStruct{FaultCode: FaultDownloadFailureContactFileServer, FaultString: "Server Not Found"},
+				StartTime:    "2024-06-10T23:04:00Z",
+				CompleteTime: "2024-06-10T23:05:00Z",
+			}
+		}},
+		"autonomous_transfer_complete_request.xml": {"AutonomousTransferComplete", func(b *BodyEncoder) {
+			b.AutonomousTransferCompleteRequest = &AutonomousTransferCompleteRequestEncoder{
+				AnnounceURL:    "https://acme-networks.com/firmware/downloads",
+				TransferURL:    "https://acme-networks.com/firmware/downloads/firmware.bin",
+				IsDownload:     true,
+				FileType:       FileTypeFirmwareUpgradeImage,
+				FileSize:       184258350,
+				TargetFileName: "firmware.bin",
+				Fault:          NoFaultStruct{},
+				StartTime:      "2024-06-10T23:04:00Z",
+				CompleteTime:   "2024-06-10T23:05:00Z",
+			}
+		}},
+		"request_download_request.xml": {"RequestDownload", func(b *BodyEncoder) {
+			b.RequestDownload = testRequestDownloadRequest()
+		}},
+		"kicked_request.xml": {"Kicked", func(b *BodyEncoder) {
+			b.Kicked = testKickedRequest()
+		}},
+		"get_rpc_methods_response.xml": {"GetRPCMethodsResponse", func(b *BodyEncoder) {
+			methods := []string{
+				"GetRPCMethods", "SetParameterValues", "GetParameterValues", "GetParameterNames",
+				"SetParameterAttributes", "GetParameterAttributes", "AddObject", "DeleteObject",
+				"Download", "Reboot", "ScheduleInform", "FactoryReset",
+			}
+			b.GetRPCMethodsResponse = &GetRPCMethodsResponseEncoder{
+				MethodList: MethodListEncoder{ArrayType: ArrayType(XSD(TypeString), len(methods)), Methods: methods},
+			}
+		}},
+		"set_parameter_values_response.xml": {"SetParameterValuesResponse", func(b *BodyEncoder) {
+			b.SetParameterValuesResponse = &SetParameterValuesResponseEncoder{Status: 1}
+		}},
+		"get_parameter_values_response.xml": {"GetParameterValuesResponse", func(b *BodyEncoder) {
+			b.GetParameterValuesResponse = &GetParameterValuesResponseEncoder{
+				ParameterList: ParameterListEncoder{
+					ArrayType: ArrayType("cwmp:ParameterValueStruct", 1),
+					ParameterValues: []ParameterValueEncoder{
+						{Name: "Device.DeviceInfo.VendorConfigFile.1.Version", Value: ValueEncoder{Type: XSD(TypeString), Value: "0.0"}},
+					},
+				},
+			}
+		}},
+		"get_parameter_names_response.xml": {"GetParameterNamesResponse", func(b *BodyEncoder) {
+			params := []ParameterInfoStruct{
+				{Name: "Device.", Writable: false},
+				{Name: "Device.RootDataModelVersion", Writable: false},
+				{Name: "Device.InterfaceStackNumberOfEntries", Writable: false},
+				{Name: "Device.CaptivePortal.", Writable: false},
+				{Name: "Device.CaptivePortal.Enable", Writable: true},
+			}
+			b.GetParameterNamesResponse = &GetParameterNamesResponseEncoder{
+				ParameterList: ParameterInfoEncoder{ArrayType: ArrayType("cwmp:ParameterInfoStruct", len(params)), Parameters: params},
+			}
+		}},
+		"set_parameter_attributes_response.xml": {"SetParameterAttributesResponse", func(b *BodyEncoder) {
+			b.SetParameterAttributesResponse = &SetParameterAttributesResponseEncoder{}
+		}},
+		"get_parameter_attributes_response.xml": {"GetParameterAttributesResponse", func(b *BodyEncoder) {
+			b.GetParameterAttributesResponse = &GetParameterAttributesResponseEncoder{
+				ParameterList: ParameterAttributeStructEncoder{
+					ArrayType: ArrayType("cwmp:ParameterAttributeStruct", 1),
+					ParameterAttributes: []ParameterAttributeStruct{{
+						Name:         "Device.DeviceSummary",
+						Notification: AttributeNotificationPassive,
+						AccessList:   AccessListEncoder{ArrayType: ArrayType(XSD(TypeString), 1), Values: []string{"Subscriber"}},
+					}},
+				},
+			}
+		}},
+		"add_object_response.xml": {"AddObjectResponse", func(b *BodyEncoder) {
+			b.AddObjectResponse = &AddObjectResponseEncoder{InstanceNumber: 123, Status: 1}
+		}},
+		"delete_object_response.xml": {"DeleteObjectResponse", func(b *BodyEncoder) {
+			b.DeleteObjectResponse = &DeleteObjectResponseEncoder{Status: 1}
+		}},
+		"reboot_response.xml": {"RebootResponse", func(b *BodyEncoder) {
+			b.RebootResponse = &RebootResponseEncoder{}
+		}},
+		"download_response.xml": {"DownloadResponse", func(b *BodyEncoder) {
+			b.DownloadResponse = &DownloadResponseEncoder{
+				Status:       DownloadNotCompleted,
+				StartTime:    "2024-06-10T23:04:00Z",
+				CompleteTime: "2024-06-10T23:05:00Z",
+			}
+		}},
+		"upload_response.xml": {"UploadResponse", func(b *BodyEncoder) {
+			b.UploadResponse = testUploadResponse()
+		}},
+		"factory_reset_response.xml": {"FactoryResetResponse", func(b *BodyEncoder) {
+			b.FactoryResetResponse = &FactoryResetResponseEncoder{}
+		}},
+		"get_queued_transfers_response.xml": {"GetQueuedTransfersResponse", func(b *BodyEncoder) {
+			b.GetQueuedTransfersResponse = testGetQueuedTransfersResponse()
+		}},
+		"get_all_queued_transfers_response.xml": {"GetAllQueuedTransfersResponse", func(b *BodyEncoder) {
+			b.GetAllQueuedTransfersResponse = testGetAllQueuedTransfersResponse()
+		}},
+		"schedule_inform_response.xml": {"ScheduleInformResponse", func(b *BodyEncoder) {
+			b.ScheduleInformResponse = &EmptyPayload{}
+		}},
+		"set_vouchers_response.xml": {"SetVouchersResponse", func(b *BodyEncoder) {
+			b.SetVouchersResponse = &EmptyPayload{}
+		}},
+		"get_options_response.xml": {"GetOptionsResponse", func(b *BodyEncoder) {
+			b.GetOptionsResponse = testGetOptionsResponse()
+		}},
+		"schedule_download_response.xml": {"ScheduleDownloadResponse", func(b *BodyEncoder) {
+			b.ScheduleDownloadResponse = &EmptyPayload{}
+		}},
+		"cancel_transfer_response.xml": {"CancelTransferResponse", func(b *BodyEncoder) {
+			b.CancelTransferResponse = &EmptyPayload{}
+		}},
+		"change_du_state_response.xml": {"ChangeDUStateResponse", func(b *BodyEncoder) {
+			b.ChangeDUStateResponse = &EmptyPayload{}
+		}},
+		"du_state_change_complete_request.xml": {"DUStateChangeComplete", func(b *BodyEncoder) {
+			b.DUStateChangeComplete = testDUStateChangeCompleteRequest()
+		}},
+		"autonomous_du_state_change_complete_request.xml": {"AutonomousDUStateChangeComplete", func(b *BodyEncoder) {
+			b.AutonomousDUStateChangeComplete = testAutonomousDUStateChangeComplete()
+		}},
+		"fault_response.xml": {"Fault", func(b *BodyEncoder) {
+			b.Fault = NewFaultResponse(FaultMethodNotSupported, "Upload method not supported")
+		}},
+		"get_parameter_values_fault_response.xml": {"Fault", func(b *BodyEncoder) {
+			b.Fault = NewFaultResponse(FaultInvalidParameterName, FaultInvalidParameterName.String())
+		}},
+		"fault_set_parameter_values_response.xml": {"Fault", func(b *BodyEncoder) {
+			b.Fault = NewFaultResponse(FaultInvalidArguments, FaultInvalidArguments.String())
+			b.Fault.Detail.Fault.SetParameterValuesFault = []SetParameterValuesFault{
+				{ParameterName: "InternetGatewayDevice.Time.LocalTimeZone", FaultCode: FaultInvalidParameterValue, FaultString: "Not a valid time zone value"},
+				{ParameterName: "InternetGatewayDevice.Time.LocalTimeZoneName", FaultCode: FaultInvalidParameterValue, FaultString: "String too long"},
+			}
+		}},
+	}
+
+	files, err := filepath.Glob("test_data/*.xml")
+	require.NoError(t, err)
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			tt, ok := tests[name]
+			require.True(t, ok, "no round trip test for %s", name)
+
+			golden, err := os.ReadFile(file)
+			require.NoError(t, err)
+			exp, err := Decode(golden)
+			require.NoError(t, err)
+			assert.Equal(t, tt.method, exp.Method())
+
+			env := NewEnvelope("123")
+			tt.build(&env.Body)
+			b, err := env.EncodePretty()
+			require.NoError(t, err)
+			act, err := Decode(b)
+			require.NoError(t, err)
+			assert.Equal(t, exp, act)
+		})
+	}
+}
+
+func testParameterNames(names ...string) ParameterNamesEncoder {
+	return ParameterNamesEncoder{ArrayType: ArrayType(XSD(TypeString), len(names)), Names: names}
+}
+
+func testUploadRequest() *UploadRequestEncoder {
+	return &UploadRequestEncoder{
+		CommandKey:   "backup",
+		FileType:     "3 Vendor Configuration File",
+		URL:          "https://acme-networks.com/uploads/config.xml",
+		Username:     "cpe",
+		Password:     "secret",
+		DelaySeconds: 10,
+	}
+}
+
+func testUploadResponse() *UploadResponseEncoder {
+	return &UploadResponseEncoder{
+		Status:       0,
+		StartTime:    "2024-06-10T23:04:00Z",
+		CompleteTime: "2024-06-10T23:05:00Z",
+	}
+}
+
+func testGetQueuedTransfersResponse() *GetQueuedTransfersResponseEncoder {
+	var r GetQueuedTransfersResponseEncoder
+	r.TransferList.ArrayType = ArrayType("cwmp:QueuedTransferStruct", 1)
+	r.TransferList.Transfers = []QueuedTransferStruct{{CommandKey: "upgrade", State: 2}}
+	return &r
+}
+
+func testGetAllQueuedTransfersResponse() *GetAllQueuedTransfersResponseEncoder {
+	var r GetAllQueuedTransfersResponseEncoder
+	r.TransferList.ArrayType = ArrayType("cwmp:AllQueuedTransferStruct", 1)
+	r.TransferList.Transfers = []AllQueuedTransferStruct{{
+		CommandKey:     "upgrade",
+		State:          2,
+		IsDownload:     true,
+		FileType:       FileTypeFirmwareUpgradeImage,
+		FileSize:       184258350,
+		TargetFileName: "firmware.bin",
+	}}
+	return &r
+}
+
+func testSetVouchersRequest() *SetVouchersRequestEncoder {
+	var r SetVouchersRequestEncoder
+	r.VoucherList.ArrayType = ArrayType("base64", 1)
+	r.VoucherList.Values = []string{"dm91Y2hlcg=="}
+	return &r
+}
+
+func testGetOptionsResponse() *GetOptionsResponseEncoder {
+	var r GetOptionsResponseEncoder
+	r.OptionList.ArrayType = ArrayType("cwmp:OptionStruct", 1)
+	r.OptionList.Options = []OptionStruct{{
+		OptionName:     "X_ACME_Feature",
+		VoucherSN:      "12345",
+		State:          1,
+		Mode:           1,
+		StartDate:      "2024-06-10T00:00:00Z",
+		ExpirationDate: "2025-06-10T00:00:00Z",
+		IsTransferable: false,
+	}}
+	return &r
+}
+
+func testRequestDownloadRequest() *RequestDownloadRequestEncoder {
+	var r RequestDownloadRequestEncoder
+	r.FileType = FileTypeFirmwareUpgradeImage
+	r.FileTypeArg.ArrayType = ArrayType("cwmp:ArgStruct", 1)
+	r.FileTypeArg.Args = []ArgStruct{{Name: "Version", Value: "1.2.4"}}
+	return &r
+}
+
+func testKickedRequest() *KickedRequestEncoder {
+	return &KickedRequestEncoder{
+		Command: "activate",
+		Referer: "https://acme-networks.com/portal",
+		Arg:     "plan=premium",
+		Next:    "https://acme-networks.com/portal/done",
+	}
+}
+
+func testScheduleDownloadRequest() *ScheduleDownloadRequestEncoder {
+	r := ScheduleDownloadRequestEncoder{
+		CommandKey:     "FirmwareUpgrade",
+		FileType:       FileTypeFirmwareUpgradeImage,
+		URL:            "https://acme-networks.com/firmware/downloads/firmware.bin",
+		Username:       "cpe",
+		Password:       "secret",
+		FileSize:       184258350,
+		TargetFileName: "firmware.bin",
+	}
+	r.TimeWindowList.ArrayType = ArrayType("cwmp:TimeWindowStruct", 1)
+	r.TimeWindowList.Windows = []TimeWindowStruct{{
+		WindowStart: 60,
+		WindowEnd:   3600,
+		WindowMode:  "1 At Any Time",
+		MaxRetries:  3,
+	}}
+	return &r
+}
+
+func testChangeDUStateRequest() *ChangeDUStateRequestEncoder {
+	var r ChangeDUStateRequestEncoder
+	r.Operations.ArrayType = ArrayType("cwmp:OperationStruct", 2)
+	r.Operations.Operations = []OperationStructEncoder{
+		{
+			Type:            OperationInstall,
+			URL:             "https://acme-networks.com/modules/speedtest.ipk",
+			UUID:            "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+			Username:        "cpe",
+			Password:        "secret",
+			ExecutionEnvRef: "Device.SoftwareModules.ExecEnv.1",
+		},
+		{
+			Type:            OperationUninstall,
+			UUID:            "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+			Version:         "1.0",
+			ExecutionEnvRef: "Device.SoftwareModules.ExecEnv.1",
+		},
+	}
+	r.CommandKey = "modules"
+	return &r
+}
+
+func testDUStateChangeCompleteRequest() *DUStateChangeCompleteRequestEncoder {
+	var r DUStateChangeCompleteRequestEncoder
+	r.Results.ArrayType = ArrayType("cwmp:OpResultStruct", 1)
+	r.Results.Results = []OpResultStruct{{
+		UUID:                 "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		DeploymentUnitRef:    "Device.SoftwareModules.DeploymentUnit.1",
+		Version:              "1.0",
+		CurrentState:         "Installed",
+		Resolved:             true,
+		ExecutionUnitRefList: "Device.SoftwareModules.ExecutionUnit.1",
+		StartTime:            "2024-06-10T23:04:00Z",
+		CompleteTime:         "2024-06-10T23:05:00Z",
+	}}
+	r.CommandKey = "modules"
+	return &r
+}
+
+func testAutonomousDUStateChangeComplete() *AutonomousDUStateChangeCompleteEncoder {
+	var r AutonomousDUStateChangeCompleteEncoder
+	r.Results.ArrayType = ArrayType("cwmp:AutonOpResultStruct", 1)
+	r.Results.Results = []AutonOpResultStruct{{
+		UUID:                 "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		DeploymentUnitRef:    "Device.SoftwareModules.DeploymentUnit.1",
+		Version:              "1.1",
+		CurrentState:         "Installed",
+		Resolved:             true,
+		ExecutionUnitRefList: "Device.SoftwareModules.ExecutionUnit.1",
+		StartTime:            "2024-06-10T23:04:00Z",
+		CompleteTime:         "2024-06-10T23:05:00Z",
+		OperationPerformed:   "Update",
+	}}
+	return &r
+}
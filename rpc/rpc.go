@@ -2,7 +2,9 @@
 package rpc
 
 import (
+	"encoding/xml"
 	"fmt"
+	"regexp"
 )
 
 type (
@@ -30,12 +32,21 @@ const (
 	EventReboot                     = "M Reboot"
 	EventScheduleInform             = "M ScheduleInform"
 	EventDownload                   = "M Download"
+	EventScheduleDownload           = "M ScheduleDownload"
 	EventUpload                     = "M Upload"
+	EventChangeDUState              = "M ChangeDUState"
+
+	EventDUStateChangeComplete           = "11 DU STATE CHANGE COMPLETE"
+	EventAutonomousDUStateChangeComplete = "12 AUTONOMOUS DU STATE CHANGE COMPLETE"
 
 	FileTypeFirmwareUpgradeImage    = "1 Firmware Upgrade Image"
 	FileTypeWebContent              = "2 Web Content"
 	FileTypeVendorConfigurationFile = "3 Vendor Configuration File"
 
+	OperationInstall   = "cwmp:InstallOpStruct"
+	OperationUpdate    = "cwmp:UpdateOpStruct"
+	OperationUninstall = "cwmp:UninstallOpStruct"
+
 	// AttributeNotificationOff indicates that the CPE need not inform the ACS
 	// of a change to the specified parameter(s).
 	AttributeNotificationOff AttributeNotification = 0
@@ -78,6 +89,34 @@ type DeviceID struct {
 	SerialNumber string
 }
 
+// RawMessage is a message that is not defined by CWMP, such as a vendor
+// specific RPC. When encoding, the element name must include the namespace
+// prefix, e.g. cwmp:X_DECADE_SpeedTestResponse.
+type RawMessage struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	InnerXML string     `xml:",innerxml"`
+}
+
+// Element returns the XML of the message element.
+func (m RawMessage) Element() ([]byte, error) {
+	b, err := xml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode message: %w", err)
+	}
+	return b, nil
+}
+
+// IsVendorMethod returns true if the name is a valid vendor specific method
+// name, X_<VENDOR>_<Name>, where VENDOR is either an OUI of six upper case
+// hexadecimal digits or an upper case domain name with dots replaced by
+// hyphens, e.g. X_EXAMPLE-COM_SpeedTest.
+func IsVendorMethod(name string) bool {
+	return vendorMethodRegex.MatchString(name)
+}
+
+var vendorMethodRegex = regexp.MustCompile(`^X_([0-9A-F]{6}|[0-9A-Z]+(-[0-9A-Z]+)+)_[A-Za-z]\w*$`)
+
 type ParameterAttribute struct {
 	Name               string
 	NotificationChange bool
@@ -0,0 +1,283 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnknownTime is the dateTime value used for unknown times.
+const UnknownTime = "0001-01-01T00:00:00Z"
+
+// ValueError is returned when a parameter value doesn't match the requested
+// type or can't be parsed.
+type ValueError struct {
+	Code  FaultCode
+	Name  string
+	Type  string
+	Value string
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s: invalid %s value %q: %v", e.Name, e.Type, e.Value, e.Err)
+	}
+	return fmt.Sprintf("invalid %s value %q: %v", e.Type, e.Value, e.Err)
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// FaultCodeOf returns the fault code of a value error, which is either
+// FaultInvalidParameterType or FaultInvalidParameterValue.
+func FaultCodeOf(err error) (FaultCode, bool) {
+	var verr *ValueError
+	if errors.As(err, &verr) {
+		return verr.Code, true
+	}
+	return 0, false
+}
+
+//
+// Decoding
+//
+
+// Int returns the value of an int parameter.
+func (v ParameterValueDecoder) Int() (int32, error) {
+	if err := v.checkType(TypeInt); err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(v.Value.Value), 10, 32)
+	if err != nil {
+		return 0, v.valueError(TypeInt, err)
+	}
+	return int32(i), nil
+}
+
+// UnsignedInt returns the value of an unsignedInt parameter.
+func (v ParameterValueDecoder) UnsignedInt() (uint32, error) {
+	if err := v.checkType(TypeUnsignedInt); err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseUint(strings.TrimSpace(v.Value.Value), 10, 32)
+	if err != nil {
+		return 0, v.valueError(TypeUnsignedInt, err)
+	}
+	return uint32(i), nil
+}
+
+// Long returns the value of a long parameter.
+func (v ParameterValueDecoder) Long() (int64, error) {
+	if err := v.checkType(TypeLong); err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(v.Value.Value), 10, 64)
+	if err != nil {
+		return 0, v.valueError(TypeLong, err)
+	}
+	return i, nil
+}
+
+// UnsignedLong returns the value of an unsignedLong parameter.
+func (v ParameterValueDecoder) UnsignedLong() (uint64, error) {
+	if err := v.checkType(TypeUnsignedLong); err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseUint(strings.TrimSpace(v.Value.Value), 10, 64)
+	if err != nil {
+		return 0, v.valueError(TypeUnsignedLong, err)
+	}
+	return i, nil
+}
+
+// Bool returns the value of a boolean parameter. Both "0"/"1" and
+// "false"/"true" are accepted.
+func (v ParameterValueDecoder) Bool() (bool, error) {
+	if err := v.checkType(TypeBoolean); err != nil {
+		return false, err
+	}
+	b, err := parseBool(v.Value.Value)
+	if err != nil {
+		return false, v.valueError(TypeBoolean, err)
+	}
+	return b, nil
+}
+
+// DateTime returns the value of a dateTime parameter. Unknown time is
+// returned as a zero time. Values without a time zone are assumed to be in
+// UTC.
+func (v ParameterValueDecoder) DateTime() (time.Time, error) {
+	if err := v.checkType(TypeDateTime); err != nil {
+		return time.Time{}, err
+	}
+	t, err := parseDateTime(v.Value.Value)
+	if err != nil {
+		return time.Time{}, v.valueError(TypeDateTime, err)
+	}
+	return t, nil
+}
+
+// Base64 returns the decoded value of a base64 parameter.
+func (v ParameterValueDecoder) Base64() ([]byte, error) {
+	if err := v.checkType(TypeBase64, TypeBase64Binary); err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v.Value.Value))
+	if err != nil {
+		return nil, v.valueError(TypeBase64, err)
+	}
+	return b, nil
+}
+
+// HexBinary returns the decoded value of a hexBinary parameter.
+func (v ParameterValueDecoder) HexBinary() ([]byte, error) {
+	if err := v.checkType(TypeHEXBinary); err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(v.Value.Value))
+	if err != nil {
+		return nil, v.valueError(TypeHEXBinary, err)
+	}
+	return b, nil
+}
+
+// Validate checks that the value can be parsed as its declared type. Values
+// of types without a typed accessor are not checked.
+func (v ParameterValueDecoder) Validate() error {
+	var err error
+	switch NoXSD(v.Value.Type) {
+	case TypeInt:
+		_, err = v.Int()
+	case TypeUnsignedInt:
+		_, err = v.UnsignedInt()
+	case TypeLong:
+		_, err = v.Long()
+	case TypeUnsignedLong:
+		_, err = v.UnsignedLong()
+	case TypeBoolean:
+		_, err = v.Bool()
+	case TypeDateTime:
+		_, err = v.DateTime()
+	case TypeBase64, TypeBase64Binary:
+		_, err = v.Base64()
+	case TypeHEXBinary:
+		_, err = v.HexBinary()
+	}
+	return err
+}
+
+// checkType returns an error if the value has a type different from any of
+// the given ones. Untyped values are accepted.
+func (v ParameterValueDecoder) checkType(types ...string) error {
+	typ := NoXSD(v.Value.Type)
+	if typ == "" {
+		return nil
+	}
+	for _, t := range types {
+		if typ == t {
+			return nil
+		}
+	}
+	return &ValueError{
+		Code:  FaultInvalidParameterType,
+		Name:  v.Name,
+		Type:  types[0],
+		Value: v.Value.Value,
+		Err:   fmt.Errorf("unexpected type %s", v.Value.Type),
+	}
+}
+
+func (v ParameterValueDecoder) valueError(typ string, err error) error {
+	return &ValueError{
+		Code:  FaultInvalidParameterValue,
+		Name:  v.Name,
+		Type:  typ,
+		Value: v.Value.Value,
+		Err:   err,
+	}
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "1", "true":
+		return true, nil
+	case "0", "false":
+		return false, nil
+	default:
+		return false, errors.New("expected 0, 1, true or false")
+	}
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == UnknownTime {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02T15:04:05.999999999", s)
+	if err != nil {
+		return time.Time{}, errors.New("expected ISO 8601 date and time")
+	}
+	return t, nil
+}
+
+//
+// Encoding
+//
+
+// StringValue returns a string value.
+func StringValue(s string) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeString), Value: s}
+}
+
+// IntValue returns an int value.
+func IntValue(i int32) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeInt), Value: strconv.FormatInt(int64(i), 10)}
+}
+
+// UnsignedIntValue returns an unsignedInt value.
+func UnsignedIntValue(i uint32) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeUnsignedInt), Value: strconv.FormatUint(uint64(i), 10)}
+}
+
+// LongValue returns a long value.
+func LongValue(i int64) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeLong), Value: strconv.FormatInt(i, 10)}
+}
+
+// UnsignedLongValue returns an unsignedLong value.
+func UnsignedLongValue(i uint64) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeUnsignedLong), Value: strconv.FormatUint(i, 10)}
+}
+
+// BoolValue returns a boolean value in its canonical form.
+func BoolValue(b bool) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeBoolean), Value: strconv.FormatBool(b)}
+}
+
+// DateTimeValue returns a dateTime value in UTC. Zero time is encoded as
+// unknown time.
+func DateTimeValue(t time.Time) ValueEncoder {
+	if t.IsZero() {
+		return ValueEncoder{Type: XSD(TypeDateTime), Value: UnknownTime}
+	}
+	return ValueEncoder{Type: XSD(TypeDateTime), Value: t.UTC().Format(time.RFC3339Nano)}
+}
+
+// Base64Value returns a base64 value.
+func Base64Value(b []byte) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeBase64), Value: base64.StdEncoding.EncodeToString(b)}
+}
+
+// HexBinaryValue returns a hexBinary value in its canonical upper case form.
+func HexBinaryValue(b []byte) ValueEncoder {
+	return ValueEncoder{Type: XSD(TypeHEXBinary), Value: strings.ToUpper(hex.EncodeToString(b))}
+}
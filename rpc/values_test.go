@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueAccessors(t *testing.T) {
+	val := func(typ, v string) ParameterValueDecoder {
+		var p ParameterValueDecoder
+		p.Name = "Device.Test"
+		p.Value.Type = typ
+		p.Value.Value = v
+		return p
+	}
+
+	i, err := val("xsd:int", "-42").Int()
+	require.NoError(t, err)
+	assert.Equal(t, int32(-42), i)
+	u, err := val("xsd:unsignedInt", "4294967295").UnsignedInt()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4294967295), u)
+	l, err := val("xsd:long", "-9223372036854775808").Long()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-9223372036854775808), l)
+	ul, err := val("", "18446744073709551615").UnsignedLong()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(18446744073709551615), ul)
+
+	for in, exp := range map[string]bool{"1": true, "true": true, "0": false, "false": false} {
+		b, err := val("xsd:boolean", in).Bool()
+		require.NoError(t, err)
+		assert.Equal(t, exp, b, in)
+	}
+
+	ts, err := val("xsd:dateTime", "2024-06-10T23:04:00+02:00").DateTime()
+	require.NoError(t, err)
+	assert.True(t, time.Date(2024, 6, 10, 21, 4, 0, 0, time.UTC).Equal(ts))
+	ts, err = val("xsd:dateTime", "2024-06-10T23:04:00").DateTime()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 10, 23, 4, 0, 0, time.UTC), ts)
+	ts, err = val("xsd:dateTime", UnknownTime).DateTime()
+	require.NoError(t, err)
+	assert.True(t, ts.IsZero())
+
+	b, err := val("xsd:base64", "aGVsbG8=").Base64()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), b)
+	b, err = val("xsd:hexBinary", "DECADE").HexBinary()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xde, 0xca, 0xde}, b)
+}
+
+func TestValueErrors(t *testing.T) {
+	tests := []struct {
+		typ, val string
+		read     func(v ParameterValueDecoder) error
+		code     FaultCode
+	}{
+		{"xsd:string", "1", func(v ParameterValueDecoder) error { _, err := v.Int(); return err }, FaultInvalidParameterType},
+		{"xsd:int", "2147483648", func(v ParameterValueDecoder) error { _, err := v.Int(); return err }, FaultInvalidParameterValue},
+		{"xsd:unsignedInt", "-1", func(v ParameterValueDecoder) error { _, err := v.UnsignedInt(); return err }, FaultInvalidParameterValue},
+		{"xsd:boolean", "yes", func(v ParameterValueDecoder) error { _, err := v.Bool(); return err }, FaultInvalidParameterValue},
+		{"xsd:dateTime", "yesterday", func(v ParameterValueDecoder) error { _, err := v.DateTime(); return err }, FaultInvalidParameterValue},
+		{"xsd:base64", "not base64!", func(v ParameterValueDecoder) error { _, err := v.Base64(); return err }, FaultInvalidParameterValue},
+		{"xsd:hexBinary", "XYZ", func(v ParameterValueDecoder) error { _, err := v.HexBinary(); return err }, FaultInvalidParameterValue},
+		{"xsd:boolean", "2", func(v ParameterValueDecoder) error { return v.Validate() }, FaultInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+"/"+tt.val, func(t *testing.T) {
+			var v ParameterValueDecoder
+			v.Value.Type = tt.typ
+			v.Value.Value = tt.val
+			err := tt.read(v)
+			require.Error(t, err)
+			code, ok := FaultCodeOf(err)
+			require.True(t, ok)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestValueConstructors(t *testing.T) {
+	assert.Equal(t, ValueEncoder{Type: "xsd:string", Value: "foo"}, StringValue("foo"))
+	assert.Equal(t, ValueEncoder{Type: "xsd:int", Value: "-1"}, IntValue(-1))
+	assert.Equal(t, ValueEncoder{Type: "xsd:unsignedInt", Value: "1"}, UnsignedIntValue(1))
+	assert.Equal(t, ValueEncoder{Type: "xsd:long", Value: "-1"}, LongValue(-1))
+	assert.Equal(t, ValueEncoder{Type: "xsd:unsignedLong", Value: "1"}, UnsignedLongValue(1))
+	assert.Equal(t, ValueEncoder{Type: "xsd:boolean", Value: "true"}, BoolValue(true))
+	assert.Equal(t, ValueEncoder{Type: "xsd:dateTime", Value: UnknownTime}, DateTimeValue(time.Time{}))
+	cet := time.FixedZone("CET", 3600)
+	assert.Equal(t, ValueEncoder{Type: "xsd:dateTime", Value: "2024-06-10T22:04:00Z"}, DateTimeValue(time.Date(2024, 6, 10, 23, 4, 0, 0, cet)))
+	assert.Equal(t, ValueEncoder{Type: "xsd:base64", Value: "aGVsbG8="}, Base64Value([]byte("hello")))
+	assert.Equal(t, ValueEncoder{Type: "xsd:hexBinary", Value: "DECADE"}, HexBinaryValue([]byte{0xde, 0xca, 0xde}))
+}
@@ -0,0 +1,169 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/rpc"
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+// ErrNoDevices is returned when no devices match the scenario.
+var ErrNoDevices = errors.New("no matching devices")
+
+// Run runs the scenario against all matching devices concurrently. Each device
+// follows its own timeline. It returns an error if any step fails on any
+// device.
+func (sc *Scenario) Run(ctx context.Context, devices []Device) error {
+	devices = sc.match(devices)
+	if len(devices) == 0 {
+		return ErrNoDevices
+	}
+
+	log.Info("Running scenario", log.F{
+		"name":    sc.Name,
+		"devices": len(devices),
+		"steps":   len(sc.Steps),
+	})
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, len(devices))
+	for i, d := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sc.runDevice(ctx, d, start); err != nil {
+				errs[i] = fmt.Errorf("device %s: %w", d.SerialNumber(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (sc *Scenario) match(devices []Device) []Device {
+	if len(sc.Devices) == 0 {
+		return devices
+	}
+	var res []Device
+	for _, d := range devices {
+		matches := slices.ContainsFunc(sc.Devices, func(pattern string) bool {
+			ok, _ := path.Match(pattern, d.SerialNumber())
+			return ok
+		})
+		if matches {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func (sc *Scenario) runDevice(ctx context.Context, d Device, start time.Time) error {
+	prevStart, prevDone := start, start
+	for i, step := range sc.Steps {
+		at := prevDone.Add(time.Duration(step.After))
+		if step.At != nil {
+			at = start.Add(time.Duration(*step.At))
+		}
+		if err := sleepUntil(ctx, at); err != nil {
+			return err
+		}
+
+		action := step.actions()[0]
+		log.Debug("Running scenario step", log.F{
+			"serial_number": d.SerialNumber(),
+			"step":          i + 1,
+			"action":        action,
+		})
+		stepStart := time.Now()
+		if err := step.run(ctx, d, prevStart); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, action, err)
+		}
+		prevStart, prevDone = stepStart, time.Now()
+	}
+	return nil
+}
+
+func (s Step) run(ctx context.Context, d Device, since time.Time) error {
+	switch {
+	case len(s.Set) > 0:
+		for path, val := range s.Set {
+			d.SetParameterValue(path, val)
+		}
+	case s.Offline > 0:
+		d.GoOffline(time.Duration(s.Offline))
+	case s.Reboot:
+		d.Reboot(ctx)
+	case s.FactoryReset:
+		d.FactoryReset(ctx)
+	case len(s.Inform) > 0:
+		return triggerInform(d, s.Inform...)
+	case s.ConnectionRequest:
+		return triggerInform(d, rpc.EventConnectionRequest)
+	case s.Fault != nil:
+		d.InjectFault(s.Fault.Method, s.Fault.Code)
+	case len(s.Chaos) > 0:
+		var errs []error
+		for kind, p := range s.Chaos {
+			errs = append(errs, d.SetChaos(kind, p))
+		}
+		return errors.Join(errs...)
+	case s.WaitForRPC != nil:
+		if s.WaitForRPC.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(s.WaitForRPC.Timeout))
+			defer cancel()
+		}
+		if err := d.WaitForRPC(ctx, s.WaitForRPC.Method, since); err != nil {
+			return fmt.Errorf("wait for %s: %w", s.WaitForRPC.Method, err)
+		}
+	case len(s.Assert) > 0:
+		var errs []error
+		for path, exp := range s.Assert {
+			val, ok := d.ParameterValue(path)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: parameter not found", path))
+			} else if val != exp {
+				errs = append(errs, fmt.Errorf("%s: expected %q, got %q", path, exp, val))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// triggerInform requests an inform. Events of an inform that can't be
+// started right away are added to a pending session, which is not an error.
+func triggerInform(d Device, events ...string) error {
+	err := d.TriggerInform(events...)
+	if errors.Is(err, simulator.ErrInformPending) {
+		log.Info("Inform events are pending", log.F{
+			"serial_number": d.SerialNumber(),
+			"events":        events,
+		})
+		return nil
+	}
+	return err
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	delay := time.Until(t)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
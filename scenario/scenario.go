@@ -0,0 +1,183 @@
+// Package scenario implements scripted timelines of device events. Scenarios
+// are defined in YAML or JSON files and are run against one or more simulated
+// devices.
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// Device is a simulated device that scenarios are run against.
+type Device interface {
+	SerialNumber() string
+	SetParameterValue(path, value string)
+	ParameterValue(path string) (string, bool)
+	TriggerInform(events ...string) error
+	GoOffline(dur time.Duration)
+	Reboot(ctx context.Context)
+	FactoryReset(ctx context.Context)
+	InjectFault(method string, code rpc.FaultCode)
+	SetChaos(kind string, probability float64) error
+	WaitForRPC(ctx context.Context, method string, since time.Time) error
+}
+
+// Scenario is a list of timed steps.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Devices is a list of serial number patterns, as defined by path.Match,
+	// of devices the scenario is run against. If the list is empty the
+	// scenario is run against all devices.
+	Devices []string `yaml:"devices"`
+	Steps   []Step   `yaml:"steps"`
+}
+
+// Step is a single scenario action. Each step must define exactly one action.
+type Step struct {
+	// At is the time offset from the start of the scenario when the step
+	// is executed.
+	At *Duration `yaml:"at"`
+	// After is the delay after the previous step is completed.
+	After Duration `yaml:"after"`
+
+	// Set changes datamodel parameter values.
+	Set map[string]string `yaml:"set"`
+	// Offline makes the device unreachable for the given time.
+	Offline Duration `yaml:"offline"`
+	// Reboot makes the device reboot.
+	Reboot bool `yaml:"reboot"`
+	// FactoryReset makes the device reset to factory defaults.
+	FactoryReset bool `yaml:"factory_reset"`
+	// Inform makes the device inform with the given events.
+	Inform []string `yaml:"inform"`
+	// ConnectionRequest makes the device inform as if it has received a
+	// connection request.
+	ConnectionRequest bool `yaml:"connection_request"`
+	// Fault makes the device respond with a fault to the next ACS request of
+	// the given method.
+	Fault *Fault `yaml:"fault"`
+	// Chaos changes probabilities of transport-level misbehavior, e.g.
+	// drop_connection or malformed_xml.
+	Chaos map[string]float64 `yaml:"chaos"`
+	// WaitForRPC waits for an ACS request of the given method. Requests
+	// received since the start of the previous step are taken into account.
+	WaitForRPC *WaitForRPC `yaml:"wait_for_rpc"`
+	// Assert checks datamodel parameter values.
+	Assert map[string]string `yaml:"assert"`
+}
+
+// Fault describes a fault injected into the response to an ACS request.
+type Fault struct {
+	Method string        `yaml:"method"`
+	Code   rpc.FaultCode `yaml:"code"`
+}
+
+// WaitForRPC describes an ACS request to wait for.
+type WaitForRPC struct {
+	Method string `yaml:"method"`
+	// Timeout is the maximum time to wait, no timeout if not set.
+	Timeout Duration `yaml:"timeout"`
+}
+
+// Duration is a time.Duration that is defined as a string, e.g. 1m30s.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var str string
+	if err := node.Decode(&str); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// Load loads a scenario from a YAML or JSON file.
+func Load(path string) (*Scenario, error) {
+	// Assume the file is trusted
+	//nolint:gosec
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario file: %w", err)
+	}
+	return Parse(b)
+}
+
+// Parse parses a scenario defined in YAML or JSON.
+func Parse(b []byte) (*Scenario, error) {
+	var sc Scenario
+	// JSON is a subset of YAML
+	if err := yaml.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("parse scenario: %w", err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Validate checks the scenario for errors.
+func (sc *Scenario) Validate() error {
+	if len(sc.Steps) == 0 {
+		return errors.New("scenario has no steps")
+	}
+	for i, step := range sc.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s Step) validate() error {
+	if s.At != nil && s.After != 0 {
+		return errors.New("at and after can't be used together")
+	}
+	if n := len(s.actions()); n != 1 {
+		return fmt.Errorf("step must define exactly one action, got %d", n)
+	}
+	if s.Fault != nil && (s.Fault.Method == "" || s.Fault.Code == 0) {
+		return errors.New("fault method and code are required")
+	}
+	for kind, p := range s.Chaos {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("chaos %s probability must be between 0 and 1", kind)
+		}
+	}
+	if s.WaitForRPC != nil && s.WaitForRPC.Method == "" {
+		return errors.New("wait_for_rpc method is required")
+	}
+	return nil
+}
+
+// actions returns the names of all actions defined in the step.
+func (s Step) actions() []string {
+	var names []string
+	add := func(name string, ok bool) {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	add("set", len(s.Set) > 0)
+	add("offline", s.Offline > 0)
+	add("reboot", s.Reboot)
+	add("factory_reset", s.FactoryReset)
+	add("inform", len(s.Inform) > 0)
+	add("connection_request", s.ConnectionRequest)
+	add("fault", s.Fault != nil)
+	add("chaos", len(s.Chaos) > 0)
+	add("wait_for_rpc", s.WaitForRPC != nil)
+	add("assert", len(s.Assert) > 0)
+	return names
+}
@@ -0,0 +1,231 @@
+package scenario
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+type fakeDevice struct {
+	serial string
+	params map[string]string
+	faults map[string]rpc.FaultCode
+	rpcs   map[string]time.Time
+	// informErr is returned by TriggerInform
+	informErr error
+	calls     []string
+	lock      sync.Mutex
+}
+
+func newFakeDevice(serial string) *fakeDevice {
+	return &fakeDevice{
+		serial: serial,
+		params: map[string]string{},
+		faults: map[string]rpc.FaultCode{},
+		rpcs:   map[string]time.Time{},
+	}
+}
+
+func (d *fakeDevice) SerialNumber() string { return d.serial }
+
+func (d *fakeDevice) SetParameterValue(path, value string) {
+	d.record("set " + path)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.params[path] = value
+}
+
+func (d *fakeDevice) ParameterValue(path string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	val, ok := d.params[path]
+	return val, ok
+}
+
+func (d *fakeDevice) TriggerInform(events ...string) error {
+	d.record("inform")
+	// Pretend the ACS has responded to the inform
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.rpcs["InformResponse"] = time.Now()
+	return d.informErr
+}
+
+func (d *fakeDevice) GoOffline(time.Duration)      { d.record("offline") }
+func (d *fakeDevice) Reboot(context.Context)       { d.record("reboot") }
+func (d *fakeDevice) FactoryReset(context.Context) { d.record("factory_reset") }
+func (d *fakeDevice) InjectFault(m string, c rpc.FaultCode) {
+	d.record("fault " + m)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.faults[m] = c
+}
+
+func (d *fakeDevice) SetChaos(kind string, _ float64) error {
+	d.record("chaos " + kind)
+	return nil
+}
+
+func (d *fakeDevice) WaitForRPC(ctx context.Context, method string, since time.Time) error {
+	d.record("wait " + method)
+	for {
+		d.lock.Lock()
+		last := d.rpcs[method]
+		d.lock.Unlock()
+		if !last.IsZero() && !last.Before(since) {
+			return nil
+		}
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *fakeDevice) record(call string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.calls = append(d.calls, call)
+}
+
+const testScenario = `
+name: reboot
+devices: ["ABC*"]
+steps:
+  - set:
+      Device.DeviceInfo.SoftwareVersion: "2.0"
+  - after: 10ms
+    fault:
+      method: SetParameterValues
+      code: 9002
+  - chaos:
+      skip_empty_post: 0.5
+  - connection_request: true
+  - wait_for_rpc:
+      method: InformResponse
+      timeout: 1s
+  - at: 50ms
+    reboot: true
+  - assert:
+      Device.DeviceInfo.SoftwareVersion: "2.0"
+`
+
+func TestParse(t *testing.T) {
+	sc, err := Parse([]byte(testScenario))
+	require.NoError(t, err)
+	assert.Equal(t, "reboot", sc.Name)
+	assert.Equal(t, []string{"ABC*"}, sc.Devices)
+	require.Len(t, sc.Steps, 7)
+	assert.Equal(t, Duration(10*time.Millisecond), sc.Steps[1].After)
+	assert.Equal(t, &Fault{Method: "SetParameterValues", Code: rpc.FaultInternalError}, sc.Steps[1].Fault)
+	assert.Equal(t, map[string]float64{"skip_empty_post": 0.5}, sc.Steps[2].Chaos)
+	assert.Equal(t, Duration(time.Second), sc.Steps[4].WaitForRPC.Timeout)
+	require.NotNil(t, sc.Steps[5].At)
+	assert.Equal(t, Duration(50*time.Millisecond), *sc.Steps[5].At)
+}
+
+func TestParseJSON(t *testing.T) {
+	sc, err := Parse([]byte(`{"steps": [{"at": "1s", "offline": "2m"}]}`))
+	require.NoError(t, err)
+	require.Len(t, sc.Steps, 1)
+	assert.Equal(t, Duration(2*time.Minute), sc.Steps[0].Offline)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"no steps":       `name: empty`,
+		"no action":      `steps: [{after: 1s}]`,
+		"two actions":    `steps: [{reboot: true, factory_reset: true}]`,
+		"at and after":   `steps: [{at: 1s, after: 1s, reboot: true}]`,
+		"bad duration":   `steps: [{offline: forever}]`,
+		"fault no code":  `steps: [{fault: {method: Reboot}}]`,
+		"wait no method": `steps: [{wait_for_rpc: {timeout: 1s}}]`,
+		"chaos too high": `steps: [{chaos: {drop_connection: 2}}]`,
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(src))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	sc, err := Parse([]byte(testScenario))
+	require.NoError(t, err)
+
+	d1 := newFakeDevice("ABC001")
+	d2 := newFakeDevice("ABC002")
+	other := newFakeDevice("XYZ001")
+	start := time.Now()
+	require.NoError(t, sc.Run(t.Context(), []Device{d1, d2, other}))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	exp := []string{
+		"set Device.DeviceInfo.SoftwareVersion",
+		"fault SetParameterValues",
+		"chaos skip_empty_post",
+		"inform",
+		"wait InformResponse",
+		"reboot",
+	}
+	assert.Equal(t, exp, d1.calls)
+	assert.Equal(t, exp, d2.calls)
+	assert.Empty(t, other.calls)
+	assert.Equal(t, rpc.FaultInternalError, d1.faults["SetParameterValues"])
+}
+
+func TestRunAssertFailure(t *testing.T) {
+	sc, err := Parse([]byte(`
+steps:
+  - assert:
+      Device.DeviceInfo.SoftwareVersion: "2.0"
+      Device.DeviceInfo.HardwareVersion: "1.0"
+`))
+	require.NoError(t, err)
+
+	d := newFakeDevice("ABC001")
+	d.params["Device.DeviceInfo.SoftwareVersion"] = "1.0"
+	err = sc.Run(t.Context(), []Device{d})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `Device.DeviceInfo.SoftwareVersion: expected "2.0", got "1.0"`)
+	assert.Contains(t, err.Error(), "Device.DeviceInfo.HardwareVersion: parameter not found")
+}
+
+func TestRunWaitTimeout(t *testing.T) {
+	sc, err := Parse([]byte(`steps: [{wait_for_rpc: {method: Reboot, timeout: 10ms}}]`))
+	require.NoError(t, err)
+	err = sc.Run(t.Context(), []Device{newFakeDevice("ABC001")})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRunNoDevices(t *testing.T) {
+	sc, err := Parse([]byte(`{"devices": ["ABC*"], "steps": [{"reboot": true}]}`))
+	require.NoError(t, err)
+	err = sc.Run(t.Context(), []Device{newFakeDevice("XYZ001")})
+	assert.ErrorIs(t, err, ErrNoDevices)
+}
+
+func TestRunInformErrors(t *testing.T) {
+	sc, err := Parse([]byte(`steps: [{inform: ["6 CONNECTION REQUEST"]}, {reboot: true}]`))
+	require.NoError(t, err)
+
+	// Pending events are added to the next session, the timeline goes on
+	d := newFakeDevice("ABC001")
+	d.informErr = simulator.ErrInformPending
+	require.NoError(t, sc.Run(t.Context(), []Device{d}))
+	assert.Equal(t, []string{"inform", "reboot"}, d.calls)
+
+	d = newFakeDevice("ABC001")
+	d.informErr = simulator.ErrNotRunning
+	require.ErrorIs(t, sc.Run(t.Context(), []Device{d}), simulator.ErrNotRunning)
+	assert.Equal(t, []string{"inform"}, d.calls)
+}
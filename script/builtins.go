@@ -0,0 +1,214 @@
+package script
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/localhots/blip/noctx/log"
+	"go.starlark.net/starlark"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// Thread local keys.
+const (
+	localScript = "script"
+	localRun    = "run"
+)
+
+// builtins are functions available to scripts in addition to the Starlark
+// universe.
+var builtins = starlark.StringDict{
+	"on_change": starlark.NewBuiltin("on_change", onChange),
+	"get":       starlark.NewBuiltin("get", get),
+	"set":       starlark.NewBuiltin("set", set),
+	"delete":    starlark.NewBuiltin("delete", deleteObject),
+	"instances": starlark.NewBuiltin("instances", instances),
+	"emit":      starlark.NewBuiltin("emit", emit),
+}
+
+// onChange registers a function that is called when a matching parameter is
+// changed. It can only be called from the top-level code of a script.
+func onChange(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	sc, ok := thread.Local(localScript).(*Script)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be called at the top level", b.Name())
+	}
+	var pattern string
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "fn", &fn); err != nil {
+		return nil, err
+	}
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	sc.rules = append(sc.rules, rule{pattern: segments, fn: fn})
+	return starlark.None, nil
+}
+
+// get returns the value of a parameter, or the default if the parameter
+// doesn't exist.
+func get(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	r, err := runOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	var def starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "default?", &def); err != nil {
+		return nil, err
+	}
+	p, ok := r.sim.DataModel().GetValue(path)
+	if !ok {
+		return def, nil
+	}
+	return toValue(p), nil
+}
+
+// set changes the value of a parameter. Changes trigger rules in the same way
+// changes made by the ACS do.
+func set(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	r, err := runOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	var val starlark.Value
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "value", &val); err != nil {
+		return nil, err
+	}
+	str, err := fromValue(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	r.set(path, str)
+	return starlark.None, nil
+}
+
+// deleteObject deletes an object with all its parameters.
+func deleteObject(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	r, err := runOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	r.sim.DeleteParameter(path)
+	return starlark.None, nil
+}
+
+// instances returns sorted instance numbers of a multi-instance object, e.g.
+// Device.WiFi.SSID.
+func instances(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	r, err := runOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	// Objects are not always present in the datamodel, instance numbers are
+	// taken from the paths of their parameters
+	prefix := strings.TrimSuffix(path, ".") + "."
+	var nums []int
+	for _, p := range r.sim.DataModel().ParameterNames(prefix, false) {
+		name, _, _ := strings.Cut(strings.TrimPrefix(p.Path, prefix), ".")
+		if n, err := strconv.Atoi(name); err == nil && !slices.Contains(nums, n) {
+			nums = append(nums, n)
+		}
+	}
+	slices.Sort(nums)
+	list := make([]starlark.Value, 0, len(nums))
+	for _, n := range nums {
+		list = append(list, starlark.MakeInt(n))
+	}
+	return starlark.NewList(list), nil
+}
+
+// emit queues an event for the next Inform message.
+func emit(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	r, err := runOf(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	var event string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "event", &event); err != nil {
+		return nil, err
+	}
+	r.sim.QueueEvent(event)
+	return starlark.None, nil
+}
+
+func runOf(thread *starlark.Thread, b *starlark.Builtin) (*run, error) {
+	r, ok := thread.Local(localRun).(*run)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be called from a rule", b.Name())
+	}
+	return r, nil
+}
+
+func printFn(thread *starlark.Thread, msg string) {
+	fields := log.F{"script": thread.Name}
+	if r, ok := thread.Local(localRun).(*run); ok {
+		fields["serial_number"] = r.sim.SerialNumber()
+		r.sim.Logger().Info(r.ctx, msg, fields)
+		return
+	}
+	log.Info(msg, fields)
+}
+
+// toValue converts a parameter value into a Starlark value according to the
+// parameter type. Booleans and integers are converted into their Starlark
+// counterparts, other values and values that can't be parsed are returned as
+// strings.
+func toValue(p datamodel.Parameter) starlark.Value {
+	v := rpc.ParameterValueDecoder{Name: p.Path}
+	v.Value.Type = p.Type
+	v.Value.Value = p.GetValue()
+	switch rpc.NoXSD(p.Type) {
+	case rpc.TypeBoolean:
+		if b, err := v.Bool(); err == nil {
+			return starlark.Bool(b)
+		}
+	case rpc.TypeInt:
+		if i, err := v.Int(); err == nil {
+			return starlark.MakeInt64(int64(i))
+		}
+	case rpc.TypeLong:
+		if i, err := v.Long(); err == nil {
+			return starlark.MakeInt64(i)
+		}
+	case rpc.TypeUnsignedInt:
+		if i, err := v.UnsignedInt(); err == nil {
+			return starlark.MakeUint64(uint64(i))
+		}
+	case rpc.TypeUnsignedLong:
+		if i, err := v.UnsignedLong(); err == nil {
+			return starlark.MakeUint64(i)
+		}
+	}
+	return starlark.String(v.Value.Value)
+}
+
+// fromValue converts a Starlark value into a parameter value.
+func fromValue(v starlark.Value) (string, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return strconv.FormatBool(bool(v)), nil
+	case starlark.Int:
+		return v.String(), nil
+	case starlark.Float:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %s", v.Type())
+	}
+}
@@ -0,0 +1,120 @@
+package script
+
+import (
+	"context"
+
+	"github.com/localhots/blip/noctx/log"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+const (
+	// maxChanges limits the number of parameter changes processed in response
+	// to a single write, which stops rules that keep triggering each other.
+	maxChanges = 1000
+	// maxSteps limits the number of computation steps of a single rule call.
+	maxSteps = 1_000_000
+)
+
+// run holds the state of processing a single parameter write.
+type run struct {
+	ctx     context.Context
+	sim     *simulator.Simulator
+	queue   []string
+	changes int
+}
+
+// runKey is a context key of the script run in progress. Writes made by
+// the rules of a script come back to its hook, they are added to the queue of
+// the run instead of starting a new one.
+type runKey struct {
+	sc *Script
+}
+
+// Hooks returns simulator hooks that run the script rules when parameter
+// values are changed by the ACS or using the control API.
+func (sc *Script) Hooks() simulator.Hooks {
+	return simulator.Hooks{ParameterWrite: sc.handleWrite}
+}
+
+func (sc *Script) handleWrite(ctx context.Context, s *simulator.Simulator, params []datamodel.Parameter) {
+	if len(sc.rules) == 0 {
+		return
+	}
+	key := runKey{sc: sc}
+	if r, ok := ctx.Value(key).(*run); ok && r.sim == s {
+		for _, p := range params {
+			r.queue = append(r.queue, p.Path)
+		}
+		return
+	}
+
+	r := &run{sim: s}
+	r.ctx = context.WithValue(ctx, key, r)
+	for _, p := range params {
+		r.queue = append(r.queue, p.Path)
+	}
+	for len(r.queue) > 0 {
+		path := r.queue[0]
+		r.queue = r.queue[1:]
+		if r.changes++; r.changes > maxChanges {
+			s.Logger().Warn(ctx, "Too many changes made by script rules", log.F{
+				"script":        sc.name,
+				"serial_number": s.SerialNumber(),
+				"parameter":     path,
+			})
+			return
+		}
+		for _, rl := range sc.rules {
+			wildcards, ok := rl.match(path)
+			if !ok {
+				continue
+			}
+			if err := sc.call(r, rl, path, wildcards); err != nil {
+				s.Logger().Warn(ctx, "Script rule failed", log.Cause(err), log.F{
+					"script":        sc.name,
+					"serial_number": s.SerialNumber(),
+					"parameter":     path,
+				})
+			}
+		}
+	}
+}
+
+// call calls the rule function with a change struct that has the path and
+// the current value of the changed parameter, and the path segments matched
+// by asterisks.
+func (sc *Script) call(r *run, rl rule, path string, wildcards []string) error {
+	thread := &starlark.Thread{Name: sc.name, Print: printFn}
+	thread.SetLocal(localRun, r)
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	var val starlark.Value = starlark.None
+	if p, ok := r.sim.DataModel().GetValue(path); ok {
+		val = toValue(p)
+	}
+	wc := make(starlark.Tuple, 0, len(wildcards))
+	for _, w := range wildcards {
+		wc = append(wc, starlark.String(w))
+	}
+	change := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"path":      starlark.String(path),
+		"value":     val,
+		"wildcards": wc,
+	})
+	_, err := starlark.Call(thread, rl.fn, starlark.Tuple{change}, nil)
+	return err
+}
+
+// set changes a parameter value in the same way the control API does, the
+// change is queued to be processed by the rules when it comes back to the
+// script hook. Setting a parameter to its current value is not a change.
+func (r *run) set(path, val string) {
+	if p, ok := r.sim.DataModel().GetValue(path); ok && p.GetValue() == val {
+		return
+	}
+	r.sim.SetParameterValueContext(r.ctx, path, val)
+}
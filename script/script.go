@@ -0,0 +1,110 @@
+// Package script implements reactive device behavior defined in Starlark
+// scripts. Scripts register functions that are called when datamodel
+// parameters are changed, these functions can read and write parameter values
+// and queue Inform events.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Script is a loaded script with a list of rules that react to parameter
+// changes. A script is immutable once loaded and can be shared between
+// multiple devices.
+type Script struct {
+	name  string
+	rules []rule
+}
+
+// rule is a function called when a parameter matching the pattern is
+// changed.
+type rule struct {
+	pattern []string
+	fn      starlark.Callable
+}
+
+// ErrInvalidPattern is returned when a rule parameter pattern is invalid.
+var ErrInvalidPattern = errors.New("invalid parameter pattern")
+
+// fileOptions allow top-level control statements and while loops, which
+// makes scripts closer to regular Python.
+var fileOptions = &syntax.FileOptions{
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// Load loads a script from a Starlark file.
+func Load(path string) (*Script, error) {
+	// Assume the file is trusted
+	//nolint:gosec
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read script file: %w", err)
+	}
+	return Parse(path, b)
+}
+
+// Parse parses and executes the top-level code of a script, which registers
+// rules using the on_change function. Filename is used in error messages.
+func Parse(filename string, src []byte) (*Script, error) {
+	sc := &Script{name: filename}
+	thread := &starlark.Thread{Name: filename, Print: printFn}
+	thread.SetLocal(localScript, sc)
+	globals, err := starlark.ExecFileOptions(fileOptions, thread, filename, src, builtins)
+	if err != nil {
+		return nil, fmt.Errorf("execute script: %w", err)
+	}
+	// Frozen values are safe to use from multiple goroutines
+	globals.Freeze()
+	for _, r := range sc.rules {
+		r.fn.Freeze()
+	}
+	return sc, nil
+}
+
+// Rules returns the number of rules defined by the script.
+func (sc *Script) Rules() int {
+	return len(sc.rules)
+}
+
+// parsePattern splits a parameter pattern into segments. An asterisk
+// segment matches any single path segment, usually an instance number.
+func parsePattern(pattern string) ([]string, error) {
+	if pattern == "" || strings.HasPrefix(pattern, ".") || strings.HasSuffix(pattern, ".") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPattern, pattern)
+	}
+	segments := strings.Split(pattern, ".")
+	for _, s := range segments {
+		if s == "" || (s != "*" && strings.Contains(s, "*")) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPattern, pattern)
+		}
+	}
+	return segments, nil
+}
+
+// match checks if a path matches the rule pattern and returns the path
+// segments matched by asterisks.
+func (r rule) match(path string) ([]string, bool) {
+	segments := strings.Split(path, ".")
+	if len(segments) != len(r.pattern) {
+		return nil, false
+	}
+	var wildcards []string
+	for i, s := range r.pattern {
+		switch s {
+		case "*":
+			wildcards = append(wildcards, segments[i])
+		case segments[i]:
+		default:
+			return nil, false
+		}
+	}
+	return wildcards, true
+}
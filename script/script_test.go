@@ -0,0 +1,238 @@
+package script
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+	"github.com/localhots/SimulaTR69/simulator"
+)
+
+const wifiScript = `
+def radio_enable(change):
+    if change.value:
+        return
+    radio = "Device.WiFi.Radio.%s." % change.wildcards[0]
+    for i in instances("Device.WiFi.SSID."):
+        ssid = "Device.WiFi.SSID.%d." % i
+        if get(ssid + "LowerLayers") == radio:
+            set(ssid + "Status", "Down")
+    emit("4 VALUE CHANGE")
+
+def ssid_status(change):
+    if change.value != "Down":
+        return
+    ap = "Device.WiFi.AccessPoint.%s." % change.wildcards[0]
+    for i in instances(ap + "AssociatedDevice."):
+        delete(ap + "AssociatedDevice.%d" % i)
+    set(ap + "AssociatedDeviceNumberOfEntries", 0)
+
+on_change("Device.WiFi.Radio.*.Enable", radio_enable)
+on_change("Device.WiFi.SSID.*.Status", ssid_status)
+`
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+
+	sc, err := Parse("wifi.star", []byte(wifiScript))
+	require.NoError(t, err)
+	assert.Equal(t, 2, sc.Rules())
+
+	s := newSimulator(t, sc, map[string]string{
+		"Device.WiFi.Radio.1.Enable:xsd:boolean":                            "true",
+		"Device.WiFi.Radio.2.Enable:xsd:boolean":                            "true",
+		"Device.WiFi.SSID.1.LowerLayers":                                    "Device.WiFi.Radio.1.",
+		"Device.WiFi.SSID.1.Status":                                         "Up",
+		"Device.WiFi.SSID.2.LowerLayers":                                    "Device.WiFi.Radio.2.",
+		"Device.WiFi.SSID.2.Status":                                         "Up",
+		"Device.WiFi.AccessPoint.1.AssociatedDeviceNumberOfEntries:xsd:int": "2",
+		"Device.WiFi.AccessPoint.1.AssociatedDevice.1.MACAddress":           "00:11:22:33:44:01",
+		"Device.WiFi.AccessPoint.1.AssociatedDevice.2.MACAddress":           "00:11:22:33:44:02",
+		"Device.WiFi.AccessPoint.2.AssociatedDeviceNumberOfEntries:xsd:int": "1",
+		"Device.WiFi.AccessPoint.2.AssociatedDevice.1.MACAddress":           "00:11:22:33:44:03",
+	})
+
+	s.SetParameterValue("Device.WiFi.Radio.1.Enable", "1")
+	assertValue(t, s, "Device.WiFi.SSID.1.Status", "Up")
+	assert.Empty(t, s.PendingEvents())
+
+	s.SetParameterValue("Device.WiFi.Radio.1.Enable", "false")
+	assertValue(t, s, "Device.WiFi.SSID.1.Status", "Down")
+	assertValue(t, s, "Device.WiFi.SSID.2.Status", "Up")
+	assertValue(t, s, "Device.WiFi.AccessPoint.1.AssociatedDeviceNumberOfEntries", "0")
+	assertValue(t, s, "Device.WiFi.AccessPoint.2.AssociatedDeviceNumberOfEntries", "1")
+	_, ok := s.ParameterValue("Device.WiFi.AccessPoint.1.AssociatedDevice.1.MACAddress")
+	assert.False(t, ok)
+	assertValue(t, s, "Device.WiFi.AccessPoint.2.AssociatedDevice.1.MACAddress", "00:11:22:33:44:03")
+	assert.Equal(t, []string{rpc.EventValueChange}, s.PendingEvents())
+}
+
+func TestRuleLoop(t *testing.T) {
+	t.Parallel()
+
+	sc, err := Parse("loop.star", []byte(`
+def incr(other):
+    def fn(change):
+        set(other, change.value + 1)
+    return fn
+
+on_change("Device.A", incr("Device.B"))
+on_change("Device.B", incr("Device.A"))
+`))
+	require.NoError(t, err)
+	s := newSimulator(t, sc, map[string]string{
+		"Device.A:xsd:unsignedInt": "0",
+		"Device.B:xsd:unsignedInt": "0",
+	})
+
+	// Rules keep triggering each other until the limit is reached
+	s.SetParameterValue("Device.A", "1")
+	assertValue(t, s, "Device.A", "1001")
+	assertValue(t, s, "Device.B", "1000")
+}
+
+func TestRuleError(t *testing.T) {
+	t.Parallel()
+
+	sc, err := Parse("error.star", []byte(`
+def broken(change):
+    fail("oops")
+
+def copy(change):
+    set("Device.Copy", change.value)
+
+on_change("Device.*", broken)
+on_change("Device.*", copy)
+`))
+	require.NoError(t, err)
+	s := newSimulator(t, sc, map[string]string{
+		"Device.Original": "",
+	})
+
+	s.SetParameterValue("Device.Original", "foo")
+	assertValue(t, s, "Device.Copy", "foo")
+}
+
+func TestRuleWritePath(t *testing.T) {
+	t.Parallel()
+
+	sc, err := Parse("acs.star", []byte(`
+def move(change):
+    set("Device.ManagementServer.URL", change.value)
+
+on_change("Device.Test.ACS", move)
+`))
+	require.NoError(t, err)
+	var written []string
+	observer := simulator.Hooks{
+		ParameterWrite: func(_ context.Context, _ *simulator.Simulator, params []datamodel.Parameter) {
+			for _, p := range params {
+				written = append(written, p.Path+"="+p.Value)
+			}
+		},
+	}
+	s := newSimulator(t, sc, map[string]string{
+		"Device.Test.ACS":             "",
+		"Device.ManagementServer.URL": "http://acs.old",
+	}, simulator.WithHooks(observer))
+
+	// Writes made by rules are seen by other hooks and an ACS URL change
+	// makes the device bootstrap
+	s.SetParameterValue("Device.Test.ACS", "http://acs.new")
+	assertValue(t, s, "Device.ManagementServer.URL", "http://acs.new")
+	assert.ElementsMatch(t, []string{
+		"Device.Test.ACS=http://acs.new",
+		"Device.ManagementServer.URL=http://acs.new",
+	}, written)
+	tasks := s.PendingTasks()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Bootstrap", tasks[0].Name)
+}
+
+func TestRuleDeleteRelative(t *testing.T) {
+	t.Parallel()
+
+	sc, err := Parse("delete.star", []byte(`
+def clear(change):
+    delete("Hosts.Host.1")
+
+on_change("Device.Test.Clear", clear)
+`))
+	require.NoError(t, err)
+	s := newSimulator(t, sc, map[string]string{
+		"Device.Test.Clear":             "",
+		"Device.Hosts.Host.1.IPAddress": "10.0.0.2",
+	})
+
+	s.SetParameterValue("Device.Test.Clear", "1")
+	_, ok := s.ParameterValue("Device.Hosts.Host.1.IPAddress")
+	assert.False(t, ok)
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"syntax error":       `on_change(`,
+		"invalid pattern":    `on_change("Device..Enable", lambda c: None)`,
+		"partial wildcard":   `on_change("Device.WiFi.Radio.1*.Enable", lambda c: None)`,
+		"object pattern":     `on_change("Device.WiFi.", lambda c: None)`,
+		"not a function":     `on_change("Device.WiFi.Radio.1.Enable", 1)`,
+		"get at top level":   `get("Device.WiFi.Radio.1.Enable")`,
+		"emit at top level":  `emit("1 BOOT")`,
+		"unknown identifier": `foo()`,
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse("test.star", []byte(src))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	segments, err := parsePattern("Device.WiFi.*.*.Enable")
+	require.NoError(t, err)
+	r := rule{pattern: segments}
+
+	wildcards, ok := r.match("Device.WiFi.Radio.1.Enable")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Radio", "1"}, wildcards)
+	_, ok = r.match("Device.WiFi.Radio.1.Stats.Enable")
+	assert.False(t, ok)
+	_, ok = r.match("Device.WiFi.Radio.1.Status")
+	assert.False(t, ok)
+}
+
+// newSimulator creates a simulator with the given parameters, type can be
+// added to a path after a colon.
+func newSimulator(t *testing.T, sc *Script, values map[string]string, opts ...simulator.Option) *simulator.Simulator {
+	t.Helper()
+	defaults := make(map[string]datamodel.Parameter, len(values))
+	for key, val := range values {
+		path, typ, ok := strings.Cut(key, ":")
+		if !ok {
+			typ = rpc.XSD(rpc.TypeString)
+		}
+		defaults[path] = datamodel.Parameter{Path: path, Type: typ, Value: val, Writable: true}
+	}
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	dm := datamodel.New(state.WithDefaults(defaults))
+	return simulator.New(dm, append([]simulator.Option{simulator.WithHooks(sc.Hooks())}, opts...)...)
+}
+
+func assertValue(t *testing.T, s *simulator.Simulator, path, exp string) {
+	t.Helper()
+	val, ok := s.ParameterValue(path)
+	require.True(t, ok, "parameter %s is missing", path)
+	assert.Equal(t, exp, val, path)
+}
@@ -0,0 +1,366 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// AdminServer is an HTTP server that exposes an API for inspecting and
+// controlling simulated devices. Devices are addressed by their serial
+// numbers, which makes it work the same way for a single device and a fleet.
+//
+//	GET    /devices
+//	GET    /devices/{serial}
+//	GET    /devices/{serial}/parameters?prefix=Device.DeviceInfo.
+//	GET    /devices/{serial}/parameters/{path}
+//	PUT    /devices/{serial}/parameters/{path}  {"value": "..."}
+//	DELETE /devices/{serial}/parameters/{path}
+//	GET    /devices/{serial}/state
+//	POST   /devices/{serial}/inform             {"events": ["..."]}
+//	POST   /devices/{serial}/reboot
+//	POST   /devices/{serial}/factory-reset
+//	POST   /devices/{serial}/offline            {"duration": "2m"}
+//	GET    /devices/{serial}/pending
+//	GET    /devices/{serial}/sessions
+//	GET    /devices/{serial}/faults
+//	POST   /devices/{serial}/faults             {"method": "...", "code": 9002}
+//	PUT    /devices/{serial}/faults/{name}      {"enabled": false}
+//	DELETE /devices/{serial}/faults/{name}
+type AdminServer struct {
+	sims       []*Simulator
+	httpServer *http.Server
+}
+
+// DeviceSummary describes a simulated device.
+type DeviceSummary struct {
+	SerialNumber string     `json:"serial_number"`
+	Manufacturer string     `json:"manufacturer"`
+	OUI          string     `json:"oui"`
+	ProductClass string     `json:"product_class"`
+	Bootstrapped bool       `json:"bootstrapped"`
+	DownUntil    *time.Time `json:"down_until,omitempty"`
+}
+
+// ParameterInfo describes a datamodel parameter.
+type ParameterInfo struct {
+	Path     string `json:"path"`
+	Object   bool   `json:"object"`
+	Writable bool   `json:"writable"`
+	Type     string `json:"type,omitempty"`
+	Value    string `json:"value"`
+}
+
+// PendingInfo describes the work scheduled by a device.
+type PendingInfo struct {
+	Tasks []TaskInfo `json:"tasks"`
+	// Events are included in the next Inform message.
+	Events []string `json:"events"`
+	// QueuedInformTriggers is the number of inform requests, e.g. made by
+	// connection requests or the admin API, that are waiting to be picked up.
+	QueuedInformTriggers int `json:"queued_inform_triggers"`
+}
+
+// NewAdminServer creates an admin server for the given simulators.
+func NewAdminServer(sims ...*Simulator) *AdminServer {
+	return &AdminServer{sims: sims}
+}
+
+// Start starts the admin server on the given address.
+func (a *AdminServer) Start(ctx context.Context, addr string) error {
+	// Linter demands the ListenConfig must be used.
+	//nolint:noctx
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("create admin listener: %w", err)
+	}
+	a.httpServer = &http.Server{
+		Addr:              listener.Addr().String(),
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	log.Info("Started admin server", log.F{"addr": a.httpServer.Addr})
+	go func() {
+		if err := a.httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Admin server error", log.Cause(err))
+		}
+	}()
+	return nil
+}
+
+// Stop stops the admin server.
+func (a *AdminServer) Stop(ctx context.Context) error {
+	if a.httpServer == nil {
+		return nil
+	}
+	return a.httpServer.Shutdown(ctx)
+}
+
+// Handler returns the admin API handler.
+func (a *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", a.handleListDevices)
+	mux.HandleFunc("GET /devices/{serial}", a.withDevice(a.handleGetDevice))
+	mux.HandleFunc("GET /devices/{serial}/parameters", a.withDevice(a.handleListParameters))
+	mux.HandleFunc("GET /devices/{serial}/parameters/{path}", a.withDevice(a.handleGetParameter))
+	mux.HandleFunc("PUT /devices/{serial}/parameters/{path}", a.withDevice(a.handleSetParameter))
+	mux.HandleFunc("DELETE /devices/{serial}/parameters/{path}", a.withDevice(a.handleDeleteParameter))
+	mux.HandleFunc("GET /devices/{serial}/state", a.withDevice(a.handleGetState))
+	mux.HandleFunc("POST /devices/{serial}/inform", a.withDevice(a.handleInform))
+	mux.HandleFunc("POST /devices/{serial}/reboot", a.withDevice(a.handleReboot))
+	mux.HandleFunc("POST /devices/{serial}/factory-reset", a.withDevice(a.handleFactoryReset))
+	mux.HandleFunc("POST /devices/{serial}/offline", a.withDevice(a.handleOffline))
+	mux.HandleFunc("GET /devices/{serial}/pending", a.withDevice(a.handlePending))
+	mux.HandleFunc("GET /devices/{serial}/sessions", a.withDevice(a.handleSessions))
+	mux.HandleFunc("GET /devices/{serial}/faults", a.withDevice(a.handleListFaults))
+	mux.HandleFunc("POST /devices/{serial}/faults", a.withDevice(a.handleAddFault))
+	mux.HandleFunc("PUT /devices/{serial}/faults/{name}", a.withDevice(a.handleToggleFault))
+	mux.HandleFunc("DELETE /devices/{serial}/faults/{name}", a.withDevice(a.handleDeleteFault))
+	return mux
+}
+
+type deviceHandlerFn func(w http.ResponseWriter, r *http.Request, s *Simulator)
+
+// withDevice looks up the device by the serial number from the request path.
+func (a *AdminServer) withDevice(h deviceHandlerFn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serial := r.PathValue("serial")
+		// Serial numbers can be changed at runtime, so they are not indexed
+		for _, s := range a.sims {
+			if s.SerialNumber() == serial {
+				h(w, r, s)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("device %q not found", serial))
+	}
+}
+
+func (a *AdminServer) handleListDevices(w http.ResponseWriter, _ *http.Request) {
+	devices := make([]DeviceSummary, 0, len(a.sims))
+	for _, s := range a.sims {
+		devices = append(devices, summarize(s))
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (a *AdminServer) handleGetDevice(w http.ResponseWriter, _ *http.Request, s *Simulator) {
+	writeJSON(w, http.StatusOK, summarize(s))
+}
+
+func (a *AdminServer) handleListParameters(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	prefix := r.URL.Query().Get("prefix")
+	params := []ParameterInfo{}
+	s.dm.Each(func(p datamodel.Parameter) bool {
+		if strings.HasPrefix(p.Path, prefix) {
+			params = append(params, parameterInfo(p))
+		}
+		return true
+	})
+	slices.SortFunc(params, func(a, b ParameterInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	writeJSON(w, http.StatusOK, params)
+}
+
+func (a *AdminServer) handleGetParameter(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	p, ok := s.dm.GetValue(r.PathValue("path"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("parameter not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, parameterInfo(p))
+}
+
+func (a *AdminServer) handleSetParameter(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	var req struct {
+		Value *string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Value == nil {
+		writeError(w, http.StatusBadRequest, errors.New(`expected {"value": "..."}`))
+		return
+	}
+	path := r.PathValue("path")
+	p, ok := s.dm.GetValue(path)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("parameter not found"))
+		return
+	}
+	if p.Object {
+		writeError(w, http.StatusBadRequest, errors.New("objects have no value"))
+		return
+	}
+	s.SetParameterValue(path, *req.Value)
+	p, _ = s.dm.GetValue(path)
+	writeJSON(w, http.StatusOK, parameterInfo(p))
+}
+
+func (a *AdminServer) handleDeleteParameter(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	path := r.PathValue("path")
+	if _, ok := s.dm.GetValue(path); !ok {
+		writeError(w, http.StatusNotFound, errors.New("parameter not found"))
+		return
+	}
+	s.DeleteParameter(path)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminServer) handleGetState(w http.ResponseWriter, _ *http.Request, s *Simulator) {
+	b, err := s.dm.MarshalState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (a *AdminServer) handleInform(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	var req struct {
+		Events []string `json:"events"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if len(req.Events) == 0 {
+		req.Events = []string{rpc.EventConnectionRequest}
+	}
+	if err := s.TriggerInform(req.Events...); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrNotRunning) || errors.Is(err, ErrInformPending) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *AdminServer) handleReboot(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	s.Reboot(context.WithoutCancel(r.Context()))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *AdminServer) handleFactoryReset(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	s.FactoryReset(context.WithoutCancel(r.Context()))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *AdminServer) handleOffline(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	var req struct {
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(`expected {"duration": "..."}`))
+		return
+	}
+	dur, err := time.ParseDuration(req.Duration)
+	if err != nil || dur <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %q", req.Duration))
+		return
+	}
+	s.GoOffline(dur)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *AdminServer) handlePending(w http.ResponseWriter, _ *http.Request, s *Simulator) {
+	writeJSON(w, http.StatusOK, PendingInfo{
+		Tasks:                s.PendingTasks(),
+		Events:               s.PendingEvents(),
+		QueuedInformTriggers: len(s.pendingEvents),
+	})
+}
+
+func (a *AdminServer) handleSessions(w http.ResponseWriter, _ *http.Request, s *Simulator) {
+	writeJSON(w, http.StatusOK, s.Sessions())
+}
+
+func (a *AdminServer) handleListFaults(w http.ResponseWriter, _ *http.Request, s *Simulator) {
+	writeJSON(w, http.StatusOK, s.FaultRules())
+}
+
+func (a *AdminServer) handleAddFault(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	var rule FaultRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.AddFaultRule(rule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.FaultRules())
+}
+
+func (a *AdminServer) handleToggleFault(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, errors.New(`expected {"enabled": true|false}`))
+		return
+	}
+	if err := s.SetFaultRuleEnabled(r.PathValue("name"), *req.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.FaultRules())
+}
+
+func (a *AdminServer) handleDeleteFault(w http.ResponseWriter, r *http.Request, s *Simulator) {
+	if err := s.RemoveFaultRule(r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func summarize(s *Simulator) DeviceSummary {
+	id := s.dm.DeviceID()
+	sum := DeviceSummary{
+		SerialNumber: id.SerialNumber,
+		Manufacturer: id.Manufacturer,
+		OUI:          id.OUI,
+		ProductClass: id.ProductClass,
+		Bootstrapped: s.dm.IsBootstrapped(),
+	}
+	if du := s.dm.DownUntil(); du.After(time.Now()) {
+		sum.DownUntil = &du
+	}
+	return sum
+}
+
+func parameterInfo(p datamodel.Parameter) ParameterInfo {
+	return ParameterInfo{
+		Path:     p.Path,
+		Object:   p.Object,
+		Writable: p.Writable,
+		Type:     p.Type,
+		Value:    p.GetValue(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
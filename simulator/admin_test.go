@@ -0,0 +1,160 @@
+package simulator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestAdminServer(t *testing.T) {
+	t.Parallel()
+
+	newSim := func(serial string) *Simulator {
+		state, err := datamodel.LoadState("")
+		require.NoError(t, err)
+		dm := datamodel.New(state.WithDefaults(map[string]datamodel.Parameter{
+			"Device.DeviceInfo.SerialNumber":    {Path: "Device.DeviceInfo.SerialNumber"},
+			"Device.DeviceInfo.SoftwareVersion": {Path: "Device.DeviceInfo.SoftwareVersion", Value: "1.0"},
+		}))
+		dm.SetSerialNumber(serial)
+		return New(dm)
+	}
+	sim1, sim2 := newSim("ABC001"), newSim("ABC002")
+	srv := httptest.NewServer(NewAdminServer(sim1, sim2).Handler())
+	defer srv.Close()
+
+	call := func(method, path, body string) (int, string) {
+		req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+	const param = "/devices/ABC002/parameters/Device.DeviceInfo.SoftwareVersion"
+
+	t.Run("list devices", func(t *testing.T) {
+		status, body := call(http.MethodGet, "/devices", "")
+		assert.Equal(t, http.StatusOK, status)
+		var devices []DeviceSummary
+		require.NoError(t, json.Unmarshal([]byte(body), &devices))
+		require.Len(t, devices, 2)
+		assert.Equal(t, "ABC002", devices[1].SerialNumber)
+	})
+	t.Run("unknown device", func(t *testing.T) {
+		status, _ := call(http.MethodGet, "/devices/XYZ/parameters", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+	t.Run("set parameter", func(t *testing.T) {
+		status, body := call(http.MethodPut, param, `{"value": "2.0"}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `"value":"2.0"`)
+
+		val, _ := sim2.ParameterValue("Device.DeviceInfo.SoftwareVersion")
+		assert.Equal(t, "2.0", val)
+		val, _ = sim1.ParameterValue("Device.DeviceInfo.SoftwareVersion")
+		assert.Equal(t, "1.0", val)
+
+		status, _ = call(http.MethodPut, param, `{}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+	t.Run("list parameters", func(t *testing.T) {
+		status, body := call(http.MethodGet, "/devices/ABC001/parameters?prefix=Device.DeviceInfo.Soft", "")
+		assert.Equal(t, http.StatusOK, status)
+		var params []ParameterInfo
+		require.NoError(t, json.Unmarshal([]byte(body), &params))
+		require.Len(t, params, 1)
+		assert.Equal(t, "1.0", params[0].Value)
+	})
+	t.Run("state", func(t *testing.T) {
+		status, body := call(http.MethodGet, "/devices/ABC001/state", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `"Changes"`)
+	})
+	t.Run("inform", func(t *testing.T) {
+		status, _ := call(http.MethodPost, "/devices/ABC001/inform", `{"events": ["1 BOOT", "4 VALUE CHANGE"]}`)
+		assert.Equal(t, http.StatusConflict, status)
+		assert.Empty(t, sim1.PendingEvents())
+
+		sim1.running.Store(true)
+		defer sim1.running.Store(false)
+		status, _ = call(http.MethodPost, "/devices/ABC001/inform", `{"events": ["1 BOOT", "4 VALUE CHANGE"]}`)
+		assert.Equal(t, http.StatusAccepted, status)
+		assert.Equal(t, []string{rpc.EventBoot}, sim1.PendingEvents())
+		select {
+		case evt := <-sim1.pendingEvents:
+			assert.Equal(t, rpc.EventValueChange, evt)
+		default:
+			t.Error("Expected a queued session")
+		}
+	})
+	t.Run("pending tasks", func(t *testing.T) {
+		status, _ := call(http.MethodPost, "/devices/ABC001/offline", `{"duration": "1m"}`)
+		assert.Equal(t, http.StatusAccepted, status)
+		status, _ = call(http.MethodPost, "/devices/ABC001/offline", `{"duration": "forever"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = call(http.MethodPost, "/devices/ABC001/reboot", "")
+		assert.Equal(t, http.StatusAccepted, status)
+
+		status, body := call(http.MethodGet, "/devices/ABC001/pending", "")
+		assert.Equal(t, http.StatusOK, status)
+		var pending PendingInfo
+		require.NoError(t, json.Unmarshal([]byte(body), &pending))
+		require.Len(t, pending.Tasks, 2)
+		assert.Equal(t, "Offline", pending.Tasks[0].Name)
+		assert.Equal(t, "Reboot", pending.Tasks[1].Name)
+	})
+	t.Run("faults", func(t *testing.T) {
+		status, _ := call(http.MethodPost, "/devices/ABC001/faults", `{"name": "spv", "method": "SetParameterValues", "code": 9002}`)
+		assert.Equal(t, http.StatusCreated, status)
+		status, _ = call(http.MethodPost, "/devices/ABC001/faults", `{"method": "SetParameterValues"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = call(http.MethodPut, "/devices/ABC001/faults/spv", `{"enabled": false}`)
+		assert.Equal(t, http.StatusOK, status)
+		rules := sim1.FaultRules()
+		require.Len(t, rules, 1)
+		assert.True(t, rules[0].Disabled)
+
+		status, _ = call(http.MethodDelete, "/devices/ABC001/faults/spv", "")
+		assert.Equal(t, http.StatusNoContent, status)
+		status, _ = call(http.MethodDelete, "/devices/ABC001/faults/spv", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+	t.Run("delete parameter", func(t *testing.T) {
+		status, _ := call(http.MethodDelete, param, "")
+		assert.Equal(t, http.StatusNoContent, status)
+		status, _ = call(http.MethodGet, param, "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		// Paths without the root object are resolved in the same way for
+		// reads and deletes
+		status, _ = call(http.MethodDelete, "/devices/ABC001/parameters/DeviceInfo.SoftwareVersion", "")
+		assert.Equal(t, http.StatusNoContent, status)
+		_, ok := sim1.ParameterValue("Device.DeviceInfo.SoftwareVersion")
+		assert.False(t, ok)
+	})
+}
+
+func TestSessionHistory(t *testing.T) {
+	t.Parallel()
+	var h sessionHistory
+	for i := range sessionHistorySize + 5 {
+		h.add(SessionInfo{ACSURL: strings.Repeat("x", i)})
+	}
+	sessions := h.list()
+	require.Len(t, sessions, sessionHistorySize)
+	assert.Len(t, sessions[0].ACSURL, 5)
+	assert.Len(t, sessions[sessionHistorySize-1].ACSURL, sessionHistorySize+4)
+}
@@ -0,0 +1,187 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/localhots/blip/noctx/log"
+)
+
+// Chaos kinds describe transport-level misbehavior of a device.
+const (
+	// ChaosDropConnection closes the connection while a message is being
+	// sent, which ends the session.
+	ChaosDropConnection = "drop_connection"
+	// ChaosTruncateBody sends only the first half of a message.
+	ChaosTruncateBody = "truncate_body"
+	// ChaosMalformedXML sends a message that is not a valid XML document.
+	ChaosMalformedXML = "malformed_xml"
+	// ChaosSlowBody trickles message bytes slowly, slow-loris style.
+	ChaosSlowBody = "slow_body"
+	// ChaosWrongContentType sends messages with a non-XML content type.
+	ChaosWrongContentType = "wrong_content_type"
+	// ChaosSkipEmptyPost ends the session without sending the empty POST
+	// request.
+	ChaosSkipEmptyPost = "skip_empty_post"
+)
+
+// ErrUnknownChaos is returned when an unsupported chaos kind is used.
+var ErrUnknownChaos = errors.New("unknown chaos kind")
+
+// errChaosDrop is returned when the connection is dropped on purpose.
+var errChaosDrop = errors.New("connection dropped by chaos")
+
+const (
+	wrongContentType = "application/octet-stream"
+	trickleChunkSize = 16
+)
+
+// chaos holds chaos probabilities changed at runtime. They take precedence
+// over the ones from the configuration.
+type chaos struct {
+	overrides map[string]float64
+	lock      sync.Mutex
+}
+
+// SetChaos sets the probability of the given kind of transport-level
+// misbehavior, from 0 to 1. It overrides the configured value.
+func (s *Simulator) SetChaos(kind string, probability float64) error {
+	if _, err := s.cfg.chaosProbability(kind); err != nil {
+		return err
+	}
+	if probability < 0 || probability > 1 {
+		return fmt.Errorf("%s: probability must be between 0 and 1", kind)
+	}
+
+	s.chaos.lock.Lock()
+	defer s.chaos.lock.Unlock()
+	if s.chaos.overrides == nil {
+		s.chaos.overrides = make(map[string]float64)
+	}
+	s.chaos.overrides[kind] = probability
+	return nil
+}
+
+// rollChaos returns true if the given kind of misbehavior should happen now.
+func (s *Simulator) rollChaos(ctx context.Context, kind string) bool {
+	s.chaos.lock.Lock()
+	p, ok := s.chaos.overrides[kind]
+	s.chaos.lock.Unlock()
+	if !ok {
+		p, _ = s.cfg.chaosProbability(kind)
+	}
+	// It's fine to use non cryptographic randomness here.
+	//nolint:gosec
+	if p <= 0 || rand.Float64() >= p {
+		return false
+	}
+	s.logger.Info(ctx, "Misbehaving", log.F{"chaos": kind})
+	return true
+}
+
+// chaosBody applies chaos to the message body before it is sent.
+func (s *Simulator) chaosBody(ctx context.Context, body []byte) []byte {
+	if s.rollChaos(ctx, ChaosTruncateBody) {
+		body = body[:len(body)/2]
+	}
+	if s.rollChaos(ctx, ChaosMalformedXML) {
+		body = malformXML(body)
+	}
+	return body
+}
+
+func (cfg Config) chaosProbability(kind string) (float64, error) {
+	switch kind {
+	case ChaosDropConnection:
+		return cfg.ChaosDropConnection, nil
+	case ChaosTruncateBody:
+		return cfg.ChaosTruncateBody, nil
+	case ChaosMalformedXML:
+		return cfg.ChaosMalformedXML, nil
+	case ChaosSlowBody:
+		return cfg.ChaosSlowBody, nil
+	case ChaosWrongContentType:
+		return cfg.ChaosWrongContentType, nil
+	case ChaosSkipEmptyPost:
+		return cfg.ChaosSkipEmptyPost, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownChaos, kind)
+	}
+}
+
+// malformXML breaks the document by removing the last closing tag and adding
+// an unescaped ampersand.
+func malformXML(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if i := bytes.LastIndex(b, []byte("</")); i >= 0 {
+		b = b[:i]
+	}
+	return append(b, []byte(" & ")...)
+}
+
+// dropReader returns an error after reading n bytes, which makes the HTTP
+// client close the connection.
+type dropReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *dropReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errChaosDrop
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+// slowBodyDuration returns the time it takes to send a slow message. It is
+// kept below the request timeout, otherwise the request would be aborted by
+// the client before the ACS gets the chance to respond.
+func (s *Simulator) slowBodyDuration() time.Duration {
+	dur := s.cfg.ChaosSlowBodyDuration
+	if s.cfg.RequestTimeout > 0 {
+		dur = min(dur, s.cfg.RequestTimeout*4/5)
+	}
+	return dur
+}
+
+// trickleReader reads a few bytes at a time, spreading the whole body over
+// the given time.
+type trickleReader struct {
+	ctx   context.Context
+	r     io.Reader
+	delay time.Duration
+}
+
+func newTrickleReader(ctx context.Context, body []byte, dur time.Duration) *trickleReader {
+	chunks := (len(body) + trickleChunkSize - 1) / trickleChunkSize
+	return &trickleReader{
+		ctx:   ctx,
+		r:     bytes.NewReader(body),
+		delay: dur / time.Duration(max(chunks, 1)),
+	}
+}
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	t := time.NewTimer(r.delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	}
+	if len(p) > trickleChunkSize {
+		p = p[:trickleChunkSize]
+	}
+	return r.r.Read(p)
+}
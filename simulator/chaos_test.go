@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestChaos(t *testing.T) {
+	t.Parallel()
+
+	type request struct {
+		contentType string
+		body        []byte
+		err         error
+	}
+	newACS := func(t *testing.T) (*httptest.Server, <-chan request) {
+		t.Helper()
+		requests := make(chan request, 10)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			requests <- request{contentType: r.Header.Get("Content-Type"), body: b, err: err}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, requests
+	}
+	send := func(t *testing.T, kind string) (request, error) {
+		t.Helper()
+		acs, requests := newACS(t)
+		cfg := DefaultConfig()
+		cfg.ChaosSlowBodyDuration = 200 * time.Millisecond
+		s := New(newTestDataModel(t), WithConfig(cfg))
+		require.NoError(t, s.SetChaos(kind, 1))
+		sess := newTestSession(t, acs.URL, clientOptions{})
+		resp, err := s.request(t.Context(), sess, s.newEnvelope().WithFault(rpc.FaultInternalError))
+		if err != nil {
+			select {
+			case r := <-requests:
+				return r, err
+			case <-time.After(time.Second):
+				return request{}, err
+			}
+		}
+		require.NoError(t, resp.Body.Close())
+		return <-requests, nil
+	}
+	isXML := func(b []byte) bool {
+		var v any
+		return xml.Unmarshal(b, &v) == nil
+	}
+
+	t.Run("truncate body", func(t *testing.T) {
+		r, err := send(t, ChaosTruncateBody)
+		require.NoError(t, err)
+		assert.False(t, isXML(r.body))
+	})
+	t.Run("malformed xml", func(t *testing.T) {
+		r, err := send(t, ChaosMalformedXML)
+		require.NoError(t, err)
+		assert.False(t, isXML(r.body))
+	})
+	t.Run("wrong content type", func(t *testing.T) {
+		r, err := send(t, ChaosWrongContentType)
+		require.NoError(t, err)
+		assert.Equal(t, wrongContentType, r.contentType)
+		assert.True(t, isXML(r.body))
+	})
+	t.Run("drop connection", func(t *testing.T) {
+		_, err := send(t, ChaosDropConnection)
+		require.ErrorIs(t, err, errChaosDrop)
+	})
+	t.Run("slow body", func(t *testing.T) {
+		start := time.Now()
+		r, err := send(t, ChaosSlowBody)
+		require.NoError(t, err)
+		assert.True(t, isXML(r.body))
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+	t.Run("slow body canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		r := newTrickleReader(ctx, make([]byte, 1024), time.Hour)
+		_, err := r.Read(make([]byte, 64))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("slow body duration", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.ChaosSlowBodyDuration = time.Minute
+		s := New(newTestDataModel(t), WithConfig(cfg))
+		assert.Less(t, s.slowBodyDuration(), cfg.RequestTimeout)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		s := New(newTestDataModel(t))
+		require.ErrorIs(t, s.SetChaos("explode", 1), ErrUnknownChaos)
+		require.Error(t, s.SetChaos(ChaosSlowBody, 1.5))
+	})
+}
+
+func TestChaosSkipEmptyPost(t *testing.T) {
+	t.Parallel()
+
+	var methods []string
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if len(b) == 0 {
+			methods = append(methods, "Empty")
+		} else {
+			methods = append(methods, "Inform")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer acs.Close()
+
+	s := New(newTestDataModel(t))
+	s.dm.SeedACSURL(acs.URL)
+	s.dm.AddEvent(rpc.EventBoot)
+	require.NoError(t, s.SetChaos(ChaosSkipEmptyPost, 1))
+	s.startSession(t.Context(), s.informHandler)
+	assert.Equal(t, []string{"Inform"}, methods)
+}
@@ -0,0 +1,202 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/icholy/digest"
+)
+
+// clientOptions configure connections to the ACS.
+type clientOptions struct {
+	tls *tls.Config
+	// proxy is an optional HTTP or HTTPS proxy URL. Connections to HTTPS ACS
+	// are tunneled through the proxy using the CONNECT method.
+	proxy *url.URL
+	// localAddr is an optional source address for outgoing connections.
+	localAddr *net.TCPAddr
+
+	connectTimeout time.Duration
+	requestTimeout time.Duration
+	auth           string
+	username       string
+	password       string
+}
+
+func newClientOptions(cfg Config) (clientOptions, error) {
+	opts := clientOptions{
+		connectTimeout: cfg.ConnectionTimeout,
+		requestTimeout: cfg.RequestTimeout,
+		auth:           cfg.ACSAuth,
+		username:       cfg.ACSUsername,
+		password:       cfg.ACSPassword,
+	}
+	var err error
+	opts.tls, err = newACSTLSConfig(cfg)
+	if err != nil {
+		return opts, err
+	}
+	if cfg.ACSProxy != "" {
+		opts.proxy, err = url.Parse(cfg.ACSProxy)
+		if err != nil {
+			return opts, fmt.Errorf("parse proxy URL: %w", err)
+		}
+	}
+	if cfg.SourceIP != "" {
+		ip := net.ParseIP(cfg.SourceIP)
+		if ip == nil {
+			return opts, fmt.Errorf("invalid source IP address: %s", cfg.SourceIP)
+		}
+		opts.localAddr = &net.TCPAddr{IP: ip}
+	}
+	return opts, nil
+}
+
+// newClient creates an HTTP client for a single session with the ACS. The
+// first connection to the ACS or the proxy is established immediately in
+// order to fail early and to measure connection latency. New connections are
+// only made if the ACS closes the connection or redirects the CPE to a
+// different host.
+func newClient(acsURL *url.URL, opts clientOptions) (*http.Client, func() error, error) {
+	dialer := net.Dialer{
+		Timeout: opts.connectTimeout,
+	}
+	if opts.localAddr != nil {
+		dialer.LocalAddr = opts.localAddr
+	}
+	addr := net.JoinHostPort(acsURL.Hostname(), tcpPort(acsURL))
+	if opts.proxy != nil {
+		addr = net.JoinHostPort(opts.proxy.Hostname(), tcpPort(opts.proxy))
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create a TCP connection to ACS: %w", err)
+	}
+
+	var lock sync.Mutex
+	takeConn := func() net.Conn {
+		lock.Lock()
+		defer lock.Unlock()
+		c := conn
+		conn = nil
+		return c
+	}
+
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, network, dialAddr string) (net.Conn, error) {
+			if dialAddr == addr {
+				if c := takeConn(); c != nil {
+					return c, nil
+				}
+			}
+			return dialer.DialContext(ctx, network, dialAddr)
+		},
+		TLSClientConfig: opts.tls,
+		MaxConnsPerHost: 1,
+	}
+	if opts.proxy != nil {
+		tr.Proxy = http.ProxyURL(opts.proxy)
+	}
+	client := &http.Client{
+		Transport: tr,
+		Timeout:   opts.requestTimeout,
+		// Redirects are handled manually, see Simulator.request
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	switch opts.auth {
+	case AuthDigest:
+		client.Transport = &digest.Transport{
+			Transport: tr,
+			Username:  opts.username,
+			Password:  opts.password,
+		}
+	case AuthBasic:
+		client.Transport = &basicAuthTransport{
+			transport: tr,
+			username:  opts.username,
+			password:  opts.password,
+		}
+	}
+
+	closeFn := func() error {
+		tr.CloseIdleConnections()
+		// Connection could be left unused if the first request was redirected
+		if c := takeConn(); c != nil {
+			return c.Close()
+		}
+		return nil
+	}
+	return client, closeFn, nil
+}
+
+// basicAuthTransport adds basic authentication credentials to every request.
+type basicAuthTransport struct {
+	transport http.RoundTripper
+	username  string
+	password  string
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.transport.RoundTrip(req)
+}
+
+// newACSTLSConfig creates a TLS configuration for connections to the ACS. If a
+// CA bundle is provided server certificates are always verified.
+func newACSTLSConfig(cfg Config) (*tls.Config, error) {
+	conf := &tls.Config{
+		//nolint:gosec
+		InsecureSkipVerify: !cfg.ACSVerifyTLS,
+	}
+
+	if cfg.ACSCACert != "" {
+		b, err := os.ReadFile(cfg.ACSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		conf.RootCAs = pool
+		conf.InsecureSkipVerify = false
+	}
+
+	if cfg.ACSClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ACSClientCert, cfg.ACSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+func tcpPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Port()
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// isRedirect returns true if the response status code is one of the redirect
+// codes that CPE must follow, as described in TR-069 section 3.4.5.
+func isRedirect(code int) bool {
+	return code == http.StatusFound || code == http.StatusTemporaryRedirect
+}
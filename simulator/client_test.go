@@ -0,0 +1,153 @@
+package simulator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestRequestRedirect(t *testing.T) {
+	t.Parallel()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		un, pw, ok := r.BasicAuth()
+		if !ok || un != "user" || pw != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if b, _ := io.ReadAll(r.Body); len(b) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/acs", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	s := New(newTestDataModel(t))
+	sess := newTestSession(t, origin.URL+"/acs", clientOptions{
+		auth:     AuthBasic,
+		username: "user",
+		password: "pass",
+	})
+	resp, err := s.request(t.Context(), sess, s.newEnvelope().WithFault(rpc.FaultMethodNotSupported))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, target.URL+"/acs", sess.acsURL)
+	assert.Equal(t, 1, sess.redirects)
+}
+
+func TestRequestTooManyRedirects(t *testing.T) {
+	t.Parallel()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+"/acs", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	s := New(newTestDataModel(t))
+	sess := newTestSession(t, srv.URL+"/acs", clientOptions{})
+	_, err := s.request(t.Context(), sess, nil)
+	require.Error(t, err)
+	assert.Equal(t, maxRedirects, sess.redirects)
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	t.Parallel()
+	certFile, keyFile := writeTestCert(t)
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	clientCA := x509.NewCertPool()
+	clientCA.AddCert(clientCert.Leaf)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCA,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	cfg := DefaultConfig()
+	cfg.ACSCACert = caFile
+	cfg.ACSClientCert = certFile
+	cfg.ACSClientKey = keyFile
+	tlsConf, err := newACSTLSConfig(cfg)
+	require.NoError(t, err)
+	assert.False(t, tlsConf.InsecureSkipVerify)
+
+	s := New(newTestDataModel(t))
+	sess := newTestSession(t, srv.URL, clientOptions{tls: tlsConf})
+	resp, err := s.request(t.Context(), sess, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestClientProxy(t *testing.T) {
+	t.Parallel()
+	requests := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	s := New(newTestDataModel(t))
+	sess := newTestSession(t, "http://acs.invalid/acs", clientOptions{
+		proxy:     proxyURL,
+		localAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)},
+	})
+	resp, err := s.request(t.Context(), sess, nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	r := <-requests
+	assert.Equal(t, "http://acs.invalid/acs", r.URL.String())
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.2", host)
+}
+
+func newTestDataModel(t *testing.T) *datamodel.DataModel {
+	t.Helper()
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	return datamodel.New(state)
+}
+
+func newTestSession(t *testing.T, acsURL string, opts clientOptions) *session {
+	t.Helper()
+	u, err := url.Parse(acsURL)
+	require.NoError(t, err)
+	client, closeFn, err := newClient(u, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = closeFn() })
+	return &session{client: client, acsURL: acsURL}
+}
@@ -0,0 +1,56 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/simulator/metrics"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.Equal(t, uint16(7547), cfg.Port)
+	assert.Equal(t, "/cwmp", cfg.ConnReqPath)
+	assert.Equal(t, AuthNone, cfg.ACSAuth)
+	assert.Equal(t, IPFamilyIPv4, cfg.IPFamily)
+	assert.True(t, cfg.ConnReqEnableHTTP)
+
+	// Serial number and datamodel path have no defaults
+	require.Error(t, cfg.Validate())
+	cfg.SerialNumber = "SIM-0001"
+	cfg.DataModelPath = "dm.csv"
+	require.NoError(t, cfg.Validate())
+
+	cfg.MetricsLabels = "everything"
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidMetricsLabels)
+	cfg.MetricsLabels = metrics.LabelsNone
+
+	cfg.DecodingMode = "pedantic"
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidDecodingMode)
+	cfg.DecodingMode = DecodingStrict
+	require.NoError(t, cfg.Validate())
+
+	cfg.ChaosSlowBody = 0.1
+	cfg.ChaosSlowBodyDuration = cfg.RequestTimeout
+	require.Error(t, cfg.Validate())
+	cfg.ChaosSlowBody = 0
+
+	cfg.TracingSampleRatio = 1.5
+	require.Error(t, cfg.Validate())
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("SERIAL_NUMBER", "SIM-{04d}")
+	t.Setenv("DATAMODEL_PATH", "dm.csv")
+	t.Setenv("FLEET_SIZE", "2")
+	t.Setenv("STATE_PATH", "state.json")
+	_, err := LoadConfig(t.Context())
+	require.Error(t, err)
+
+	t.Setenv("STATE_PATH", "state-{d}.json")
+	cfg, err := LoadConfig(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.FleetSize)
+}
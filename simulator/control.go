@@ -0,0 +1,179 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/localhots/blip"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// DataModel returns the datamodel of the simulated device.
+func (s *Simulator) DataModel() *datamodel.DataModel {
+	return s.dm
+}
+
+// SerialNumber returns the serial number of the simulated device.
+func (s *Simulator) SerialNumber() string {
+	return s.dm.DeviceID().SerialNumber
+}
+
+// Logger returns the logger of the simulated device.
+func (s *Simulator) Logger() *blip.Logger {
+	return s.logger
+}
+
+// SetParameterValue changes a datamodel parameter value as if it was changed
+// by the device itself.
+func (s *Simulator) SetParameterValue(path, value string) {
+	s.SetParameterValueContext(context.Background(), path, value)
+}
+
+// SetParameterValueContext is like SetParameterValue, the context is passed
+// to the hooks.
+func (s *Simulator) SetParameterValueContext(ctx context.Context, path, value string) {
+	p, ok := s.dm.GetValue(path)
+	if !ok {
+		p = datamodel.Parameter{Path: path, Type: rpc.XSD(rpc.TypeString)}
+	}
+	p.Value = value
+	params := []datamodel.Parameter{p}
+	s.setValues(ctx, params)
+	s.parameterWriteHooks(ctx, params)
+}
+
+// ParameterValue returns the value of a datamodel parameter.
+func (s *Simulator) ParameterValue(path string) (string, bool) {
+	p, ok := s.dm.GetValue(path)
+	if !ok {
+		return "", false
+	}
+	return p.GetValue(), true
+}
+
+// DeleteParameter deletes a datamodel parameter or an object with all its
+// parameters.
+func (s *Simulator) DeleteParameter(path string) {
+	s.dm.DeleteObject(strings.TrimSuffix(path, ".") + ".")
+}
+
+// PendingTasks returns the list of tasks that will be processed after the
+// current or next session.
+func (s *Simulator) PendingTasks() []TaskInfo {
+	return s.tasks.list()
+}
+
+// PendingEvents returns the list of events that will be included in the next
+// Inform message.
+func (s *Simulator) PendingEvents() []string {
+	return s.dm.PendingEvents()
+}
+
+// Sessions returns recent sessions with the ACS, oldest first.
+func (s *Simulator) Sessions() []SessionInfo {
+	return s.sessions.list()
+}
+
+// QueueEvent adds an event to the next Inform message without starting a new
+// session.
+func (s *Simulator) QueueEvent(event string) {
+	s.addEvent(context.Background(), event)
+}
+
+// Errors returned by TriggerInform.
+var (
+	ErrNotRunning    = errors.New("device is not running")
+	ErrInformPending = errors.New("too many informs are already pending")
+)
+
+// TriggerInform makes the simulator start a new session with the ACS and
+// include the given events in the Inform message. It doesn't block, if too
+// many sessions are already pending ErrInformPending is returned and the
+// events are included in one of them.
+func (s *Simulator) TriggerInform(events ...string) error {
+	if len(events) == 0 {
+		return errors.New("no inform events provided")
+	}
+	if !s.running.Load() {
+		return ErrNotRunning
+	}
+	ctx := context.Background()
+	for _, evt := range events[:len(events)-1] {
+		s.addEvent(ctx, evt)
+	}
+	select {
+	case s.pendingEvents <- events[len(events)-1]:
+		return nil
+	default:
+		s.addEvent(ctx, events[len(events)-1])
+		return ErrInformPending
+	}
+}
+
+// GoOffline makes the simulator unreachable for the given time. It won't
+// inform and will reject connection requests until it gets back online.
+func (s *Simulator) GoOffline(dur time.Duration) {
+	s.schedule("Offline", func() taskFn {
+		s.goOffline(dur)
+		return nil
+	})
+}
+
+// Reboot makes the simulator reboot as if it was requested by the ACS.
+func (s *Simulator) Reboot(ctx context.Context) {
+	s.schedule("Reboot", s.rebootTask(ctx))
+}
+
+// FactoryReset makes the simulator reset to factory defaults as if it was
+// requested by the ACS.
+func (s *Simulator) FactoryReset(ctx context.Context) {
+	s.schedule("FactoryReset", s.factoryResetTask(ctx))
+}
+
+// InjectFault makes the simulator respond with a fault to the next ACS
+// request of the given method, e.g. SetParameterValues.
+func (s *Simulator) InjectFault(method string, code rpc.FaultCode) {
+	_ = s.faults.add(FaultRule{Method: method, Code: code}, true)
+}
+
+// WaitForRPC blocks until the ACS calls the given method, e.g. Reboot. Calls
+// made after the given time are taken into account, even if they were made
+// before this function was called.
+func (s *Simulator) WaitForRPC(ctx context.Context, method string, since time.Time) error {
+	for {
+		s.rpcLock.Lock()
+		last, notify := s.rpcs[method], s.rpcNotify
+		s.rpcLock.Unlock()
+		if !last.IsZero() && !last.Before(since) {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// schedule adds a task that will be processed as soon as possible, after the
+// current session if there is one.
+func (s *Simulator) schedule(name string, task taskFn) {
+	s.tasks.push(name, task)
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Simulator) recordRPC(method string) {
+	s.rpcLock.Lock()
+	defer s.rpcLock.Unlock()
+	s.rpcs[method] = time.Now()
+	close(s.rpcNotify)
+	s.rpcNotify = make(chan struct{})
+}
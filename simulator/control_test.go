@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestWaitForRPC(t *testing.T) {
+	t.Parallel()
+	s := New(newTestDataModel(t))
+
+	since := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- s.WaitForRPC(t.Context(), "Reboot", since) }()
+	s.recordRPC("GetParameterValues")
+	s.recordRPC("Reboot")
+	require.NoError(t, <-done)
+
+	// Calls made before the given time are ignored
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	err := s.WaitForRPC(ctx, "Reboot", time.Now().Add(time.Second))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestInjectFault(t *testing.T) {
+	t.Parallel()
+	s := New(newTestDataModel(t))
+
+	s.InjectFault("Reboot", rpc.FaultInternalError)
+	_, _, ok := s.faults.match(&rpc.EnvelopeDecoder{Body: rpc.BodyDecoder{GetRPCMethods: &rpc.EmptyPayload{}}})
+	assert.False(t, ok)
+	reboot := &rpc.EnvelopeDecoder{Body: rpc.BodyDecoder{Reboot: &rpc.RebootRequest{}}}
+	_, code, ok := s.faults.match(reboot)
+	assert.True(t, ok)
+	assert.Equal(t, rpc.FaultInternalError, code)
+
+	// Faults are only injected once
+	_, _, ok = s.faults.match(reboot)
+	assert.False(t, ok)
+	assert.Empty(t, s.FaultRules())
+}
+
+func TestSetParameterValueACSURL(t *testing.T) {
+	t.Parallel()
+	dm := newTestDataModel(t)
+	dm.SeedACSURL("http://old.example.com")
+	dm.SetBootstrapped(true)
+	s := New(dm)
+
+	s.SetParameterValue("ManagementServer.URL", "http://new.example.com")
+	assert.False(t, dm.IsBootstrapped())
+	tasks := s.PendingTasks()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Bootstrap", tasks[0].Name)
+
+	// Bootstrap task must not block when too many sessions are requested
+	for range cap(s.pendingEvents) {
+		s.pendingEvents <- rpc.EventConnectionRequest
+	}
+	s.processTasks(t.Context())
+	assert.Contains(t, s.PendingEvents(), rpc.EventBootstrap)
+}
+
+func TestTriggerInform(t *testing.T) {
+	t.Parallel()
+	s := New(newTestDataModel(t))
+
+	require.ErrorIs(t, s.TriggerInform(rpc.EventConnectionRequest), ErrNotRunning)
+	assert.Empty(t, s.PendingEvents())
+
+	s.running.Store(true)
+	for range cap(s.pendingEvents) {
+		require.NoError(t, s.TriggerInform(rpc.EventConnectionRequest))
+	}
+	// Events are included in one of the pending sessions
+	require.ErrorIs(t, s.TriggerInform(rpc.EventBoot, rpc.EventValueChange), ErrInformPending)
+	assert.Equal(t, []string{rpc.EventBoot, rpc.EventValueChange}, s.PendingEvents())
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/localhots/blip/noctx/log"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/localhots/SimulaTR69/rpc"
 )
@@ -23,7 +24,7 @@ func (s *Simulator) handleDownload(ctx context.Context, envID string, r *rpc.Dow
 	}
 	s.dm.SetCommandKey(r.CommandKey)
 
-	s.tasks <- func() taskFn {
+	s.tasks.push("Download", func() taskFn {
 		tcr := rpc.TransferCompleteRequestEncoder{
 			CommandKey: s.dm.CommandKey(),
 			StartTime:  time.Now().UTC().Format(time.RFC3339),
@@ -31,6 +32,14 @@ func (s *Simulator) handleDownload(ctx context.Context, envID string, r *rpc.Dow
 		}
 		err := s.upgradeFirmware(ctx, r)
 		tcr.CompleteTime = time.Now().UTC().Format(time.RFC3339)
+		outcome := "success"
+		if err != nil {
+			outcome = "failure"
+		}
+		s.metrics.Transfers.With(prometheus.Labels{
+			"file_type": r.FileType,
+			"outcome":   outcome,
+		}).Inc()
 		if err != nil {
 			tcr.Fault = &rpc.FaultStruct{
 				FaultCode:   rpc.FaultInternalError,
@@ -41,16 +50,16 @@ func (s *Simulator) handleDownload(ctx context.Context, envID string, r *rpc.Dow
 		s.pendingRequests <- func(env *rpc.EnvelopeEncoder) {
 			env.Body.TransferCompleteRequest = &tcr
 		}
-		s.pendingEvents <- rpc.EventTransferComplete
+		s.requestInform(ctx, rpc.EventTransferComplete)
 
 		return func() taskFn {
-			s.logger.Debug(ctx, "Simulating firmware upgrade", log.F{"delay": Config.UpgradeDelay})
-			s.pretendOfflineFor(Config.UpgradeDelay)
+			s.logger.Debug(ctx, "Simulating firmware upgrade", log.F{"delay": s.cfg.UpgradeDelay})
+			s.pretendOfflineFor(s.cfg.UpgradeDelay)
 			s.logger.Debug(ctx, "Starting up")
-			s.pendingEvents <- rpc.EventBoot
+			s.requestInform(ctx, rpc.EventBoot)
 			return nil
 		}
-	}
+	})
 
 	return resp
 }
@@ -12,20 +12,27 @@ func (s *Simulator) handleFactoryReset(ctx context.Context, envID string) *rpc.E
 	resp := rpc.NewEnvelope(envID)
 	resp.Body.FactoryResetResponse = &rpc.FactoryResetResponseEncoder{}
 
-	s.tasks <- func() taskFn {
-		s.logger.Debug(ctx, "Simulating factory reset", log.F{"delay": Config.UpgradeDelay})
-		s.pretendOfflineFor(Config.UpgradeDelay)
+	s.tasks.push("FactoryReset", s.factoryResetTask(ctx))
+	return resp
+}
+
+func (s *Simulator) factoryResetTask(ctx context.Context) taskFn {
+	return func() taskFn {
+		s.logger.Debug(ctx, "Simulating factory reset", log.F{"delay": s.cfg.UpgradeDelay})
+		s.pretendOfflineFor(s.cfg.UpgradeDelay)
 
 		s.dm.Reset()
 		s.dm.SetConnectionRequestURL(s.httpServer.url())
 		s.dm.SetUDPConnectionRequestAddress(s.udpServer.url())
-		if Config.SerialNumber != "" {
-			s.dm.SetSerialNumber(Config.SerialNumber)
+		if jid := s.xmppServer.url(); jid != "" {
+			s.dm.SetConnReqJabberID(jid)
+		}
+		if s.cfg.SerialNumber != "" {
+			s.dm.SetSerialNumber(s.cfg.SerialNumber)
 		}
 
 		s.logger.Debug(ctx, "Starting up")
-		s.pendingEvents <- rpc.EventBootstrap
+		s.requestInform(ctx, rpc.EventBootstrap)
 		return nil
 	}
-	return resp
 }
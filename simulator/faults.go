@@ -0,0 +1,275 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// FaultRule describes faults injected into responses to ACS requests, e.g.
+// "return 9002 for 10% of SetParameterValues requests".
+type FaultRule struct {
+	// Name identifies the rule, it is used to toggle the rule at runtime.
+	// Rules without a name are named after the method.
+	Name string `json:"name"`
+	// Method is the ACS request method, e.g. SetParameterValues.
+	Method string `json:"method"`
+	// Code is the fault code the simulator responds with.
+	Code rpc.FaultCode `json:"code"`
+	// Paths limits the rule to requests that reference at least one
+	// parameter matching any of the patterns, e.g. Device.WiFi.*. Patterns
+	// are matched using path.Match.
+	Paths []string `json:"paths,omitempty"`
+	// Probability of a matching request to be faulted, from 0 to 1. Zero
+	// means every matching request is faulted.
+	Probability float64 `json:"probability,omitempty"`
+	// Nth makes the rule fault only the Nth matching request.
+	Nth int `json:"nth,omitempty"`
+	// Limit is the maximum number of faults produced by the rule. Zero means
+	// there is no limit.
+	Limit int `json:"limit,omitempty"`
+	// Disabled rules are ignored until they are enabled at runtime.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// FaultRuleStatus describes a fault rule along with its stats.
+type FaultRuleStatus struct {
+	FaultRule
+	// Matched is the number of requests that matched the rule.
+	Matched int `json:"matched"`
+	// Faulted is the number of faults produced by the rule.
+	Faulted int `json:"faulted"`
+}
+
+// ErrFaultRuleNotFound is returned when a fault rule with the given name
+// doesn't exist.
+var ErrFaultRuleNotFound = errors.New("fault rule not found")
+
+// LoadFaultRules loads fault rules from a JSON file containing an array of
+// rules.
+func LoadFaultRules(filePath string) ([]FaultRule, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read fault rules: %w", err)
+	}
+	var rules []FaultRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parse fault rules: %w", err)
+	}
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("fault rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// WithFaultRules adds fault rules to the simulator. Invalid rules are
+// ignored, use LoadFaultRules or FaultRule.Validate to check them.
+func WithFaultRules(rules ...FaultRule) Option {
+	return func(s *Simulator) {
+		for _, r := range rules {
+			_ = s.faults.add(r, false)
+		}
+	}
+}
+
+// Validate checks the rule for errors.
+func (r FaultRule) Validate() error {
+	if r.Method == "" {
+		return errors.New("method is required")
+	}
+	if r.Code == 0 {
+		return errors.New("fault code is required")
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return errors.New("probability must be between 0 and 1")
+	}
+	if r.Nth < 0 || r.Limit < 0 {
+		return errors.New("nth and limit can't be negative")
+	}
+	for _, p := range r.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// FaultRules returns fault rules of the simulator.
+func (s *Simulator) FaultRules() []FaultRuleStatus {
+	return s.faults.list()
+}
+
+// AddFaultRule adds a fault rule to the simulator.
+func (s *Simulator) AddFaultRule(r FaultRule) error {
+	return s.faults.add(r, false)
+}
+
+// RemoveFaultRule removes a fault rule with the given name.
+func (s *Simulator) RemoveFaultRule(name string) error {
+	return s.faults.remove(name)
+}
+
+// SetFaultRuleEnabled enables or disables a fault rule with the given name.
+func (s *Simulator) SetFaultRuleEnabled(name string, enabled bool) error {
+	return s.faults.setEnabled(name, enabled)
+}
+
+// faultInjector matches ACS requests against fault rules.
+type faultInjector struct {
+	rules []*faultRule
+	seq   int
+	lock  sync.Mutex
+}
+
+type faultRule struct {
+	FaultRuleStatus
+	// once rules are removed after producing a fault.
+	once bool
+}
+
+func (f *faultInjector) add(r FaultRule, once bool) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.seq++
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("%s-%d", r.Method, f.seq)
+	}
+	if f.find(r.Name) >= 0 {
+		return fmt.Errorf("fault rule %q already exists", r.Name)
+	}
+	f.rules = append(f.rules, &faultRule{
+		FaultRuleStatus: FaultRuleStatus{FaultRule: r},
+		once:            once,
+	})
+	return nil
+}
+
+func (f *faultInjector) remove(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	i := f.find(name)
+	if i < 0 {
+		return ErrFaultRuleNotFound
+	}
+	f.rules = slices.Delete(f.rules, i, i+1)
+	return nil
+}
+
+func (f *faultInjector) setEnabled(name string, enabled bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	i := f.find(name)
+	if i < 0 {
+		return ErrFaultRuleNotFound
+	}
+	f.rules[i].Disabled = !enabled
+	return nil
+}
+
+func (f *faultInjector) list() []FaultRuleStatus {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rules := make([]FaultRuleStatus, 0, len(f.rules))
+	for _, r := range f.rules {
+		rules = append(rules, r.FaultRuleStatus)
+	}
+	return rules
+}
+
+// match returns the fault code of the first rule that faults the request.
+func (f *faultInjector) match(env *rpc.EnvelopeDecoder) (string, rpc.FaultCode, bool) {
+	method := env.Method()
+	var paths []string
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i, r := range f.rules {
+		if r.Disabled || r.Method != method {
+			continue
+		}
+		if len(r.Paths) > 0 {
+			if paths == nil {
+				paths = requestPaths(env)
+			}
+			if !matchAnyPath(r.Paths, paths) {
+				continue
+			}
+		}
+
+		r.Matched++
+		if r.Limit > 0 && r.Faulted >= r.Limit {
+			continue
+		}
+		if r.Nth > 0 && r.Matched != r.Nth {
+			continue
+		}
+		// It's fine to use non cryptographic randomness here.
+		//nolint:gosec
+		if r.Probability > 0 && rand.Float64() >= r.Probability {
+			continue
+		}
+
+		r.Faulted++
+		if r.once {
+			f.rules = slices.Delete(f.rules, i, i+1)
+		}
+		return r.Name, r.Code, true
+	}
+	return "", 0, false
+}
+
+func (f *faultInjector) find(name string) int {
+	return slices.IndexFunc(f.rules, func(r *faultRule) bool {
+		return r.Name == name
+	})
+}
+
+func matchAnyPath(patterns, paths []string) bool {
+	for _, pattern := range patterns {
+		for _, p := range paths {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestPaths returns parameter paths referenced by an ACS request.
+func requestPaths(env *rpc.EnvelopeDecoder) []string {
+	b := env.Body
+	var paths []string
+	switch {
+	case b.SetParameterValues != nil:
+		for _, p := range b.SetParameterValues.ParameterList.ParameterValues {
+			paths = append(paths, p.Name)
+		}
+	case b.GetParameterValues != nil:
+		paths = b.GetParameterValues.ParameterNames.Names
+	case b.GetParameterNames != nil:
+		paths = []string{b.GetParameterNames.ParameterPath}
+	case b.SetParameterAttributes != nil:
+		for _, p := range b.SetParameterAttributes.ParameterList.ParameterAttributes {
+			paths = append(paths, p.Name)
+		}
+	case b.GetParameterAttributes != nil:
+		paths = b.GetParameterAttributes.ParameterNames.Names
+	case b.AddObject != nil:
+		paths = []string{b.AddObject.ObjectName}
+	case b.DeleteObject != nil:
+		paths = []string{b.DeleteObject.ObjectName}
+	}
+	return paths
+}
@@ -0,0 +1,109 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestFaultRules(t *testing.T) {
+	t.Parallel()
+
+	gpv := func(names ...string) *rpc.EnvelopeDecoder {
+		env := &rpc.EnvelopeDecoder{}
+		env.Body.GetParameterValues = &rpc.GetParameterValuesRequest{}
+		env.Body.GetParameterValues.ParameterNames.Names = names
+		return env
+	}
+	download := &rpc.EnvelopeDecoder{Body: rpc.BodyDecoder{Download: &rpc.DownloadRequest{}}}
+	faulted := func(f *faultInjector, env *rpc.EnvelopeDecoder, n int) []bool {
+		res := make([]bool, n)
+		for i := range res {
+			_, _, res[i] = f.match(env)
+		}
+		return res
+	}
+
+	t.Run("paths", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{
+			Method: "GetParameterValues",
+			Code:   rpc.FaultInvalidParameterName,
+			Paths:  []string{"Device.WiFi.*"},
+		}, false))
+		_, _, ok := f.match(gpv("Device.DeviceInfo.SoftwareVersion"))
+		assert.False(t, ok)
+		_, code, ok := f.match(gpv("Device.DeviceInfo.", "Device.WiFi.SSID.1.SSID"))
+		assert.True(t, ok)
+		assert.Equal(t, rpc.FaultInvalidParameterName, code)
+		_, _, ok = f.match(download)
+		assert.False(t, ok)
+	})
+	t.Run("nth", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{Method: "Download", Code: rpc.FaultDownloadFailureAccessFile, Nth: 3}, false))
+		assert.Equal(t, []bool{false, false, true, false}, faulted(&f, download, 4))
+	})
+	t.Run("limit", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{Method: "Download", Code: rpc.FaultInternalError, Limit: 2}, false))
+		assert.Equal(t, []bool{true, true, false}, faulted(&f, download, 3))
+		assert.Equal(t, 3, f.list()[0].Matched)
+		assert.Equal(t, 2, f.list()[0].Faulted)
+	})
+	t.Run("probability", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{Method: "Download", Code: rpc.FaultInternalError, Probability: 0.1}, false))
+		n := 0
+		for _, ok := range faulted(&f, download, 10000) {
+			if ok {
+				n++
+			}
+		}
+		assert.InDelta(t, 1000, n, 200)
+	})
+	t.Run("toggle", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{Name: "dl", Method: "Download", Code: rpc.FaultInternalError, Disabled: true}, false))
+		assert.Equal(t, []bool{false}, faulted(&f, download, 1))
+		require.NoError(t, f.setEnabled("dl", true))
+		assert.Equal(t, []bool{true}, faulted(&f, download, 1))
+		require.NoError(t, f.remove("dl"))
+		assert.Equal(t, []bool{false}, faulted(&f, download, 1))
+		assert.ErrorIs(t, f.setEnabled("dl", true), ErrFaultRuleNotFound)
+	})
+	t.Run("names", func(t *testing.T) {
+		var f faultInjector
+		require.NoError(t, f.add(FaultRule{Method: "Download", Code: rpc.FaultInternalError}, false))
+		require.NoError(t, f.add(FaultRule{Name: "dl", Method: "Download", Code: rpc.FaultInternalError}, false))
+		require.Error(t, f.add(FaultRule{Name: "dl", Method: "Download", Code: rpc.FaultInternalError}, false))
+		assert.Equal(t, "Download-1", f.list()[0].Name)
+	})
+}
+
+func TestLoadFaultRules(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "faults.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"method": "SetParameterValues", "code": 9002, "probability": 0.1},
+		{"name": "wifi", "method": "GetParameterValues", "code": 9005, "paths": ["Device.WiFi.*"]},
+		{"method": "Download", "code": 9016, "nth": 2, "disabled": true}
+	]`), 0o600))
+	rules, err := LoadFaultRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, rpc.FaultInternalError, rules[0].Code)
+	assert.Equal(t, []string{"Device.WiFi.*"}, rules[1].Paths)
+	assert.True(t, rules[2].Disabled)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"method": "Download", "code": 9016, "probability": 2}]`), 0o600))
+	_, err = LoadFaultRules(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,246 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/localhots/blip"
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+)
+
+// Fleet manages the lifecycle of multiple simulated devices that share the
+// same datamodel.
+type Fleet struct {
+	sims     []*Simulator
+	started  []*Simulator
+	rampUp   rampUpFn
+	lock     sync.Mutex
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+// templatePlaceholder matches placeholders like {d} or {04d}.
+var templatePlaceholder = regexp.MustCompile(`\{(0?\d*[dxX])\}`)
+
+// xmppIdentity matches parameters that identify a device to the XMPP server
+// and the ACS.
+var xmppIdentity = regexp.MustCompile(`(\.XMPP\.Connection\.\d+\.(Username|Resource)|\.ConnReqJabberID)$`)
+
+// NewFleet creates a fleet of cfg.FleetSize devices that share the given
+// default parameters. Device specific settings are derived from the config,
+// options are applied to every device.
+func NewFleet(cfg Config, defaults *datamodel.Defaults, opts ...Option) (*Fleet, error) {
+	rampUp, err := newRampUp(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fleet{
+		sims:   make([]*Simulator, 0, cfg.FleetSize),
+		rampUp: rampUp,
+		quit:   make(chan struct{}),
+	}
+	for i := range cfg.FleetSize {
+		s, err := newFleetDevice(cfg, defaults, i, opts)
+		if err != nil {
+			return nil, err
+		}
+		f.sims = append(f.sims, s)
+	}
+	return f, nil
+}
+
+func newFleetDevice(cfg Config, defaults *datamodel.Defaults, i int, opts []Option) (*Simulator, error) {
+	idx := cfg.FleetStartIndex + i
+	cfg.SerialNumber = expandTemplate(cfg.SerialNumber, idx)
+	cfg.StateFilePath = expandTemplate(cfg.StateFilePath, idx)
+	if cfg.FleetStateDir != "" {
+		cfg.StateFilePath = filepath.Join(cfg.FleetStateDir, cfg.SerialNumber+".json")
+	}
+	cfg.ConnReqPath = expandTemplate(cfg.ConnReqPath, idx)
+	// Port 0 means that every device picks a random port
+	if cfg.Port != 0 {
+		port := int(cfg.Port) + i
+		if port > math.MaxUint16 {
+			return nil, fmt.Errorf("connection request port for device %s is out of range: %d", cfg.SerialNumber, port)
+		}
+		cfg.Port = uint16(port)
+	}
+	if n := len(cfg.FleetSourceIPs); n > 0 {
+		cfg.SourceIP = strings.TrimSpace(cfg.FleetSourceIPs[i%n])
+	}
+
+	state, err := datamodel.LoadState(cfg.StateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("load state for device %s: %w", cfg.SerialNumber, err)
+	}
+	dm := datamodel.New(state.WithSharedDefaults(defaults))
+	dm.SetSerialNumber(cfg.SerialNumber)
+	if err := seedMACAddresses(dm, idx); err != nil {
+		return nil, fmt.Errorf("derive MAC addresses for device %s: %w", cfg.SerialNumber, err)
+	}
+	seedXMPPIdentity(dm, idx, cfg.SerialNumber)
+
+	return New(dm, append(slices.Clone(opts), WithConfig(cfg))...), nil
+}
+
+// Simulators returns all devices in the fleet.
+func (f *Fleet) Simulators() []*Simulator {
+	return f.sims
+}
+
+// Start starts all devices in the fleet following the configured ramp-up
+// schedule. It blocks until all devices are started or the fleet is stopped.
+// If any device fails to start the devices that were already started are
+// stopped.
+func (f *Fleet) Start(ctx context.Context) error {
+	startedAt := time.Now()
+	for i, s := range f.sims {
+		if delay := time.Until(startedAt.Add(f.rampUp(i, len(f.sims)))); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-f.quit:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := f.startDevice(ctx, s); err != nil {
+			return errors.Join(err, f.Stop(ctx))
+		}
+	}
+	return nil
+}
+
+func (f *Fleet) startDevice(ctx context.Context, s *Simulator) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// Fleet could be stopped while waiting for the lock
+	select {
+	case <-f.quit:
+		return nil
+	default:
+	}
+
+	dctx := blip.ContextWithFields(ctx, log.F{"serial_number": s.cfg.SerialNumber})
+	if err := s.Start(dctx); err != nil {
+		return fmt.Errorf("start device %s: %w", s.cfg.SerialNumber, err)
+	}
+	f.started = append(f.started, s)
+	return nil
+}
+
+// Stop stops all started devices in the fleet and saves their state. Devices
+// that are waiting to be started won't be started.
+func (f *Fleet) Stop(ctx context.Context) error {
+	f.quitOnce.Do(func() { close(f.quit) })
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.stop(ctx)
+}
+
+func (f *Fleet) stop(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(f.started))
+	for i, s := range f.started {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Stop(ctx); err != nil {
+				errs[i] = fmt.Errorf("stop device %s: %w", s.cfg.SerialNumber, err)
+			}
+		}()
+	}
+	wg.Wait()
+	f.started = nil
+	return errors.Join(errs...)
+}
+
+// expandTemplate replaces placeholders such as {04d} in the template with the
+// index formatted using the verb inside the braces.
+func expandTemplate(tmpl string, idx int) string {
+	return templatePlaceholder.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		return fmt.Sprintf("%"+ph[1:len(ph)-1], idx)
+	})
+}
+
+func hasPlaceholder(tmpl string) bool {
+	return templatePlaceholder.MatchString(tmpl)
+}
+
+// seedMACAddresses makes MAC addresses unique for each device by adding the
+// device index to the lower 24 bits of every MAC address in the datamodel.
+// The OUI part of the address is preserved.
+func seedMACAddresses(dm *datamodel.DataModel, idx int) error {
+	seeds := map[string]string{}
+	var err error
+	dm.Each(func(p datamodel.Parameter) bool {
+		if !strings.HasSuffix(p.Path, "MACAddress") || p.Value == "" {
+			return true
+		}
+		var mac string
+		mac, err = offsetMAC(p.Value, idx)
+		if err != nil {
+			err = fmt.Errorf("parse %s: %w", p.Path, err)
+			return false
+		}
+		seeds[p.Path] = mac
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for path, mac := range seeds {
+		dm.SeedValue(path, mac)
+	}
+	return nil
+}
+
+// seedXMPPIdentity makes XMPP identities unique for each device. XMPP
+// usernames, resources and the connection request Jabber ID are expanded if
+// they are templates. A resource that is not a template is replaced with the
+// serial number, so that devices that share an account get different Jabber
+// IDs and don't kick each other off the server.
+func seedXMPPIdentity(dm *datamodel.DataModel, idx int, serial string) {
+	seeds := map[string]string{}
+	dm.Each(func(p datamodel.Parameter) bool {
+		if !xmppIdentity.MatchString(p.Path) || p.Value == "" {
+			return true
+		}
+		switch {
+		case hasPlaceholder(p.Value):
+			seeds[p.Path] = expandTemplate(p.Value, idx)
+		case p.Name() == "Resource":
+			seeds[p.Path] = serial
+		}
+		return true
+	})
+	for path, val := range seeds {
+		dm.SeedValue(path, val)
+	}
+}
+
+func offsetMAC(mac string, offset int) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	if len(hw) != 6 {
+		return "", fmt.Errorf("unsupported MAC address length: %s", mac)
+	}
+	nic := (int(hw[3])<<16 | int(hw[4])<<8 | int(hw[5])) + offset
+	hw[3], hw[4], hw[5] = byte(nic>>16), byte(nic>>8), byte(nic)
+	return hw.String(), nil
+}
@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+)
+
+const testFleetDM = `Parameter,Object,Writable,Value,Type
+Device.DeviceInfo.SerialNumber,false,false,,xsd:string
+Device.Ethernet.Interface.1.MACAddress,false,false,00:1a:2b:ff:ff:fe,xsd:string
+Device.XMPP.Connection.1.Username,false,true,cpe-{03d},xsd:string
+Device.XMPP.Connection.1.Resource,false,true,sim,xsd:string
+Device.XMPP.Connection.2.Username,false,true,shared,xsd:string
+Device.XMPP.Connection.2.Resource,false,true,,xsd:string
+Device.Stats.Counter,false,false,"trendWithNoise(startValue=0, step=1, noiseScale=0) as xsd:int",sim:generator
+`
+
+func TestExpandTemplate(t *testing.T) {
+	assert.Equal(t, "SIM-0007", expandTemplate("SIM-{04d}", 7))
+	assert.Equal(t, "SIM-7", expandTemplate("SIM-{d}", 7))
+	assert.Equal(t, "/cr/00ff/ff", expandTemplate("/cr/{04x}/{x}", 255))
+	assert.Equal(t, "SIM-{s}", expandTemplate("SIM-{s}", 7))
+	assert.False(t, hasPlaceholder("SIM-0001"))
+}
+
+func TestOffsetMAC(t *testing.T) {
+	mac, err := offsetMAC("00:1a:2b:00:00:01", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:00:00:02", mac)
+
+	// Overflow must not change the OUI
+	mac, err = offsetMAC("00:1a:2b:ff:ff:ff", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "00:1a:2b:00:00:00", mac)
+
+	_, err = offsetMAC("foo", 1)
+	require.Error(t, err)
+}
+
+func TestNewFleet(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.FleetSize = 3
+	cfg.FleetStateDir = dir
+	cfg.FleetSourceIPs = []string{"127.0.0.1", "127.0.0.2"}
+	cfg.SerialNumber = "SIM-{04d}"
+	cfg.ConnReqPath = "/cwmp/{d}"
+	defaults, err := datamodel.LoadDataModel(strings.NewReader(testFleetDM))
+	require.NoError(t, err)
+
+	f, err := NewFleet(cfg, datamodel.NewDefaults(defaults))
+	require.NoError(t, err)
+	sims := f.Simulators()
+	require.Len(t, sims, 3)
+
+	for i, exp := range []struct {
+		serial   string
+		mac      string
+		port     uint16
+		path     string
+		sourceIP string
+	}{
+		{"SIM-0001", "00:1a:2b:ff:ff:ff", 7547, "/cwmp/1", "127.0.0.1"},
+		{"SIM-0002", "00:1a:2b:00:00:00", 7548, "/cwmp/2", "127.0.0.2"},
+		{"SIM-0003", "00:1a:2b:00:00:01", 7549, "/cwmp/3", "127.0.0.1"},
+	} {
+		s := sims[i]
+		assert.Equal(t, exp.serial, s.dm.DeviceID().SerialNumber)
+		mac, _ := s.dm.GetValue("Device.Ethernet.Interface.1.MACAddress")
+		assert.Equal(t, exp.mac, mac.GetValue())
+		assert.Equal(t, exp.port, s.cfg.Port)
+		assert.Equal(t, exp.path, s.cfg.ConnReqPath)
+		assert.Equal(t, exp.sourceIP, s.cfg.SourceIP)
+		assert.Equal(t, filepath.Join(dir, exp.serial+".json"), s.cfg.StateFilePath)
+
+		conn, ok := s.dm.XMPPConnection("Device.XMPP.Connection.1")
+		require.True(t, ok)
+		assert.Equal(t, expandTemplate("cpe-{03d}", i+1), conn.Username)
+		assert.Equal(t, exp.serial, conn.Resource)
+		conn, ok = s.dm.XMPPConnection("Device.XMPP.Connection.2")
+		require.True(t, ok)
+		assert.Equal(t, "shared", conn.Username)
+		assert.Empty(t, conn.Resource)
+	}
+
+	// Generators must not be shared between devices
+	counter := func(s *Simulator) string {
+		p, _ := s.dm.GetValue("Device.Stats.Counter")
+		return p.GetValue()
+	}
+	counter(sims[0])
+	assert.Equal(t, "2", counter(sims[0]))
+	assert.Equal(t, "1", counter(sims[1]))
+}
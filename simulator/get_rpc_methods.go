@@ -10,7 +10,7 @@ import (
 
 func (s *Simulator) handleGetRPCMethods(ctx context.Context, envID string) *rpc.EnvelopeEncoder {
 	s.logger.Info(ctx, "Received message", log.F{"method": "GetRPCMethods"})
-	methods := rpc.SupportedMethods()
+	methods := append(rpc.SupportedMethods(), s.vendorMethods()...)
 	for _, m := range methods {
 		s.logger.Debug(ctx, "GetRPCMethodsResponse", log.F{"method": m})
 	}
@@ -0,0 +1,47 @@
+package simulator
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// SessionInfo describes a session with the ACS.
+type SessionInfo struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ACSURL     string    `json:"acs_url"`
+	Events     []string  `json:"events"`
+	// Messages is the list of messages exchanged with the ACS in order.
+	Messages []string `json:"messages"`
+	// Violations are deviations of ACS messages from the CWMP schema rules,
+	// reported in strict decoding mode.
+	Violations []rpc.Violation `json:"violations,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// sessionHistorySize is the number of recent sessions kept in history.
+const sessionHistorySize = 20
+
+// sessionHistory keeps a limited number of recent sessions.
+type sessionHistory struct {
+	sessions []SessionInfo
+	lock     sync.Mutex
+}
+
+func (h *sessionHistory) add(info SessionInfo) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.sessions) == sessionHistorySize {
+		h.sessions = slices.Delete(h.sessions, 0, 1)
+	}
+	h.sessions = append(h.sessions, info)
+}
+
+func (h *sessionHistory) list() []SessionInfo {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return slices.Clone(h.sessions)
+}
@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// Hooks are functions called by the simulator at certain points of its
+// lifecycle. They allow embedding code to add custom behavior and assertions.
+// Any of the hooks can be nil. Hooks may be called concurrently and must not
+// block.
+type Hooks struct {
+	// BeforeRPC is called before an ACS request is handled. The request can
+	// be modified. If a response is returned, request handling is skipped and
+	// the response is sent to the ACS.
+	BeforeRPC func(ctx context.Context, s *Simulator, req *rpc.EnvelopeDecoder) *rpc.EnvelopeEncoder
+	// AfterRPC is called after an ACS request is handled. It returns the
+	// response that is sent to the ACS, which may be modified or replaced.
+	// Response is nil if there is nothing to send.
+	AfterRPC func(ctx context.Context, s *Simulator, req *rpc.EnvelopeDecoder, resp *rpc.EnvelopeEncoder) *rpc.EnvelopeEncoder
+	// SessionStart is called when a session with the ACS is started.
+	SessionStart func(ctx context.Context, s *Simulator, info SessionInfo)
+	// SessionEnd is called when a session with the ACS is over.
+	SessionEnd func(ctx context.Context, s *Simulator, info SessionInfo)
+	// ParameterWrite is called after parameter values are changed by the ACS
+	// or using the control API.
+	ParameterWrite func(ctx context.Context, s *Simulator, params []datamodel.Parameter)
+	// EventQueued is called when an event is queued for the next Inform.
+	EventQueued func(ctx context.Context, s *Simulator, event string)
+	// TaskRun is called before a task is run.
+	TaskRun func(ctx context.Context, s *Simulator, name string)
+}
+
+// WithHooks adds hooks to the simulator. Hooks added with multiple options
+// are chained and called in the order they were added. The first BeforeRPC
+// hook that returns a response stops the chain, AfterRPC hooks are called
+// for every response, each getting the response returned by the previous
+// one.
+func WithHooks(h Hooks) Option {
+	return func(s *Simulator) {
+		s.hooks = append(s.hooks, h)
+	}
+}
+
+// handleEnvelopeWithHooks handles an ACS request and wraps it with RPC hooks.
+// Requests answered by a hook are counted as received too.
+func (s *Simulator) handleEnvelopeWithHooks(ctx context.Context, env *rpc.EnvelopeDecoder) *rpc.EnvelopeEncoder {
+	method := s.methodName(env)
+	s.metrics.MethodCalls.With(prometheus.Labels{"method": method}).Inc()
+	s.recordRPC(method)
+
+	var resp *rpc.EnvelopeEncoder
+	for _, h := range s.hooks {
+		if h.BeforeRPC != nil {
+			if resp = h.BeforeRPC(ctx, s, env); resp != nil {
+				break
+			}
+		}
+	}
+	if resp == nil {
+		resp = s.handleEnvelope(ctx, env)
+	}
+	for _, h := range s.hooks {
+		if h.AfterRPC != nil {
+			resp = h.AfterRPC(ctx, s, env, resp)
+		}
+	}
+	return resp
+}
+
+func (s *Simulator) sessionStartHooks(ctx context.Context, info SessionInfo) {
+	for _, h := range s.hooks {
+		if h.SessionStart != nil {
+			h.SessionStart(ctx, s, info)
+		}
+	}
+}
+
+func (s *Simulator) sessionEndHooks(ctx context.Context, info SessionInfo) {
+	for _, h := range s.hooks {
+		if h.SessionEnd != nil {
+			h.SessionEnd(ctx, s, info)
+		}
+	}
+}
+
+func (s *Simulator) parameterWriteHooks(ctx context.Context, params []datamodel.Parameter) {
+	for _, h := range s.hooks {
+		if h.ParameterWrite != nil {
+			h.ParameterWrite(ctx, s, params)
+		}
+	}
+}
+
+func (s *Simulator) taskRunHooks(ctx context.Context, name string) {
+	for _, h := range s.hooks {
+		if h.TaskRun != nil {
+			h.TaskRun(ctx, s, name)
+		}
+	}
+}
+
+// addEvent queues an event for the next Inform.
+func (s *Simulator) addEvent(ctx context.Context, evt string) {
+	s.dm.AddEvent(evt)
+	for _, h := range s.hooks {
+		if h.EventQueued != nil {
+			h.EventQueued(ctx, s, evt)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+
+	const code = "Device.DeviceInfo.ProvisioningCode"
+	var (
+		received []*rpc.EnvelopeDecoder
+		requests int
+	)
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var env *rpc.EnvelopeEncoder
+		if len(b) > 0 {
+			dec, err := rpc.Decode(b)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, dec)
+		}
+		requests++
+		switch requests {
+		case 1:
+			env = rpc.NewEnvelope("1")
+			env.Body.InformResponse = &rpc.InformResponseEncoder{MaxEnvelopes: rpc.MaxEnvelopes}
+		case 2:
+			env = rpc.NewEnvelope("2")
+			env.Body.SetParameterValues = &rpc.SetParameterValuesRequestEncoder{
+				ParameterList: rpc.ParameterListEncoder{
+					ArrayType:       rpc.ArrayType("cwmp:ParameterValueStruct", 1),
+					ParameterValues: []rpc.ParameterValueEncoder{{Name: code, Value: rpc.StringValue("hooked")}},
+				},
+			}
+		case 3:
+			env = rpc.NewEnvelope("3")
+			env.Body.Reboot = &rpc.RebootRequestEncoder{CommandKey: "hooked"}
+		default:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		b, _ = env.Encode()
+		_, _ = w.Write(b)
+	}))
+	defer acs.Close()
+
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	dm := datamodel.New(state.WithDefaults(map[string]datamodel.Parameter{
+		code: {Path: code, Type: "xsd:string", Writable: true},
+	}))
+	dm.SeedACSURL(acs.URL)
+
+	var (
+		calls []string
+		lock  sync.Mutex
+	)
+	call := func(name string) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls = append(calls, name)
+	}
+	s := New(dm,
+		WithHooks(Hooks{
+			BeforeRPC: func(_ context.Context, _ *Simulator, req *rpc.EnvelopeDecoder) *rpc.EnvelopeEncoder {
+				call("before " + req.Method())
+				if req.Body.Reboot != nil {
+					return rpc.NewEnvelope(req.Header.ID.Value).WithFault(rpc.FaultRequestDenied)
+				}
+				return nil
+			},
+			AfterRPC: func(_ context.Context, _ *Simulator, req *rpc.EnvelopeDecoder, resp *rpc.EnvelopeEncoder) *rpc.EnvelopeEncoder {
+				call("after " + req.Method() + " " + resp.Method())
+				if resp.Body.SetParameterValuesResponse != nil {
+					resp.Body.SetParameterValuesResponse.Status = 1
+				}
+				return resp
+			},
+			SessionStart: func(_ context.Context, _ *Simulator, info SessionInfo) {
+				call("session start " + info.Events[0])
+			},
+			SessionEnd: func(_ context.Context, _ *Simulator, info SessionInfo) {
+				call("session end " + info.Messages[len(info.Messages)-1])
+			},
+			ParameterWrite: func(_ context.Context, _ *Simulator, params []datamodel.Parameter) {
+				call("write " + params[0].Path + "=" + params[0].Value)
+			},
+			EventQueued: func(_ context.Context, _ *Simulator, event string) {
+				call("event " + event)
+			},
+			TaskRun: func(_ context.Context, _ *Simulator, name string) {
+				call("task " + name)
+			},
+		}),
+		// Second chain link only observes
+		WithHooks(Hooks{
+			AfterRPC: func(_ context.Context, _ *Simulator, _ *rpc.EnvelopeDecoder, resp *rpc.EnvelopeEncoder) *rpc.EnvelopeEncoder {
+				call("observe " + resp.Method())
+				return resp
+			},
+		}),
+	)
+
+	s.running.Store(true)
+	require.NoError(t, s.TriggerInform(rpc.EventBoot, rpc.EventConnectionRequest))
+	s.addEvent(t.Context(), <-s.pendingEvents)
+	since := time.Now()
+	s.startSession(t.Context(), s.informHandler)
+	// Requests answered by hooks are still recorded
+	require.NoError(t, s.WaitForRPC(t.Context(), "Reboot", since))
+	s.SetParameterValue(code, "manual")
+	s.tasks.push("Test", func() taskFn { return nil })
+	s.processTasks(t.Context())
+
+	assert.Equal(t, []string{
+		"event " + rpc.EventBoot,
+		"event " + rpc.EventConnectionRequest,
+		"session start " + rpc.EventBoot,
+		"before SetParameterValues",
+		"write " + code + "=hooked",
+		"after SetParameterValues SetParameterValuesResponse",
+		"observe SetParameterValuesResponse",
+		"before Reboot",
+		"after Reboot Fault",
+		"observe Fault",
+		"session end Fault",
+		"write " + code + "=manual",
+		"task Test",
+	}, calls)
+
+	require.Len(t, received, 3)
+	require.NotNil(t, received[1].Body.SetParameterValuesResponse)
+	assert.Equal(t, 1, received[1].Body.SetParameterValuesResponse.Status)
+	require.NotNil(t, received[2].Body.Fault)
+	assert.Equal(t, rpc.FaultRequestDenied, received[2].Body.Fault.Detail.Fault.FaultCode)
+}
@@ -3,28 +3,63 @@ package simulator
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"slices"
+	"sync/atomic"
 	"time"
 
-	"github.com/icholy/digest"
 	"github.com/localhots/blip"
 	"github.com/localhots/blip/noctx/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/localhots/SimulaTR69/recording"
 	"github.com/localhots/SimulaTR69/rpc"
 )
 
 type (
-	sessionHandler func(ctx context.Context, client *http.Client)
+	sessionHandler func(ctx context.Context, sess *session)
 	taskFn         func() taskFn
 )
 
+// session holds the state of a single session with the ACS.
+type session struct {
+	client *http.Client
+	// acsURL is the ACS URL at the moment the session was started. Changes
+	// made to the ACS URL during the session only affect next sessions.
+	// Redirects change the URL for the remainder of the session.
+	acsURL    string
+	redirects int
+	// id is the sequence number of the session.
+	id int
+	// info is added to the session history once the session is over.
+	info SessionInfo
+}
+
+// Session termination reasons.
+const (
+	sessionCompleted        = "completed"
+	sessionInvalidACSURL    = "invalid_acs_url"
+	sessionConnectionFailed = "connection_failed"
+	sessionInformFailed     = "inform_failed"
+	sessionRequestFailed    = "request_failed"
+	sessionTimeout          = "timeout"
+)
+
+// maxRedirects is the maximum number of redirects allowed per session, as
+// defined in TR-069 section 3.4.5.
+const maxRedirects = 5
+
 func (s *Simulator) periodicInform(ctx context.Context) {
 	for !s.stopped() {
 		if !s.dm.PeriodicInformEnabled() {
@@ -36,75 +71,122 @@ func (s *Simulator) periodicInform(ctx context.Context) {
 			"delay": delay.Truncate(time.Millisecond).String(),
 		})
 
+		// Tasks that follow a session become a part of its trace
+		taskCtx := ctx
 		select {
 		case <-time.After(delay):
-			s.dm.AddEvent(rpc.EventPeriodic)
-			s.startSession(ctx, s.informHandler)
+			s.addEvent(ctx, rpc.EventPeriodic)
+			taskCtx = s.startSession(ctx, s.informHandler)
 		case evt := <-s.pendingEvents:
-			s.dm.AddEvent(evt)
-			s.startSession(ctx, s.informHandler)
+			s.addEvent(ctx, evt)
+			taskCtx = s.startSession(ctx, s.informHandler)
+		case <-s.wakeup:
+			// Tasks scheduled outside of a session are processed below
 		case <-s.stop:
 			return
 		}
 
 		// Run all available tasks after session is finished
 		s.logger.Debug(ctx, "Start processing tasks")
-		s.processTasks()
+		s.processTasks(taskCtx)
 		s.logger.Debug(ctx, "Finished processing tasks")
 	}
 }
 
 func (s *Simulator) nextInformTime() time.Time {
-	return calcInformTime(
+	next := calcInformTime(
 		s.dm.PeriodicInformTime(),
 		s.startedAt,
 		time.Now(),
 		s.dm.PeriodicInformEnabled(),
 		s.dm.PeriodicInformInterval(),
 	)
+	if s.cfg.InformJitter > 0 {
+		// It's fine to use non cryptographic randomness here.
+		//nolint:gosec
+		next = next.Add(time.Duration(rand.Int63n(int64(s.cfg.InformJitter))))
+	}
+	return next
 }
 
-// startSession initiates a new session with the ACS.
-func (s *Simulator) startSession(ctx context.Context, handler sessionHandler) {
+// startSession initiates a new session with the ACS. It returns a context
+// that carries the session span.
+func (s *Simulator) startSession(ctx context.Context, handler sessionHandler) context.Context {
 	if s.stopped() {
-		return
+		return ctx
 	}
 
 	// Allow only one session at a time
 	if ok := s.sessionMux.TryLock(); !ok {
 		s.logger.Warn(ctx, "Session in progress, dropping request")
-		return
+		return ctx
 	}
 	defer s.sessionMux.Unlock()
 
 	s.metrics.SessionsAttempted.Inc()
-	u, err := url.Parse(Config.ACSURL)
+	acsURL := s.dm.ACSURL()
+	ctx, span := s.tracer.Start(ctx, "cwmp.session", trace.WithAttributes(
+		attrSerialNumber.String(s.dm.DeviceID().SerialNumber),
+		attrACSURL.String(acsURL),
+	))
+	defer span.End()
+	s.sessionSeq++
+	sess := &session{
+		id:     s.sessionSeq,
+		acsURL: acsURL,
+		info: SessionInfo{
+			StartedAt: time.Now(),
+			ACSURL:    acsURL,
+			Events:    slices.Clone(s.dm.PendingEvents()),
+		},
+	}
+	s.sessionStartHooks(ctx, sess.info)
+	defer func() {
+		sess.info.FinishedAt = time.Now()
+		s.sessions.add(sess.info)
+		s.sessionEndHooks(ctx, sess.info)
+	}()
+
+	u, err := url.Parse(acsURL)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to parse ACS URL", log.Cause(err))
-		return
+		sess.info.Error = err.Error()
+		s.endSession(ctx, sessionInvalidACSURL, err)
+		return ctx
 	}
 
-	s.logger.Info(ctx, "Connecting to ACS", log.F{"acs_url": Config.ACSURL})
+	s.logger.Info(ctx, "Connecting to ACS", log.F{"acs_url": acsURL})
 	connectionStartTime := time.Now()
-	client, closeFn, err := newClient(u.Hostname(), tcpPort(u))
+	_, connSpan := s.tracer.Start(ctx, "cwmp.connect")
+	client, closeFn, err := newClient(u, s.clientOpts)
+	endSpan(connSpan, err)
 	s.metrics.ConnectionLatency.Observe(float64(time.Since(connectionStartTime).Milliseconds()))
 	if err != nil {
 		s.logger.Error(ctx, "Failed to connect to ACS", log.Cause(err))
 		s.metrics.RequestFailures.Inc()
 		s.dm.IncrRetryAttempts()
-		return
+		sess.info.Error = err.Error()
+		s.endSession(ctx, sessionConnectionFailed, err)
+		return ctx
 	}
 	defer func() { _ = closeFn() }()
 
 	s.metrics.SessionsEstablished.Inc()
-	handler(ctx, &client)
+	sess.client = client
+	handler(ctx, sess)
+	return ctx
 }
 
-func (s *Simulator) informHandler(ctx context.Context, client *http.Client) {
+func (s *Simulator) informHandler(ctx context.Context, sess *session) {
 	s.logger.Info(ctx, "Starting inform")
 	informEnv := s.makeInformEnvelope()
 
 	evt := informEnv.Body.Inform.Event.Events[0]
+	eventCodes := make([]string, 0, len(informEnv.Body.Inform.Event.Events))
+	for _, e := range informEnv.Body.Inform.Event.Events {
+		eventCodes = append(eventCodes, e.EventCode)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrEvents.StringSlice(eventCodes))
 	startedAt := time.Now()
 	s.metrics.ConcurrentSessions.Inc()
 	s.metrics.InformEvents.With(prometheus.Labels{"event": evt.EventCode}).Inc()
@@ -115,11 +197,13 @@ func (s *Simulator) informHandler(ctx context.Context, client *http.Client) {
 		}).Observe(float64(time.Since(startedAt).Milliseconds()))
 	}()
 
-	_, err := s.send(ctx, client, informEnv)
+	s.metrics.InformRetries.Observe(float64(informEnv.Body.Inform.RetryCount))
+	_, err := s.send(ctx, sess, informEnv)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to send inform request", log.Cause(err))
 		s.metrics.RequestFailures.Inc()
 		s.dm.IncrRetryAttempts()
+		s.endSession(ctx, sessionInformFailed, err)
 		return
 	}
 
@@ -133,22 +217,27 @@ pendingRequests:
 			env := s.newEnvelope()
 			envelopeBuilder(env)
 
-			acsResponseEnv, err := s.send(ctx, client, env)
+			acsResponseEnv, err := s.send(ctx, sess, env)
 			if err != nil {
 				s.logger.Error(ctx, "Failed to make request", log.Cause(err))
 				s.metrics.RequestFailures.Inc()
+				s.endSession(ctx, sessionRequestFailed, err)
 				return
 			}
-			nextEnv = s.handleEnvelope(ctx, acsResponseEnv)
+			nextEnv = s.handleRPC(ctx, acsResponseEnv)
 		default:
 			break pendingRequests
 		}
 	}
 	for {
-		acsRequestEnv, err := s.send(ctx, client, nextEnv)
+		if nextEnv == nil && s.rollChaos(ctx, ChaosSkipEmptyPost) {
+			break
+		}
+		acsRequestEnv, err := s.send(ctx, sess, nextEnv)
 		if err != nil {
 			s.logger.Error(ctx, "Failed to make request", log.Cause(err))
 			s.metrics.RequestFailures.Inc()
+			s.endSession(ctx, sessionRequestFailed, err)
 			return
 		}
 		if acsRequestEnv == nil {
@@ -156,15 +245,18 @@ pendingRequests:
 			break
 		}
 
-		nextEnv = s.handleEnvelope(ctx, acsRequestEnv)
+		nextEnv = s.handleRPC(ctx, acsRequestEnv)
 		if nextEnv == nil {
 			break
 		}
 	}
 
 	s.metrics.SessionsCompleted.Inc()
+	s.endSession(ctx, sessionCompleted, nil)
 	for _, evt := range informEnv.Body.Inform.Event.Events {
-		if evt.EventCode == rpc.EventBootstrap {
+		// Bootstrap is only complete if the ACS URL wasn't changed during
+		// the session, otherwise the new ACS should be bootstrapped
+		if evt.EventCode == rpc.EventBootstrap && s.dm.ACSURL() == sess.acsURL {
 			s.dm.SetBootstrapped(true)
 			s.metrics.Bootstrapped.Inc()
 			break
@@ -172,19 +264,91 @@ pendingRequests:
 	}
 }
 
-func (s *Simulator) send(ctx context.Context, client *http.Client, env *rpc.EnvelopeEncoder) (*rpc.EnvelopeDecoder, error) {
+// send sends a message to the ACS and returns the response. Messages and
+// errors are recorded in the session info.
+func (s *Simulator) send(ctx context.Context, sess *session, env *rpc.EnvelopeEncoder) (*rpc.EnvelopeDecoder, error) {
+	if env != nil {
+		sess.info.Messages = append(sess.info.Messages, env.Method())
+		if env.Body.Fault != nil {
+			code := env.Body.Fault.Detail.Fault.FaultCode
+			s.metrics.CPEFaults.With(prometheus.Labels{"code": code.String()}).Inc()
+		}
+	}
+	ctx, span := s.tracer.Start(ctx, "cwmp.send "+env.Method(), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attrMethod.String(env.Method()),
+		attrParameterCount.Int(parameterCount(env)),
+	))
+	if env != nil && env.Body.Fault != nil {
+		span.SetAttributes(attrFaultCode.String(env.Body.Fault.Detail.Fault.FaultCode.String()))
+	}
+	acsEnv, err := s.roundTrip(ctx, sess, env)
+	if err != nil {
+		sess.info.Error = err.Error()
+		endSpan(span, err)
+		return nil, err
+	}
+	if acsEnv != nil {
+		sess.info.Messages = append(sess.info.Messages, acsEnv.Method())
+		span.SetAttributes(attrResponseMethod.String(s.methodName(acsEnv)))
+		if acsEnv.Body.Fault != nil {
+			span.SetAttributes(attrACSFaultCode.String(acsEnv.Body.Fault.Detail.Fault.FaultCode.String()))
+		}
+	}
+	span.End()
+	return acsEnv, nil
+}
+
+// endSession records the reason the session has ended. Timeouts are reported
+// regardless of the given reason.
+func (s *Simulator) endSession(ctx context.Context, reason string, err error) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		reason = sessionTimeout
+	}
+	s.metrics.SessionTerminations.With(prometheus.Labels{"reason": reason}).Inc()
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attrTermination.String(reason))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, reason)
+	}
+}
+
+func (s *Simulator) roundTrip(ctx context.Context, sess *session, env *rpc.EnvelopeEncoder) (*rpc.EnvelopeDecoder, error) {
 	s.pretendToBeSlow(ctx)
 
+	// ACS latency is measured from the moment the request is fully written
+	// until the response is read, so that neither the artificial latency nor
+	// slowly sent bodies are counted
+	var wroteAt atomic.Int64
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			wroteAt.Store(time.Now().UnixNano())
+		},
+	})
+	observeLatency := func() {
+		if t := wroteAt.Load(); t > 0 {
+			s.metrics.RPCLatency.With(prometheus.Labels{
+				"method": env.Method(),
+			}).Observe(float64(time.Since(time.Unix(0, t)).Milliseconds()))
+		}
+	}
+
 	s.logger.Debug(ctx, "Sending request to ACS", log.F{"method": env.Method()})
-	resp, err := s.request(ctx, client, env)
+	resp, err := s.request(ctx, sess, env)
 	if err != nil {
+		observeLatency()
 		return nil, fmt.Errorf("make request: %w", err)
 	}
 	if resp.Body == nil {
 		// Got empty response from ACS, inform finished
+		observeLatency()
+		s.record(ctx, sess, recording.DirectionACS, "Empty", resp.StatusCode, nil)
 		return nil, nil
 	}
 	b, err := io.ReadAll(resp.Body)
+	observeLatency()
 	if err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
 	}
@@ -193,18 +357,63 @@ func (s *Simulator) send(ctx context.Context, client *http.Client, env *rpc.Enve
 	}
 	if len(b) == 0 {
 		// Got empty response from ACS, inform finished
+		s.record(ctx, sess, recording.DirectionACS, "Empty", resp.StatusCode, nil)
 		return nil, nil
 	}
 
 	logPrettyXML(ctx, s.logger, "Response from ACS", b)
-	acsRequestEnv, err := rpc.Decode(b)
+	acsRequestEnv, err := s.decode(ctx, sess, b)
 	if err != nil {
+		s.record(ctx, sess, recording.DirectionACS, "", resp.StatusCode, b)
 		return nil, fmt.Errorf("decode envelope: %w", err)
 	}
+	s.record(ctx, sess, recording.DirectionACS, acsRequestEnv.Method(), resp.StatusCode, b)
 
 	return acsRequestEnv, nil
 }
 
+// decode decodes a message received from the ACS. In strict mode conformance
+// violations are added to the session info and malformed messages are
+// rejected.
+func (s *Simulator) decode(ctx context.Context, sess *session, b []byte) (*rpc.EnvelopeDecoder, error) {
+	if s.cfg.DecodingMode != DecodingStrict {
+		return rpc.DecodeLenient(b)
+	}
+	env, violations, err := rpc.DecodeStrict(b)
+	for _, v := range violations {
+		s.logger.Warn(ctx, "ACS message violates CWMP schema", log.F{
+			"rule":    v.Rule,
+			"element": v.Element,
+			"message": v.Message,
+		})
+	}
+	sess.info.Violations = append(sess.info.Violations, violations...)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// record adds a message to the session recording, if it is enabled.
+func (s *Simulator) record(ctx context.Context, sess *session, direction, method string, status int, body []byte) {
+	if s.recorder == nil {
+		return
+	}
+	err := s.recorder.Record(recording.Entry{
+		SerialNumber: s.dm.DeviceID().SerialNumber,
+		Run:          s.runID,
+		Session:      sess.id,
+		Time:         time.Now(),
+		Direction:    direction,
+		Method:       method,
+		Status:       status,
+		Body:         string(body),
+	})
+	if err != nil {
+		s.logger.Error(ctx, "Failed to record message", log.Cause(err))
+	}
+}
+
 func (s *Simulator) makeInformEnvelope() *rpc.EnvelopeEncoder {
 	s.dm.SetUptime(time.Since(s.startedAt))
 	deviceID := s.dm.DeviceID()
@@ -245,8 +454,8 @@ func (s *Simulator) makeInformEnvelope() *rpc.EnvelopeEncoder {
 }
 
 // Returns false only if request to ACS was attempted and failed.
-func (s *Simulator) request(ctx context.Context, client *http.Client, env *rpc.EnvelopeEncoder) (*http.Response, error) {
-	var buf io.Reader
+func (s *Simulator) request(ctx context.Context, sess *session, env *rpc.EnvelopeEncoder) (*http.Response, error) {
+	var body []byte
 	if env != nil {
 		s.debugEnvelope(ctx, env)
 		b, err := env.EncodePretty()
@@ -254,55 +463,100 @@ func (s *Simulator) request(ctx context.Context, client *http.Client, env *rpc.E
 			return nil, fmt.Errorf("encode envelope: %w", err)
 		}
 		logPrettyXML(ctx, s.logger, "Request from ACS", b)
-		buf = bytes.NewBuffer(b)
+		body = s.chaosBody(ctx, b)
 	} else {
 		s.logger.Info(ctx, "Sending empty POST request")
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, Config.ACSURL, buf)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "text/xml; encoding=utf-8")
-	for _, c := range s.cookies.Cookies(req.URL) {
-		req.AddCookie(c)
+	contentType := "text/xml; encoding=utf-8"
+	if s.rollChaos(ctx, ChaosWrongContentType) {
+		contentType = wrongContentType
+	}
+	s.record(ctx, sess, recording.DirectionCPE, env.Method(), 0, body)
+	drop := body != nil && s.rollChaos(ctx, ChaosDropConnection)
+	slow := body != nil && s.rollChaos(ctx, ChaosSlowBody)
+	getBody := func() (io.ReadCloser, error) {
+		var r io.Reader = bytes.NewReader(body)
+		if slow {
+			r = newTrickleReader(ctx, body, s.slowBodyDuration())
+		}
+		if drop {
+			r = &dropReader{r: r, n: len(body) / 2}
+		}
+		return io.NopCloser(r), nil
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		s.metrics.RequestFailures.Inc()
-		return nil, fmt.Errorf("execute request: %w", err)
-	}
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	for {
+		var buf io.Reader
+		if body != nil {
+			buf, _ = getBody()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sess.acsURL, buf)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		if body != nil {
+			// Body readers may be wrapped, which hides the length
+			req.ContentLength = int64(len(body))
+			req.GetBody = getBody
+		}
+		req.Header.Set("Content-Type", contentType)
+		// Trace context allows the ACS to continue the session trace
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		for _, c := range s.cookies.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+
+		resp, err := sess.client.Do(req)
+		if err != nil {
+			s.metrics.RequestFailures.Inc()
+			return nil, fmt.Errorf("execute request: %w", err)
+		}
+		s.cookies.SetCookies(req.URL, resp.Cookies())
+		if isRedirect(resp.StatusCode) {
+			if err := s.redirect(ctx, sess, resp); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+		}
+
+		s.metrics.ResponseStatus.With(prometheus.Labels{"status": resp.Status}).Inc()
+		return resp, nil
 	}
+}
 
-	s.cookies.SetCookies(req.URL, resp.Cookies())
-	s.metrics.ResponseStatus.With(prometheus.Labels{"status": resp.Status}).Inc()
+// redirect changes the ACS URL for the remainder of the session.
+func (s *Simulator) redirect(ctx context.Context, sess *session, resp *http.Response) error {
+	// Response body is not needed
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
 
-	return resp, nil
+	if sess.redirects >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("get redirect location: %w", err)
+	}
+	sess.redirects++
+	s.logger.Info(ctx, "Redirected by ACS", log.F{
+		"status": resp.Status,
+		"from":   sess.acsURL,
+		"to":     loc.String(),
+	})
+	sess.acsURL = loc.String()
+	return nil
 }
 
-func (s *Simulator) processTasks() {
+func (s *Simulator) processTasks(ctx context.Context) {
 	// Any tasks that are produced as a result of current batch will be executed
 	// next time. This is done to allow tasks to schedule a session and a task
 	// that needs to be run after that session completes.
-	next := []taskFn{}
-	defer func() {
-		for _, t := range next {
-			s.tasks <- t
-		}
-	}()
-
-	// Process currently scheduled tasks.
-	for {
-		select {
-		case task := <-s.tasks:
-			if nt := task(); nt != nil {
-				next = append(next, nt)
-			}
-		default:
-			return
+	for _, t := range s.tasks.takeAll() {
+		if next := s.runTask(ctx, t); next != nil {
+			s.tasks.push(t.Name, next)
 		}
 	}
 }
@@ -331,49 +585,6 @@ func (s *Simulator) debugEnvelope(ctx context.Context, env *rpc.EnvelopeEncoder)
 	}
 }
 
-func newClient(host, port string) (http.Client, func() error, error) {
-	dialer := net.Dialer{
-		Timeout: Config.ConnectionTimeout,
-	}
-	conn, err := dialer.Dial("tcp", fmt.Sprintf("%s:%s", host, port))
-	if err != nil {
-		return http.Client{}, nil, fmt.Errorf("create a TCP connection to ACS: %w", err)
-	}
-
-	tr := &http.Transport{
-		Dial: func(_, _ string) (net.Conn, error) {
-			return conn, nil
-		},
-		TLSClientConfig: &tls.Config{
-			//nolint:gosec
-			InsecureSkipVerify: !Config.ACSVerifyTLS,
-		},
-	}
-	client := http.Client{
-		Transport: tr,
-		Timeout:   Config.RequestTimeout,
-	}
-	if Config.ACSAuth == AuthDigest {
-		client.Transport = &digest.Transport{
-			Transport: tr,
-			Username:  Config.ACSUsername,
-			Password:  Config.ACSPassword,
-		}
-	}
-
-	return client, conn.Close, nil
-}
-
-func tcpPort(u *url.URL) string {
-	if u.Port() != "" {
-		return u.Port()
-	}
-	if u.Scheme == "https" {
-		return "443"
-	}
-	return "80"
-}
-
 // calcInformTime calculates the time of the next inform based on all relevant
 // parameters. It is meant to be wrapped by Server.nextInformTime and is written
 // in such a way that it has no side effects and can be easily tested with unit
@@ -1,10 +1,23 @@
 package simulator
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/rpc"
+	"github.com/localhots/SimulaTR69/simulator/metrics"
 )
 
 func TestCalcInformTime(t *testing.T) {
@@ -78,3 +91,111 @@ func TestCalcInformTime(t *testing.T) {
 		assert.WithinDuration(t, now.Add(5*time.Minute), res, 0)
 	})
 }
+
+func TestNextInformTimeJitter(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.InformJitter = 10 * time.Second
+	dm := newTestDataModel(t)
+	dm.SetValue("ManagementServer.PeriodicInformEnable", "true")
+	dm.SetPeriodicInformInterval(60)
+	s := New(dm, WithConfig(cfg))
+	s.startedAt = time.Now().Add(-30 * time.Second)
+
+	base := s.startedAt.Add(time.Minute)
+	for range 10 {
+		next := s.nextInformTime()
+		assert.False(t, next.Before(base))
+		assert.True(t, next.Before(base.Add(cfg.InformJitter)))
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	s := New(newTestDataModel(t), WithMetrics(m))
+
+	s.endSession(t.Context(), sessionCompleted, nil)
+	s.endSession(t.Context(), sessionRequestFailed, errors.New("connection reset"))
+	s.endSession(t.Context(), sessionRequestFailed, fmt.Errorf("send: %w", context.DeadlineExceeded))
+	s.endSession(t.Context(), sessionConnectionFailed, &net.OpError{Op: "dial", Err: timeoutError{}})
+
+	count := func(reason string) float64 {
+		return testutil.ToFloat64(m.SessionTerminations.(*prometheus.CounterVec).WithLabelValues(reason))
+	}
+	assert.Equal(t, 1.0, count(sessionCompleted))
+	assert.Equal(t, 1.0, count(sessionRequestFailed))
+	assert.Equal(t, 0.0, count(sessionConnectionFailed))
+	assert.Equal(t, 2.0, count(sessionTimeout))
+}
+
+func TestRPCLatency(t *testing.T) {
+	t.Parallel()
+
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer acs.Close()
+
+	// Time spent sending the message slowly is not the ACS latency
+	m := metrics.New(prometheus.NewRegistry())
+	cfg := DefaultConfig()
+	cfg.ChaosSlowBody = 1
+	cfg.ChaosSlowBodyDuration = 300 * time.Millisecond
+	s := New(newTestDataModel(t), WithConfig(cfg), WithMetrics(m))
+	sess := newTestSession(t, acs.URL, clientOptions{})
+	_, err := s.send(t.Context(), sess, s.newEnvelope().WithFault(rpc.FaultInternalError))
+	require.NoError(t, err)
+
+	var metric dto.Metric
+	h := m.RPCLatency.(*prometheus.HistogramVec).WithLabelValues("Fault")
+	require.NoError(t, h.(prometheus.Histogram).Write(&metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	assert.Less(t, metric.GetHistogram().GetSampleSum(), 200.0)
+}
+
+func TestStrictDecoding(t *testing.T) {
+	t.Parallel()
+
+	// GetParameterValues request without mustUnderstand and arrayType
+	const gpv = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cwmp="urn:dslforum-org:cwmp-1-0">
+<soapenv:Header><cwmp:ID>2</cwmp:ID></soapenv:Header>
+<soapenv:Body><cwmp:GetParameterValues><ParameterNames><string>Device.</string></ParameterNames></cwmp:GetParameterValues></soapenv:Body>
+</soapenv:Envelope>`
+	var requests int
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			env := rpc.NewEnvelope("1")
+			env.Body.InformResponse = &rpc.InformResponseEncoder{MaxEnvelopes: rpc.MaxEnvelopes}
+			b, _ := env.Encode()
+			_, _ = w.Write(b)
+		case 2:
+			_, _ = w.Write([]byte(gpv))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer acs.Close()
+
+	dm := newTestDataModel(t)
+	dm.SeedACSURL(acs.URL)
+	dm.AddEvent(rpc.EventBoot)
+	cfg := DefaultConfig()
+	cfg.DecodingMode = DecodingStrict
+	s := New(dm, WithConfig(cfg))
+	s.startSession(t.Context(), s.informHandler)
+
+	sessions := s.Sessions()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, []string{"Inform", "InformResponse", "GetParameterValues", "Fault"}, sessions[0].Messages)
+	assert.Equal(t, []rpc.Violation{
+		{Rule: rpc.RuleMustUnderstand, Element: "Header/ID", Message: `ID header must have mustUnderstand="1"`},
+		{Rule: rpc.RuleArrayType, Element: "Body/GetParameterValues/ParameterNames", Message: "arrayType attribute is missing"},
+	}, sessions[0].Violations)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
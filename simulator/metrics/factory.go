@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label modes define which labels are added to metrics of simulated devices.
+const (
+	// LabelsNone aggregates metrics of all devices.
+	LabelsNone = "none"
+	// LabelsProductClass aggregates metrics of devices by product class.
+	LabelsProductClass = "product_class"
+	// LabelsDevice adds serial_number and product_class labels. It produces
+	// separate series for every device and should only be used with small
+	// fleets.
+	LabelsDevice = "device"
+)
+
+// Factory creates metrics for simulated devices. Devices that end up with the
+// same labels share a single Metrics instance.
+type Factory struct {
+	reg     prometheus.Registerer
+	labels  string
+	metrics map[string]*Metrics
+	lock    sync.Mutex
+}
+
+// NewFactory creates a metrics factory that registers metrics with the given
+// registerer using the given label mode.
+func NewFactory(reg prometheus.Registerer, labels string) *Factory {
+	return &Factory{
+		reg:     reg,
+		labels:  labels,
+		metrics: make(map[string]*Metrics),
+	}
+}
+
+// ForDevice returns metrics for a device with the given serial number and
+// product class.
+func (f *Factory) ForDevice(serialNumber, productClass string) *Metrics {
+	var labels prometheus.Labels
+	switch f.labels {
+	case LabelsProductClass:
+		labels = prometheus.Labels{"product_class": productClass}
+	case LabelsDevice:
+		labels = prometheus.Labels{
+			"serial_number": serialNumber,
+			"product_class": productClass,
+		}
+	}
+	key := labels["serial_number"] + "/" + labels["product_class"]
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if m, ok := f.metrics[key]; ok {
+		return m
+	}
+	m := New(prometheus.WrapRegistererWith(labels, f.reg))
+	f.metrics[key] = m
+	return m
+}
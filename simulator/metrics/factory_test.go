@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactory(t *testing.T) {
+	tests := map[string]struct {
+		labels string
+		series int
+	}{
+		"none":          {labels: LabelsNone, series: 1},
+		"product class": {labels: LabelsProductClass, series: 2},
+		"device":        {labels: LabelsDevice, series: 3},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			f := NewFactory(reg, tt.labels)
+			f.ForDevice("SIM-001", "Box").SessionsAttempted.Inc()
+			f.ForDevice("SIM-002", "Box").SessionsAttempted.Inc()
+			f.ForDevice("SIM-003", "Router").SessionsAttempted.Inc()
+			// Same device gets the same metrics
+			assert.Same(t, f.ForDevice("SIM-001", "Box"), f.ForDevice("SIM-001", "Box"))
+
+			n, err := testutil.GatherAndCount(reg, "sessions_attempted")
+			require.NoError(t, err)
+			assert.Equal(t, tt.series, n)
+		})
+	}
+}
@@ -31,6 +31,13 @@ type Metrics struct {
 	InformEvents        prometheus_CounterVec
 	ParametersRead      prometheus.Counter
 	ParametersWritten   prometheus.Counter
+	RPCLatency          prometheus_HistogramVec
+	CPEFaults           prometheus_CounterVec
+	ACSFaults           prometheus_CounterVec
+	InformRetries       prometheus.Histogram
+	Transfers           prometheus_CounterVec
+	OfflineTime         prometheus.Counter
+	SessionTerminations prometheus_CounterVec
 }
 
 // prometheus.CounterVec is a struct, not an interface. We can't reimplement it
@@ -122,6 +129,50 @@ func New(reg prometheus.Registerer) *Metrics {
 			Name: "parameters_written",
 			Help: "Number of parameters changed via SetParameterValues",
 		}),
+		RPCLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                        "acs_rpc_latency",
+			Help:                        "Time it takes the ACS to respond to a message in milliseconds, by message sent",
+			Buckets:                     prometheus.ExponentialBuckets(1, 2, 15),
+			NativeHistogramMaxExemplars: 100,
+			NativeHistogramExemplarTTL:  15 * time.Minute,
+		}, []string{"method"}),
+		CPEFaults: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cpe_faults",
+				Help: "Number of faults returned to the ACS by fault code",
+			},
+			[]string{"code"},
+		),
+		ACSFaults: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "acs_faults",
+				Help: "Number of faults received from the ACS by fault code",
+			},
+			[]string{"code"},
+		),
+		InformRetries: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "inform_retry_count",
+			Help:    "Retry count of sent Inform messages",
+			Buckets: []float64{0, 1, 2, 3, 5, 8, 13, 21},
+		}),
+		Transfers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "transfers",
+				Help: "Number of file transfers by file type and outcome",
+			},
+			[]string{"file_type", "outcome"},
+		),
+		OfflineTime: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "offline_seconds",
+			Help: "Time spent offline in seconds",
+		}),
+		SessionTerminations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "session_terminations",
+				Help: "Number of finished sessions by termination reason",
+			},
+			[]string{"reason"},
+		),
 	}
 	reg.MustRegister(
 		m.Bootstrapped,
@@ -137,6 +188,13 @@ func New(reg prometheus.Registerer) *Metrics {
 		m.InformEvents,
 		m.ParametersRead,
 		m.ParametersWritten,
+		m.RPCLatency,
+		m.CPEFaults,
+		m.ACSFaults,
+		m.InformRetries,
+		m.Transfers,
+		m.OfflineTime,
+		m.SessionTerminations,
 	)
 	return m
 }
@@ -6,11 +6,12 @@ import (
 )
 
 var (
-	_ prometheus.Registerer = noopRegisterer{}
-	_ prometheus_CounterVec = noopCounterVec{}
-	_ prometheus.Counter    = noopCounter{}
-	_ prometheus.Histogram  = noopHistogram{}
-	_ prometheus.Gauge      = noopGauge{}
+	_ prometheus.Registerer   = noopRegisterer{}
+	_ prometheus_CounterVec   = noopCounterVec{}
+	_ prometheus_HistogramVec = noopHistogramVec{}
+	_ prometheus.Counter      = noopCounter{}
+	_ prometheus.Histogram    = noopHistogram{}
+	_ prometheus.Gauge        = noopGauge{}
 )
 
 type (
@@ -42,6 +43,13 @@ func NewNoop() *Metrics {
 		InformEvents:        noopCounterVec{},
 		ParametersRead:      noopCounter{},
 		ParametersWritten:   noopCounter{},
+		RPCLatency:          noopHistogramVec{},
+		CPEFaults:           noopCounterVec{},
+		ACSFaults:           noopCounterVec{},
+		InformRetries:       noopHistogram{},
+		Transfers:           noopCounterVec{},
+		OfflineTime:         noopCounter{},
+		SessionTerminations: noopCounterVec{},
 	}
 }
 
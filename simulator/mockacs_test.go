@@ -0,0 +1,93 @@
+package simulator
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/mockacs"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestMockACS(t *testing.T) {
+	t.Parallel()
+
+	const (
+		serial  = "SIM-E2E"
+		version = "Device.DeviceInfo.SoftwareVersion"
+		code    = "Device.DeviceInfo.ProvisioningCode"
+	)
+	acs := mockacs.New(
+		mockacs.WithConnectionRequestAuth("cpe", "secret"),
+		mockacs.WithScript(
+			mockacs.GetParameterValues(version),
+			mockacs.SetParameterValues(mockacs.Parameter{Name: code, Value: "E2E"}),
+			mockacs.AddObject("Device.NAT.PortMapping."),
+			mockacs.Reboot("e2e"),
+		),
+	)
+	srv := httptest.NewServer(acs)
+	defer srv.Close()
+
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	param := func(path, value string, writable bool) datamodel.Parameter {
+		return datamodel.Parameter{Path: path, Type: "xsd:string", Value: value, Writable: writable}
+	}
+	dm := datamodel.New(state.WithDefaults(map[string]datamodel.Parameter{
+		"Device.DeviceInfo.SerialNumber":                    param("Device.DeviceInfo.SerialNumber", serial, false),
+		"Device.ManagementServer.ConnectionRequestURL":      param("Device.ManagementServer.ConnectionRequestURL", "", false),
+		"Device.ManagementServer.ConnectionRequestUsername": param("Device.ManagementServer.ConnectionRequestUsername", "cpe", true),
+		"Device.ManagementServer.ConnectionRequestPassword": param("Device.ManagementServer.ConnectionRequestPassword", "secret", true),
+		version:                  param(version, "1.0", false),
+		code:                     param(code, "", true),
+		"Device.NAT.PortMapping": {Path: "Device.NAT.PortMapping", Object: true, Writable: true},
+	}))
+
+	cfg := DefaultConfig()
+	cfg.ACSURL = srv.URL
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	cfg.ConnReqEnableUDP = false
+	cfg.ConnReqAuth = true
+	cfg.RebootDelay = 10 * time.Millisecond
+	s := New(dm, WithConfig(cfg))
+	require.NoError(t, s.Start(t.Context()))
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	// Scripted requests are sent in the first session, reboot makes the
+	// device start another one
+	sessions, err := acs.WaitSessions(ctx, serial, 2)
+	require.NoError(t, err)
+	msgs := sessions[0].Messages
+	require.Len(t, msgs, 5)
+	assert.Equal(t, []string{rpc.EventBootstrap}, msgs[0].Events)
+	assert.Equal(t, "GetParameterValuesResponse", msgs[1].Method)
+	assert.Equal(t, []mockacs.Parameter{{Name: version, Type: "xsd:string", Value: "1.0"}}, msgs[1].Parameters)
+	assert.Equal(t, "SetParameterValuesResponse", msgs[2].Method)
+	assert.Equal(t, "AddObjectResponse", msgs[3].Method)
+	assert.Equal(t, 1, msgs[3].InstanceNumber)
+	assert.Equal(t, "RebootResponse", msgs[4].Method)
+	assert.Equal(t, "Reboot", msgs[4].Request)
+	assert.Contains(t, sessions[1].Messages[0].Events, rpc.EventBoot)
+
+	val, _ := s.ParameterValue(code)
+	assert.Equal(t, "E2E", val)
+
+	require.NoError(t, acs.Enqueue(serial, mockacs.GetParameterValues(code)))
+	require.NoError(t, acs.ConnectionRequest(ctx, serial))
+	sessions, err = acs.WaitSessions(ctx, serial, 3)
+	require.NoError(t, err)
+	msgs = sessions[2].Messages
+	require.Len(t, msgs, 2)
+	assert.Equal(t, []string{rpc.EventConnectionRequest}, msgs[0].Events)
+	assert.Equal(t, "E2E", msgs[1].Parameters[0].Value)
+}
@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rampUpFn returns the delay after which i-th device out of n should be
+// started.
+type rampUpFn func(i, n int) time.Duration
+
+// curvePoint is a point on a ramp-up curve. It defines the percentage of
+// devices that must be started by the given offset.
+type curvePoint struct {
+	offset  time.Duration
+	percent float64
+}
+
+func newRampUp(cfg Config) (rampUpFn, error) {
+	switch cfg.FleetRampUp {
+	case RampUpLinear:
+		return linearRampUp(cfg.FleetRampUpDuration), nil
+	case RampUpBatch:
+		return batchRampUp(cfg.FleetRampUpBatchSize, cfg.FleetRampUpBatchInterval), nil
+	case RampUpCurve:
+		points, err := loadRampUpCurve(cfg.FleetRampUpCurve)
+		if err != nil {
+			return nil, err
+		}
+		return curveRampUp(points), nil
+	default:
+		return func(int, int) time.Duration { return 0 }, nil
+	}
+}
+
+func linearRampUp(dur time.Duration) rampUpFn {
+	return func(i, n int) time.Duration {
+		return dur * time.Duration(i) / time.Duration(n)
+	}
+}
+
+func batchRampUp(size int, interval time.Duration) rampUpFn {
+	return func(i, _ int) time.Duration {
+		return time.Duration(i/size) * interval
+	}
+}
+
+// curveRampUp interpolates device start delays between the points of a
+// curve. Points must be sorted by offset and percentage.
+func curveRampUp(points []curvePoint) rampUpFn {
+	return func(i, n int) time.Duration {
+		// Percentage of devices that are started before this one
+		pct := float64(i) / float64(n) * 100
+		prev := curvePoint{}
+		for _, p := range points {
+			if pct < p.percent {
+				frac := (pct - prev.percent) / (p.percent - prev.percent)
+				return prev.offset + time.Duration(frac*float64(p.offset-prev.offset))
+			}
+			prev = p
+		}
+		return prev.offset
+	}
+}
+
+// loadRampUpCurve loads ramp-up curve points from a file. Empty lines and
+// lines starting with # are ignored.
+func loadRampUpCurve(path string) ([]curvePoint, error) {
+	// Assume the file is trusted
+	//nolint:gosec
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open ramp-up curve: %w", err)
+	}
+	defer fd.Close()
+
+	var points []curvePoint
+	prev := curvePoint{}
+	scanner := bufio.NewScanner(fd)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		offsetStr, pctStr, ok := strings.Cut(text, ",")
+		if !ok {
+			return nil, fmt.Errorf("ramp-up curve line %d: expected <offset>,<percent>", line)
+		}
+		offset, err := time.ParseDuration(strings.TrimSpace(offsetStr))
+		if err != nil {
+			return nil, fmt.Errorf("ramp-up curve line %d: %w", line, err)
+		}
+		pct, err := strconv.ParseFloat(strings.TrimSpace(pctStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("ramp-up curve line %d: %w", line, err)
+		}
+		if offset < prev.offset || pct < prev.percent || pct > 100 {
+			return nil, fmt.Errorf("ramp-up curve line %d: points must be increasing and within 0-100%%", line)
+		}
+		p := curvePoint{offset: offset, percent: pct}
+		points = append(points, p)
+		prev = p
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ramp-up curve: %w", err)
+	}
+	if len(points) == 0 {
+		return nil, errors.New("ramp-up curve is empty")
+	}
+	return points, nil
+}
@@ -0,0 +1,59 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearRampUp(t *testing.T) {
+	fn := linearRampUp(time.Minute)
+	assert.Equal(t, time.Duration(0), fn(0, 4))
+	assert.Equal(t, 15*time.Second, fn(1, 4))
+	assert.Equal(t, 45*time.Second, fn(3, 4))
+}
+
+func TestBatchRampUp(t *testing.T) {
+	fn := batchRampUp(10, time.Second)
+	assert.Equal(t, time.Duration(0), fn(9, 100))
+	assert.Equal(t, time.Second, fn(10, 100))
+	assert.Equal(t, 9*time.Second, fn(99, 100))
+}
+
+func TestCurveRampUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "curve.csv")
+	curve := "# offset,percent\n10s,0\n20s,50\n\n60s,100\n"
+	require.NoError(t, os.WriteFile(path, []byte(curve), 0o600))
+
+	cfg := DefaultConfig()
+	cfg.FleetRampUp = RampUpCurve
+	cfg.FleetRampUpCurve = path
+	fn, err := newRampUp(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10*time.Second, fn(0, 10))
+	assert.Equal(t, 14*time.Second, fn(2, 10))
+	assert.Equal(t, 20*time.Second, fn(5, 10))
+	assert.Equal(t, 52*time.Second, fn(9, 10))
+}
+
+func TestLoadRampUpCurveInvalid(t *testing.T) {
+	for name, curve := range map[string]string{
+		"empty":      "# nothing\n",
+		"format":     "10s\n",
+		"offset":     "foo,10\n",
+		"decreasing": "10s,50\n5s,100\n",
+		"percent":    "10s,150\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "curve.csv")
+			require.NoError(t, os.WriteFile(path, []byte(curve), 0o600))
+			_, err := loadRampUpCurve(path)
+			require.Error(t, err)
+		})
+	}
+}
@@ -14,12 +14,16 @@ func (s *Simulator) handleReboot(ctx context.Context, envID string, r *rpc.Reboo
 	resp.Body.RebootResponse = &rpc.RebootResponseEncoder{}
 	s.dm.SetCommandKey(r.CommandKey)
 
-	s.tasks <- func() taskFn {
-		s.logger.Debug(ctx, "Simulating reboot", log.F{"delay": Config.RebootDelay})
-		s.pretendOfflineFor(Config.RebootDelay)
+	s.tasks.push("Reboot", s.rebootTask(ctx))
+	return resp
+}
+
+func (s *Simulator) rebootTask(ctx context.Context) taskFn {
+	return func() taskFn {
+		s.logger.Debug(ctx, "Simulating reboot", log.F{"delay": s.cfg.RebootDelay})
+		s.pretendOfflineFor(s.cfg.RebootDelay)
 		s.logger.Debug(ctx, "Starting up")
-		s.pendingEvents <- rpc.EventBoot
+		s.requestInform(ctx, rpc.EventBoot)
 		return nil
 	}
-	return resp
 }
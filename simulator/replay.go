@@ -0,0 +1,203 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/recording"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// Divergence describes a difference between a recorded ACS message and the
+// one received during replay.
+type Divergence struct {
+	SerialNumber string `json:"serial_number"`
+	Session      int    `json:"session"`
+	// Message is the index of the message within the recorded session.
+	Message  int    `json:"message"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// String implements fmt.Stringer.
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s session %d message %d: expected %s, got %s",
+		d.SerialNumber, d.Session, d.Message, d.Expected, d.Actual)
+}
+
+// Replay sends the CPE side of recorded sessions to the ACS configured in
+// cfg.ACSURL and compares ACS messages with the recorded ones. Sessions are
+// replayed one after another. A session is aborted at the first divergence.
+func Replay(ctx context.Context, cfg Config, sessions []recording.Session) ([]Divergence, error) {
+	if cfg.ACSURL == "" {
+		return nil, ErrNoACSURL
+	}
+	u, err := url.Parse(cfg.ACSURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse ACS URL: %w", err)
+	}
+	opts, err := newClientOptions(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("configure ACS client: %w", err)
+	}
+
+	var divergences []Divergence
+	for _, sess := range sessions {
+		log.Info("Replaying session", log.F{
+			"serial_number": sess.SerialNumber,
+			"run":           sess.Run,
+			"session":       sess.ID,
+			"messages":      len(sess.Entries),
+		})
+		d, err := replaySession(ctx, u, opts, sess)
+		if err != nil {
+			return divergences, fmt.Errorf("replay %s session %d: %w", sess.SerialNumber, sess.ID, err)
+		}
+		if d != nil {
+			log.Warn("Session diverged", log.F{"divergence": d.String()})
+			divergences = append(divergences, *d)
+		}
+	}
+	return divergences, nil
+}
+
+func replaySession(ctx context.Context, u *url.URL, opts clientOptions, sess recording.Session) (*Divergence, error) {
+	client, closeFn, err := newClient(u, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ACS: %w", err)
+	}
+	defer func() { _ = closeFn() }()
+	client.Jar, _ = cookiejar.New(nil)
+
+	acsURL := u.String()
+	// Envelope IDs of ACS requests are generated by the ACS, responses must
+	// reference the actual ones instead of the recorded ones
+	var recordedID, actualID string
+	for i, e := range sess.Entries {
+		if e.Direction != recording.DirectionCPE {
+			continue
+		}
+		body := e.Body
+		if recordedID != "" && recordedID != actualID {
+			body = strings.Replace(body, ">"+recordedID+"</", ">"+actualID+"</", 1)
+		}
+		status, resp, err := postEnvelope(ctx, client, &acsURL, body)
+		if err != nil {
+			return nil, err
+		}
+
+		// The next recorded message is the expected ACS response
+		if i+1 >= len(sess.Entries) || sess.Entries[i+1].Direction != recording.DirectionACS {
+			continue
+		}
+		exp := sess.Entries[i+1]
+		if diff := compareMessages(exp, status, resp); diff != nil {
+			diff.SerialNumber, diff.Session, diff.Message = sess.SerialNumber, sess.ID, i+1
+			return diff, nil
+		}
+		recordedID, actualID = envelopeID(exp.Body), envelopeID(string(resp))
+	}
+	return nil, nil
+}
+
+// postEnvelope sends a message to the ACS. Redirects change the ACS URL for
+// the remainder of the session.
+func postEnvelope(ctx context.Context, client *http.Client, acsURL *string, body string) (int, []byte, error) {
+	for range maxRedirects + 1 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, *acsURL, strings.NewReader(body))
+		if err != nil {
+			return 0, nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/xml; encoding=utf-8")
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil, fmt.Errorf("execute request: %w", err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return 0, nil, fmt.Errorf("read response: %w", err)
+		}
+		if !isRedirect(resp.StatusCode) {
+			return resp.StatusCode, b, nil
+		}
+		loc, err := resp.Location()
+		if err != nil {
+			return 0, nil, fmt.Errorf("get redirect location: %w", err)
+		}
+		*acsURL = loc.String()
+	}
+	return 0, nil, errors.New("too many redirects")
+}
+
+// compareMessages compares a recorded ACS message with the actual one. Only
+// the meaningful parts are compared: HTTP status, method and parameters.
+func compareMessages(exp recording.Entry, status int, body []byte) *Divergence {
+	if exp.Status != 0 && exp.Status != status {
+		return &Divergence{
+			Expected: fmt.Sprintf("status %d", exp.Status),
+			Actual:   fmt.Sprintf("status %d", status),
+		}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if exp.Method != "Empty" {
+			return &Divergence{Expected: exp.Method, Actual: "Empty"}
+		}
+		return nil
+	}
+	act, err := rpc.Decode(body)
+	if err != nil {
+		return &Divergence{Expected: exp.Method, Actual: "invalid envelope: " + err.Error()}
+	}
+	if act.Method() != exp.Method {
+		return &Divergence{Expected: exp.Method, Actual: act.Method()}
+	}
+	recorded, err := rpc.Decode([]byte(exp.Body))
+	if err != nil {
+		// Recorded message is broken, method match is the best we can do
+		return nil
+	}
+	expParams, actParams := requestParams(recorded), requestParams(act)
+	if !slices.Equal(expParams, actParams) {
+		return &Divergence{
+			Expected: exp.Method + " " + strings.Join(expParams, ", "),
+			Actual:   act.Method() + " " + strings.Join(actParams, ", "),
+		}
+	}
+	return nil
+}
+
+// requestParams returns sorted parameter paths referenced by an ACS request,
+// with values for SetParameterValues.
+func requestParams(env *rpc.EnvelopeDecoder) []string {
+	if spv := env.Body.SetParameterValues; spv != nil {
+		params := make([]string, 0, len(spv.ParameterList.ParameterValues))
+		for _, p := range spv.ParameterList.ParameterValues {
+			params = append(params, p.Name+"="+p.Value.Value)
+		}
+		slices.Sort(params)
+		return params
+	}
+	params := slices.Clone(requestPaths(env))
+	slices.Sort(params)
+	return params
+}
+
+// envelopeID extracts the envelope ID from an XML message.
+func envelopeID(body string) string {
+	env, err := rpc.Decode([]byte(body))
+	if err != nil {
+		return ""
+	}
+	return env.Header.ID.Value
+}
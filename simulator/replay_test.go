@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/recording"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	const envelope = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cwmp="urn:dslforum-org:cwmp-1-0">
+<soapenv:Header><cwmp:ID soapenv:mustUnderstand="1">%s</cwmp:ID></soapenv:Header>
+<soapenv:Body>%s</soapenv:Body>
+</soapenv:Envelope>`
+
+	// ACS asks for the value of a single parameter with a new envelope ID
+	// every time and expects the response to reference it
+	var (
+		param  = "Device.DeviceInfo.SoftwareVersion"
+		seq    int
+		lastID string
+		lock   sync.Mutex
+	)
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		b, _ := io.ReadAll(r.Body)
+		switch {
+		case bytes.Contains(b, []byte("<cwmp:Inform>")):
+			fmt.Fprintf(w, envelope, "1", "<cwmp:InformResponse><MaxEnvelopes>1</MaxEnvelopes></cwmp:InformResponse>")
+		case len(b) == 0:
+			seq++
+			lastID = fmt.Sprintf("acs-%d", seq)
+			fmt.Fprintf(w, envelope, lastID, `<cwmp:GetParameterValues><ParameterNames><string>`+param+`</string></ParameterNames></cwmp:GetParameterValues>`)
+		case bytes.Contains(b, []byte(">"+lastID+"<")):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer acs.Close()
+
+	var buf bytes.Buffer
+	s := New(newTestDataModel(t), WithRecorder(recording.NewRecorder(&buf)))
+	s.dm.SeedACSURL(acs.URL)
+	s.dm.AddEvent(rpc.EventBoot)
+	s.startSession(t.Context(), s.informHandler)
+
+	sessions, err := recording.Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	var messages []string
+	for _, e := range sessions[0].Entries {
+		messages = append(messages, e.Direction+" "+e.Method)
+	}
+	assert.Equal(t, []string{
+		"cpe Inform",
+		"acs InformResponse",
+		"cpe Empty",
+		"acs GetParameterValues",
+		"cpe Fault",
+		"acs Empty",
+	}, messages)
+	assert.Equal(t, http.StatusNoContent, sessions[0].Entries[5].Status)
+
+	cfg := DefaultConfig()
+	cfg.ACSURL = acs.URL
+	divergences, err := Replay(t.Context(), cfg, sessions)
+	require.NoError(t, err)
+	assert.Empty(t, divergences)
+
+	lock.Lock()
+	param = "Device.DeviceInfo.HardwareVersion"
+	lock.Unlock()
+	divergences, err = Replay(t.Context(), cfg, sessions)
+	require.NoError(t, err)
+	require.Len(t, divergences, 1)
+	assert.Equal(t, 3, divergences[0].Message)
+	assert.True(t, strings.HasSuffix(divergences[0].Actual, "HardwareVersion"), divergences[0].Actual)
+}
@@ -2,6 +2,7 @@ package simulator
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -23,11 +24,14 @@ type server interface {
 }
 
 type crParams struct {
-	ts  string // Timestamp
-	id  string // Message ID
-	un  string // Username
-	cn  string // Cnonce
-	sig string // Signature
+	ts   string // Timestamp
+	id   string // Message ID
+	un   string // Username
+	cn   string // Cnonce
+	sig  string // Signature
+	pw   string // Password, only used by XMPP
+	from string // Sender Jabber ID, only used by XMPP
+	xmpp bool   // Request was received over XMPP
 }
 
 // crHandlerFn is a function that handles connection requests.
@@ -41,27 +45,43 @@ type crHandlerFn func(context.Context, crParams) error
 type httpServer struct {
 	httpServer *http.Server
 	handler    crHandlerFn
+	host       string
 	port       int
+	path       string
+	tls        bool
 	logger     *blip.Logger
 }
 
-func newHTTPServer(ctx context.Context, h crHandlerFn, logger *blip.Logger) (server, error) {
-	var err error
-	if Config.Host == "" {
-		Config.Host, err = getIP()
+func newHTTPServer(ctx context.Context, cfg Config, h crHandlerFn, logger *blip.Logger) (server, error) {
+	host, err := advertisedHost(cfg)
+	if err != nil {
+		return nil, err
+	}
+	path := cfg.ConnReqPath
+	if path == "" {
+		path = "/cwmp"
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.ConnReqTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ConnReqTLSCert, cfg.ConnReqTLSKey)
 		if err != nil {
-			return nil, fmt.Errorf("get ip address: %w", err)
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
 		}
 	}
 
 	// Linter demands the ListenConfig must be used.
 	//nolint:noctx
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", Config.Host, Config.Port))
+	listener, err := net.Listen(network(cfg, "tcp"), net.JoinHostPort(bindHost(cfg, host), strconv.Itoa(int(cfg.Port))))
 	if err != nil {
 		return nil, fmt.Errorf("create TCP listener: %w", err)
 	}
 
-	// Config.Port can be set to 0 in order to bind to a random available addr.
+	// Port can be set to 0 in order to bind to a random available addr.
 	addr, ok := listener.Addr().(*net.TCPAddr)
 	if !ok {
 		return nil, fmt.Errorf("get TCP addr: %w", err)
@@ -70,18 +90,29 @@ func newHTTPServer(ctx context.Context, h crHandlerFn, logger *blip.Logger) (ser
 	mux := http.NewServeMux()
 	s := &httpServer{
 		httpServer: &http.Server{
-			Addr:         fmt.Sprintf("%s:%d", Config.Host, addr.Port),
+			Addr:         listener.Addr().String(),
 			Handler:      mux,
+			TLSConfig:    tlsConfig,
 			ReadTimeout:  5 * time.Second,
 			WriteTimeout: 5 * time.Second,
 		},
 		handler: h,
+		host:    host,
 		port:    addr.Port,
+		path:    path,
+		tls:     tlsConfig != nil,
 		logger:  logger,
 	}
-	mux.HandleFunc("/cwmp", s.handleConnectionRequest)
+	mux.HandleFunc(path, s.handleConnectionRequest)
 	go func() {
-		if err := s.httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if s.tls {
+			// Certificates are already loaded into the TLS config
+			err = s.httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = s.httpServer.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
 			logger.Error(ctx, "Server error", log.Cause(err))
 		}
 	}()
@@ -118,7 +149,11 @@ func (s *httpServer) listenPort() int {
 }
 
 func (s *httpServer) url() string {
-	return fmt.Sprintf("http://%s/cwmp", net.JoinHostPort(Config.Host, strconv.Itoa(s.port)))
+	scheme := "http"
+	if s.tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(s.host, strconv.Itoa(s.port)), s.path)
 }
 
 func (s *httpServer) stop(ctx context.Context) error {
@@ -128,18 +163,81 @@ func (s *httpServer) stop(ctx context.Context) error {
 	return nil
 }
 
-func getIP() (string, error) {
+// advertisedHost returns the host that is used in connection request URLs.
+func advertisedHost(cfg Config) (string, error) {
+	if cfg.Host != "" {
+		return cfg.Host, nil
+	}
+	ip, err := getIP(cfg.IPFamily)
+	if err != nil {
+		return "", fmt.Errorf("get ip address: %w", err)
+	}
+	return ip, nil
+}
+
+// bindHost returns the host connection request servers listen on. In
+// dual-stack mode servers listen on all addresses unless the host is set
+// explicitly.
+func bindHost(cfg Config, host string) string {
+	if cfg.IPFamily == IPFamilyDual && cfg.Host == "" {
+		return ""
+	}
+	return host
+}
+
+// network returns a network name for the configured IP family, e.g. "tcp4" or
+// "udp6". Dual-stack networks have no suffix.
+func network(cfg Config, proto string) string {
+	switch cfg.IPFamily {
+	case IPFamilyIPv4:
+		return proto + "4"
+	case IPFamilyIPv6:
+		return proto + "6"
+	default:
+		return proto
+	}
+}
+
+// getIP returns the first non-loopback address of the given IP family. In
+// dual-stack mode IPv4 addresses are preferred.
+func getIP(family string) (string, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return "", fmt.Errorf("get interface addresses: %w", err)
 	}
+	return pickIP(family, addrs)
+}
+
+// pickIP picks an address of the given IP family from a list of interface
+// addresses. An error is returned if IPv6 is required but no IPv6 address is
+// found, an unspecified address would make an unusable connection request
+// URL.
+func pickIP(family string, addrs []net.Addr) (string, error) {
+	var ipv4, ipv6 net.IP
 	for _, addr := range addrs {
 		ipNet, ok := addr.(*net.IPNet)
-		if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
-			return ipNet.IP.String(), nil
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
 		}
+		if ipNet.IP.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = ipNet.IP
+			}
+		} else if ipv6 == nil {
+			ipv6 = ipNet.IP
+		}
+	}
+
+	switch {
+	case family != IPFamilyIPv6 && ipv4 != nil:
+		return ipv4.String(), nil
+	case family != IPFamilyIPv4 && ipv6 != nil:
+		return ipv6.String(), nil
+	case family == IPFamilyIPv6:
+		return "", errors.New("no IPv6 address found, set the host explicitly")
+	default:
+		return "0.0.0.0", nil
 	}
-	return "0.0.0.0", nil
 }
 
 //
@@ -153,14 +251,14 @@ type udpServer struct {
 	handler  crHandlerFn
 }
 
-func newUDPServer(ctx context.Context, port int, h crHandlerFn) (server, error) {
-	ip, err := getIP()
+func newUDPServer(ctx context.Context, cfg Config, port int, h crHandlerFn) (server, error) {
+	ip, err := advertisedHost(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("get ip address: %w", err)
+		return nil, err
 	}
 
-	listener, err := net.ListenUDP("udp4", &net.UDPAddr{
-		IP:   net.ParseIP(ip),
+	listener, err := net.ListenUDP(network(cfg, "udp"), &net.UDPAddr{
+		IP:   net.ParseIP(bindHost(cfg, ip)),
 		Port: port,
 	})
 	if err != nil {
@@ -171,7 +269,10 @@ func newUDPServer(ctx context.Context, port int, h crHandlerFn) (server, error)
 		var buf [1024]byte
 		for {
 			n, addr, err := listener.ReadFromUDP(buf[:])
-			if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
 				log.Error("Error reading UDP connection", log.Cause(err))
 				continue
 			}
@@ -210,7 +311,7 @@ func (s *udpServer) listenPort() int {
 }
 
 func (s *udpServer) url() string {
-	return fmt.Sprintf("%s:%d", s.ip, s.port)
+	return net.JoinHostPort(s.ip, strconv.Itoa(s.port))
 }
 
 func (s *udpServer) stop(_ context.Context) error {
@@ -0,0 +1,157 @@
+package simulator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/localhots/blip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServerIPv6(t *testing.T) {
+	t.Parallel()
+	cfg := DefaultConfig()
+	cfg.Host = "::1"
+	cfg.Port = 0
+	cfg.IPFamily = IPFamilyIPv6
+
+	crs := make(chan crParams, 1)
+	srv, err := newHTTPServer(t.Context(), cfg, func(_ context.Context, p crParams) error {
+		crs <- p
+		return nil
+	}, blip.New(blip.DefaultConfig()))
+	require.NoError(t, err)
+	defer func() { _ = srv.stop(t.Context()) }()
+
+	u := srv.url()
+	assert.Regexp(t, `^http://\[::1\]:\d+/cwmp$`, u)
+
+	resp, err := http.Get(u + "?un=foo")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "foo", (<-crs).un)
+}
+
+func TestHTTPServerTLS(t *testing.T) {
+	t.Parallel()
+	certFile, keyFile := writeTestCert(t)
+	cfg := DefaultConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	cfg.IPFamily = IPFamilyIPv4
+	cfg.ConnReqTLSCert = certFile
+	cfg.ConnReqTLSKey = keyFile
+
+	srv, err := newHTTPServer(t.Context(), cfg, func(context.Context, crParams) error {
+		return nil
+	}, blip.New(blip.DefaultConfig()))
+	require.NoError(t, err)
+	defer func() { _ = srv.stop(t.Context()) }()
+
+	u := srv.url()
+	assert.Regexp(t, `^https://127\.0\.0\.1:\d+/cwmp$`, u)
+
+	client := http.Client{Transport: &http.Transport{
+		//nolint:gosec
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get(u)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestUDPServerIPv6(t *testing.T) {
+	t.Parallel()
+	cfg := DefaultConfig()
+	cfg.Host = "::1"
+	cfg.IPFamily = IPFamilyIPv6
+
+	ln, err := net.ListenPacket("udp6", "[::1]:0")
+	require.NoError(t, err)
+	port := ln.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, ln.Close())
+
+	srv, err := newUDPServer(t.Context(), cfg, port, func(context.Context, crParams) error {
+		return nil
+	})
+	require.NoError(t, err)
+	defer func() { _ = srv.stop(t.Context()) }()
+
+	assert.Equal(t, "[::1]:"+strconv.Itoa(port), srv.url())
+}
+
+func TestPickIP(t *testing.T) {
+	addrs := func(ips ...string) []net.Addr {
+		res := make([]net.Addr, 0, len(ips))
+		for _, ip := range ips {
+			res = append(res, &net.IPNet{IP: net.ParseIP(ip)})
+		}
+		return res
+	}
+	v4Only := addrs("127.0.0.1", "::1", "fe80::1", "192.168.1.10")
+	dual := addrs("2001:db8::10", "192.168.1.10")
+
+	tests := []struct {
+		family string
+		addrs  []net.Addr
+		exp    string
+		err    bool
+	}{
+		{IPFamilyIPv4, dual, "192.168.1.10", false},
+		{IPFamilyIPv4, nil, "0.0.0.0", false},
+		{IPFamilyIPv6, dual, "2001:db8::10", false},
+		{IPFamilyIPv6, v4Only, "", true},
+		{IPFamilyDual, dual, "192.168.1.10", false},
+		{IPFamilyDual, addrs("2001:db8::10"), "2001:db8::10", false},
+	}
+	for _, tt := range tests {
+		ip, err := pickIP(tt.family, tt.addrs)
+		if tt.err {
+			assert.Error(t, err, tt.family)
+			continue
+		}
+		require.NoError(t, err, tt.family)
+		assert.Equal(t, tt.exp, ip, tt.family)
+	}
+}
+
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
@@ -1,11 +1,14 @@
 package simulator
 
 import (
+	"context"
+	"strings"
+
 	"github.com/localhots/SimulaTR69/datamodel"
 	"github.com/localhots/SimulaTR69/rpc"
 )
 
-func (s *Simulator) handleSetParameterValues(envID string, r *rpc.SetParameterValuesRequest) *rpc.EnvelopeEncoder {
+func (s *Simulator) handleSetParameterValues(ctx context.Context, envID string, r *rpc.SetParameterValuesRequest) *rpc.EnvelopeEncoder {
 	vals := r.ParameterList.ParameterValues
 	params := make([]datamodel.Parameter, 0, len(vals))
 	for _, v := range vals {
@@ -17,13 +20,46 @@ func (s *Simulator) handleSetParameterValues(envID string, r *rpc.SetParameterVa
 	}
 
 	var faults []rpc.SetParameterValuesFault
-	for _, p := range params {
+	for i, p := range params {
 		if fc := s.dm.CanSetValue(p); fc != nil {
 			faults = append(faults, rpc.SetParameterValuesFault{
 				ParameterName: p.Path,
 				FaultCode:     *fc,
 				FaultString:   fc.String(),
 			})
+			continue
+		}
+		// Values are validated against the type declared by the datamodel,
+		// the one sent by the ACS must match it
+		v := vals[i]
+		if cur, ok := s.dm.GetValue(p.Path); ok {
+			declared := baseType(cur.Type)
+			if sent := baseType(v.Value.Type); sent != "" && sent != declared {
+				faults = append(faults, rpc.SetParameterValuesFault{
+					ParameterName: p.Path,
+					FaultCode:     rpc.FaultInvalidParameterType,
+					FaultString:   rpc.FaultInvalidParameterType.String(),
+				})
+				continue
+			}
+			v.Value.Type = rpc.XSD(declared)
+			params[i].Type = cur.Type
+		}
+		if err := v.Validate(); err != nil {
+			fc, _ := rpc.FaultCodeOf(err)
+			faults = append(faults, rpc.SetParameterValuesFault{
+				ParameterName: p.Path,
+				FaultCode:     fc,
+				FaultString:   err.Error(),
+			})
+			continue
+		}
+		if !datamodel.InRange(params[i].Type, p.Value) {
+			faults = append(faults, rpc.SetParameterValuesFault{
+				ParameterName: p.Path,
+				FaultCode:     rpc.FaultInvalidParameterValue,
+				FaultString:   "value is out of range " + params[i].Type,
+			})
 		}
 	}
 	if len(faults) > 0 {
@@ -33,7 +69,8 @@ func (s *Simulator) handleSetParameterValues(envID string, r *rpc.SetParameterVa
 	}
 
 	s.metrics.ParametersWritten.Add(float64(len(params)))
-	s.dm.SetValues(params)
+	s.setValues(ctx, params)
+	s.parameterWriteHooks(ctx, params)
 	s.dm.SetParameterKey(r.ParameterKey)
 	resp := rpc.NewEnvelope(envID)
 	resp.Body.SetParameterValuesResponse = &rpc.SetParameterValuesResponseEncoder{
@@ -41,3 +78,19 @@ func (s *Simulator) handleSetParameterValues(envID string, r *rpc.SetParameterVa
 	}
 	return resp
 }
+
+// baseType returns the type values are transferred as, without the XSD prefix
+// and the range, e.g. string for xsd:IPAddress and unsignedInt for
+// xsd:unsignedInt(0:100). Ranges are checked separately.
+func baseType(typ string) string {
+	typ, _, _ = strings.Cut(rpc.NoXSD(typ), "(")
+	switch typ {
+	case rpc.TypeIPAddress, rpc.TypeIPPrefix, rpc.TypeIPv4Address,
+		rpc.TypeIPv6Address, rpc.TypeIPv6Prefix, rpc.TypeMACAddress:
+		return rpc.TypeString
+	case rpc.TypeBase64Binary:
+		return rpc.TypeBase64
+	default:
+		return typ
+	}
+}
@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestSetParameterValuesTypes(t *testing.T) {
+	const (
+		count = "Device.Test.Count"
+		addr  = "Device.Test.Address"
+		delta = "Device.Test.Delta"
+	)
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	dm := datamodel.New(state.WithDefaults(map[string]datamodel.Parameter{
+		count: {Path: count, Type: "xsd:unsignedInt(0:100)", Value: "1", Writable: true},
+		addr:  {Path: addr, Type: rpc.XSD(rpc.TypeIPAddress), Value: "10.0.0.1", Writable: true},
+		delta: {Path: delta, Type: rpc.XSD(rpc.TypeLong), Value: "0", Writable: true},
+	}))
+	s := New(dm)
+
+	set := func(name, typ, val string) *rpc.EnvelopeEncoder {
+		var r rpc.SetParameterValuesRequest
+		v := rpc.ParameterValueDecoder{Name: name}
+		v.Value.Type = typ
+		v.Value.Value = val
+		r.ParameterList.ParameterValues = []rpc.ParameterValueDecoder{v}
+		return s.handleSetParameterValues(t.Context(), "1", &r)
+	}
+	faultOf := func(env *rpc.EnvelopeEncoder) rpc.FaultCode {
+		t.Helper()
+		require.NotNil(t, env.Body.Fault)
+		faults := env.Body.Fault.Detail.Fault.SetParameterValuesFault
+		require.Len(t, faults, 1)
+		return faults[0].FaultCode
+	}
+
+	// Type sent by the ACS differs from the declared one
+	assert.Equal(t, rpc.FaultInvalidParameterType, faultOf(set(count, rpc.XSD(rpc.TypeString), "5")))
+	// Value is checked against the declared type
+	assert.Equal(t, rpc.FaultInvalidParameterValue, faultOf(set(count, "", "-5")))
+	// Declared range is enforced
+	assert.Equal(t, rpc.FaultInvalidParameterValue, faultOf(set(count, rpc.XSD(rpc.TypeUnsignedInt), "500")))
+
+	resp := set(count, rpc.XSD(rpc.TypeUnsignedInt), "5")
+	require.NotNil(t, resp.Body.SetParameterValuesResponse)
+	p, ok := dm.GetValue(count)
+	require.True(t, ok)
+	assert.Equal(t, "5", p.Value)
+	assert.Equal(t, "xsd:unsignedInt(0:100)", p.Type)
+
+	// Long values are signed
+	resp = set(delta, rpc.XSD(rpc.TypeLong), "-5")
+	require.NotNil(t, resp.Body.SetParameterValuesResponse)
+	p, ok = dm.GetValue(delta)
+	require.True(t, ok)
+	assert.Equal(t, "-5", p.Value)
+
+	// Address types are transferred as strings
+	resp = set(addr, rpc.XSD(rpc.TypeString), "10.0.0.2")
+	require.NotNil(t, resp.Body.SetParameterValuesResponse)
+}
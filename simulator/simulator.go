@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/cookiejar"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,8 +21,11 @@ import (
 	"github.com/localhots/blip"
 	"github.com/localhots/blip/noctx/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/recording"
 	"github.com/localhots/SimulaTR69/rpc"
 	"github.com/localhots/SimulaTR69/simulator/metrics"
 )
@@ -30,20 +34,78 @@ import (
 type Simulator struct {
 	httpServer server
 	udpServer  server
+	xmppServer server
 	dm         *datamodel.DataModel
 	cookies    http.CookieJar
+	clientOpts clientOptions
 	startedAt  time.Time
+	running    atomic.Bool
 	envelopeID uint64
 	metrics    *metrics.Metrics
+	tracer     trace.Tracer
 	logger     *blip.Logger
 
 	pendingEvents   chan string
 	pendingRequests chan func(*rpc.EnvelopeEncoder)
 	stop            chan struct{}
-	tasks           chan taskFn
+	tasks           taskQueue
+	sessions        sessionHistory
+	sessionSeq      int
+	runID           string
+	recorder        *recording.Recorder
+	wakeup          chan struct{}
 	sessionMux      sync.Mutex
 
-	artificialLatency time.Duration
+	faults     faultInjector
+	chaos      chaos
+	vendorRPCs map[string]VendorRPCHandler
+	hooks      []Hooks
+	rpcs       map[string]time.Time
+	rpcNotify  chan struct{}
+	rpcLock    sync.Mutex
+
+	cfg Config
+}
+
+// Option configures a simulator.
+type Option func(*Simulator)
+
+// WithConfig sets the simulator configuration. By default simulators use
+// DefaultConfig.
+func WithConfig(cfg Config) Option {
+	return func(s *Simulator) {
+		s.cfg = cfg
+	}
+}
+
+// WithMetrics sets a custom metrics collector.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Simulator) {
+		s.metrics = m
+	}
+}
+
+// WithMetricsFactory makes the simulator use metrics created by the given
+// factory, labeled according to the factory configuration.
+func WithMetricsFactory(f *metrics.Factory) Option {
+	return func(s *Simulator) {
+		id := s.dm.DeviceID()
+		s.metrics = f.ForDevice(id.SerialNumber, id.ProductClass)
+	}
+}
+
+// WithRecorder makes the simulator record messages exchanged with the ACS.
+func WithRecorder(r *recording.Recorder) Option {
+	return func(s *Simulator) {
+		s.recorder = r
+	}
+}
+
+// WithLogger sets the logger for the simulator.
+func WithLogger(logger *blip.Logger) Option {
+	return func(s *Simulator) {
+		s.logger = logger
+	}
 }
 
 var (
@@ -51,30 +113,41 @@ var (
 	errForbidden          = errors.New("forbidden")
 )
 
+// ErrNoACSURL is returned when the ACS URL is neither configured nor defined
+// in the datamodel.
+var ErrNoACSURL = errors.New("ACS URL is not configured")
+
 // New creates a new simulator instance.
-func New(dm *datamodel.DataModel) *Simulator {
+func New(dm *datamodel.DataModel, opts ...Option) *Simulator {
 	jar, _ := cookiejar.New(nil)
-	return &Simulator{
-		httpServer:        newNoopServer(),
-		udpServer:         newNoopServer(),
-		dm:                dm,
-		cookies:           jar,
-		metrics:           metrics.NewNoop(),
-		logger:            blip.New(blip.DefaultConfig()),
-		pendingEvents:     make(chan string, 5),
-		pendingRequests:   make(chan func(*rpc.EnvelopeEncoder), 5),
-		stop:              make(chan struct{}),
-		tasks:             make(chan taskFn, 5),
-		artificialLatency: Config.ArtificialLatency,
+	s := &Simulator{
+		httpServer:      newNoopServer(),
+		udpServer:       newNoopServer(),
+		xmppServer:      newNoopServer(),
+		dm:              dm,
+		cookies:         jar,
+		metrics:         metrics.NewNoop(),
+		tracer:          otel.Tracer(tracerName),
+		logger:          blip.New(blip.DefaultConfig()),
+		pendingEvents:   make(chan string, 5),
+		pendingRequests: make(chan func(*rpc.EnvelopeEncoder), 5),
+		stop:            make(chan struct{}),
+		wakeup:          make(chan struct{}, 1),
+		rpcs:            make(map[string]time.Time),
+		rpcNotify:       make(chan struct{}),
+		runID:           recording.NewRunID(),
+		cfg:             DefaultConfig(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // NewWithMetrics creates a new simulator instance with a custom metrics
 // collector.
 func NewWithMetrics(dm *datamodel.DataModel, m *metrics.Metrics) *Simulator {
-	s := New(dm)
-	s.metrics = m
-	return s
+	return New(dm, WithMetrics(m))
 }
 
 // UseLogger sets the logger for the simulator.
@@ -87,45 +160,64 @@ func (s *Simulator) UseLogger(logger *blip.Logger) {
 // which can be useful for testing and simulating network conditions with
 // latency.
 func (s *Simulator) SetArtificialLatency(d time.Duration) {
-	s.artificialLatency = d
+	s.cfg.ArtificialLatency = d
 }
 
 // Start starts the simulator and initiates an inform session.
 func (s *Simulator) Start(ctx context.Context) error {
-	if Config.ConnReqEnableHTTP {
-		srv, err := newHTTPServer(ctx, s.handleConnectionRequest, s.logger)
+	if s.cfg.ACSURL != "" {
+		s.dm.SeedACSURL(s.cfg.ACSURL)
+	}
+	if s.dm.ACSURL() == "" {
+		return ErrNoACSURL
+	}
+	clientOpts, err := newClientOptions(s.cfg)
+	if err != nil {
+		return fmt.Errorf("configure ACS client: %w", err)
+	}
+	s.clientOpts = clientOpts
+
+	if s.cfg.ConnReqEnableHTTP {
+		srv, err := newHTTPServer(ctx, s.cfg, s.handleConnectionRequest, s.logger)
 		if err != nil {
 			return fmt.Errorf("start connection request server: %w", err)
 		}
 		s.httpServer = srv
-		log.Info("Started HTTP connection request server", log.F{
+		s.logger.Info(ctx, "Started HTTP connection request server", log.F{
 			"server_url": s.httpServer.url(),
 		})
 		s.dm.SetConnectionRequestURL(s.httpServer.url())
 	}
-	if Config.ConnReqEnableUDP {
-		port := int(Config.Port)
+	if s.cfg.ConnReqEnableUDP {
+		port := int(s.cfg.Port)
 		if s.httpServer.listenPort() != 0 {
 			port = s.httpServer.listenPort()
 		}
 		if port != 0 {
-			us, err := newUDPServer(ctx, port, s.handleConnectionRequest)
+			us, err := newUDPServer(ctx, s.cfg, port, s.handleConnectionRequest)
 			if err != nil {
 				return fmt.Errorf("start connection request server: %w", err)
 			}
 			s.udpServer = us
-			log.Info("Started UDP connection request server", log.F{
+			s.logger.Info(ctx, "Started UDP connection request server", log.F{
 				"server_url": s.udpServer.url(),
 			})
 			s.dm.SetUDPConnectionRequestAddress(s.udpServer.url())
 		} else {
-			log.Warn("Can't start UDP connection request server on undefined port")
+			s.logger.Warn(ctx, "Can't start UDP connection request server on undefined port")
+		}
+	}
+
+	if s.cfg.ConnReqEnableXMPP {
+		if err := s.startXMPPServer(ctx); err != nil {
+			return fmt.Errorf("start connection request server: %w", err)
 		}
 	}
 
 	s.startedAt = time.Now()
-	s.SetPeriodicInformInterval(Config.InformInterval)
+	s.SetPeriodicInformInterval(s.cfg.InformInterval)
 	go s.periodicInform(ctx)
+	s.running.Store(true)
 
 	if !s.dm.IsBootstrapped() {
 		s.pendingEvents <- rpc.EventBootstrap
@@ -138,8 +230,9 @@ func (s *Simulator) Start(ctx context.Context) error {
 
 // Stop stops the simulator.
 func (s *Simulator) Stop(ctx context.Context) error {
+	s.running.Store(false)
 	close(s.stop)
-	if err := s.dm.SaveState(Config.StateFilePath); err != nil {
+	if err := s.dm.SaveState(s.cfg.StateFilePath); err != nil {
 		return fmt.Errorf("save state: %w", err)
 	}
 	if err := s.httpServer.stop(ctx); err != nil {
@@ -148,6 +241,42 @@ func (s *Simulator) Stop(ctx context.Context) error {
 	if err := s.udpServer.stop(ctx); err != nil {
 		return fmt.Errorf("stop HTTP connection request server: %w", err)
 	}
+	if err := s.xmppServer.stop(ctx); err != nil {
+		return fmt.Errorf("stop XMPP connection request server: %w", err)
+	}
+	return nil
+}
+
+func (s *Simulator) startXMPPServer(ctx context.Context) error {
+	conn, ok := s.dm.ConnReqXMPPConnection()
+	if !ok {
+		return errors.New("xmpp connection is not configured")
+	}
+	if !conn.Enable {
+		s.logger.Warn(ctx, "XMPP connection is disabled", log.F{"connection": conn.Path})
+		return nil
+	}
+
+	srv, err := newXMPPServer(ctx, s.cfg, conn, s.handleConnectionRequest, func(jid string) {
+		s.dm.SetXMPPConnectionStatus(conn.Path, "Up", jid)
+		if s.dm.ConnReqJabberID().Value != jid {
+			s.dm.SetConnReqJabberID(jid)
+			// Jabber ID changes must be reported to the ACS
+			select {
+			case s.pendingEvents <- rpc.EventValueChange:
+			default:
+			}
+		}
+	}, s.logger)
+	if err != nil {
+		return err
+	}
+	s.xmppServer = srv
+	s.logger.Info(ctx, "Started XMPP connection request client", log.F{
+		"connection": conn.Path,
+		"username":   conn.Username,
+		"domain":     conn.Domain,
+	})
 	return nil
 }
 
@@ -163,7 +292,35 @@ func (s *Simulator) handleConnectionRequest(_ context.Context, params crParams)
 	if s.dm.DownUntil().After(time.Now()) {
 		return errServiceUnavailable
 	}
-	if Config.ConnReqAuth {
+	if err := s.authorizeConnectionRequest(params); err != nil {
+		return err
+	}
+
+	select {
+	case s.pendingEvents <- rpc.EventConnectionRequest:
+	default:
+	}
+	return nil
+}
+
+func (s *Simulator) authorizeConnectionRequest(params crParams) error {
+	// XMPP connection requests are always authenticated with a plain text
+	// username and password, as required by TR-069 Annex K
+	if params.xmpp {
+		if allowed := s.dm.ConnReqAllowedJabberIDs(); len(allowed) > 0 {
+			bareJID, _, _ := strings.Cut(params.from, "/")
+			if !slices.Contains(allowed, bareJID) && !slices.Contains(allowed, params.from) {
+				return errForbidden
+			}
+		}
+		if params.un != s.dm.ConnectionRequestUsername().Value ||
+			params.pw != s.dm.ConnectionRequestPassword().Value {
+			return errForbidden
+		}
+		return nil
+	}
+
+	if s.cfg.ConnReqAuth {
 		if params.un != s.dm.ConnectionRequestUsername().Value {
 			return errForbidden
 		}
@@ -172,24 +329,26 @@ func (s *Simulator) handleConnectionRequest(_ context.Context, params crParams)
 			return errForbidden
 		}
 	}
-
-	select {
-	case s.pendingEvents <- rpc.EventConnectionRequest:
-	default:
-	}
 	return nil
 }
 
 //nolint:gocyclo
 func (s *Simulator) handleEnvelope(ctx context.Context, env *rpc.EnvelopeDecoder) *rpc.EnvelopeEncoder {
-	s.metrics.MethodCalls.With(prometheus.Labels{"method": env.Method()}).Inc()
 	envID := env.Header.ID.Value
+	if rule, code, ok := s.faults.match(env); ok {
+		s.logger.Info(ctx, "Responding with injected fault", log.F{
+			"method": env.Method(),
+			"code":   code.String(),
+			"rule":   rule,
+		})
+		return rpc.NewEnvelope(envID).WithFault(code)
+	}
 	switch {
 	case env.Body.GetRPCMethods != nil:
 		return s.handleGetRPCMethods(ctx, envID)
 	case env.Body.SetParameterValues != nil:
 		env.Body.SetParameterValues.Debug(ctx, s.logger)
-		return s.handleSetParameterValues(envID, env.Body.SetParameterValues)
+		return s.handleSetParameterValues(ctx, envID, env.Body.SetParameterValues)
 	case env.Body.GetParameterValues != nil:
 		env.Body.GetParameterValues.Debug(ctx, s.logger)
 		return s.handleGetParameterValues(envID, env.Body.GetParameterValues)
@@ -233,6 +392,8 @@ func (s *Simulator) handleEnvelope(ctx context.Context, env *rpc.EnvelopeDecoder
 		return s.handleFault(ctx, envID, env.Body.Fault)
 	case env.Body.TransferCompleteResponse != nil:
 		return nil
+	case env.Body.Vendor != nil:
+		return s.handleVendorRPC(ctx, envID, env.Body.Vendor)
 	default:
 		s.logger.Warn(ctx, "Unknown method", log.F{"env_id": envID})
 		return rpc.NewEnvelope(envID).WithFault(rpc.FaultMethodNotSupported)
@@ -265,6 +426,7 @@ func (s *Simulator) handleGetOptions(ctx context.Context, envID string) *rpc.Env
 }
 
 func (s *Simulator) handleFault(ctx context.Context, envID string, r *rpc.FaultPayload) *rpc.EnvelopeEncoder {
+	s.metrics.ACSFaults.With(prometheus.Labels{"code": r.Detail.Fault.FaultCode.String()}).Inc()
 	s.logger.Error(ctx, "ACS fault", log.F{
 		"env_id": envID,
 		"code":   r.Detail.Fault.FaultCode.String(),
@@ -273,18 +435,60 @@ func (s *Simulator) handleFault(ctx context.Context, envID string, r *rpc.FaultP
 	return nil
 }
 
+// handleACSURLChange makes the simulator bootstrap with the new ACS once the
+// current session is over.
+func (s *Simulator) handleACSURLChange(ctx context.Context, oldURL, newURL string) {
+	s.logger.Info(ctx, "ACS URL changed", log.F{
+		"old_url": oldURL,
+		"new_url": newURL,
+	})
+	s.dm.SetBootstrapped(false)
+	s.tasks.push("Bootstrap", func() taskFn {
+		s.requestInform(ctx, rpc.EventBootstrap)
+		return nil
+	})
+}
+
+// setValues saves parameter values. Every change made to the datamodel by the
+// ACS, using the control API or by scripts goes through it, so that a change
+// of the ACS URL makes the simulator bootstrap with the new ACS.
+func (s *Simulator) setValues(ctx context.Context, params []datamodel.Parameter) {
+	oldURL := s.dm.ACSURL()
+	s.dm.SetValues(params)
+	if newURL := s.dm.ACSURL(); newURL != oldURL {
+		s.handleACSURLChange(ctx, oldURL, newURL)
+	}
+}
+
+// requestInform starts a new session with the given event without blocking.
+// Tasks run on the goroutine that starts sessions, if too many sessions are
+// already requested the event is included in one of them.
+func (s *Simulator) requestInform(ctx context.Context, evt string) {
+	select {
+	case s.pendingEvents <- evt:
+	default:
+		s.addEvent(ctx, evt)
+	}
+}
+
+// pretendOfflineFor simulates a restart that takes the given time.
 func (s *Simulator) pretendOfflineFor(dur time.Duration) {
-	downUntil := time.Now().Add(dur)
-	s.dm.SetDownUntil(downUntil)
-	s.startedAt = downUntil
+	s.startedAt = time.Now().Add(dur)
+	s.goOffline(dur)
+}
+
+// goOffline makes the simulator unreachable for the given time.
+func (s *Simulator) goOffline(dur time.Duration) {
+	s.dm.SetDownUntil(time.Now().Add(dur))
+	s.metrics.OfflineTime.Add(dur.Seconds())
 	time.Sleep(dur)
 }
 
 func (s *Simulator) pretendToBeSlow(ctx context.Context) {
-	if s.artificialLatency > 0 {
+	if s.cfg.ArtificialLatency > 0 {
 		// It's fine to use non cryptographic randomness here.
 		//nolint:gosec
-		delay := time.Duration(rand.Int63n(int64(s.artificialLatency))).Round(time.Millisecond)
+		delay := time.Duration(rand.Int63n(int64(s.cfg.ArtificialLatency))).Round(time.Millisecond)
 		s.logger.Debug(ctx, "Simulating slow response", log.F{"delay": delay.String()})
 		time.Sleep(delay)
 	}
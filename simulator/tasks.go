@@ -0,0 +1,53 @@
+package simulator
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskInfo describes a task that is scheduled to run after the current or
+// next session.
+type TaskInfo struct {
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// task is a named unit of work. Tasks are processed after sessions.
+type task struct {
+	TaskInfo
+	fn taskFn
+}
+
+// taskQueue is a FIFO queue of tasks.
+type taskQueue struct {
+	tasks []task
+	lock  sync.Mutex
+}
+
+func (q *taskQueue) push(name string, fn taskFn) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.tasks = append(q.tasks, task{
+		TaskInfo: TaskInfo{Name: name, AddedAt: time.Now()},
+		fn:       fn,
+	})
+}
+
+// takeAll removes all tasks from the queue and returns them.
+func (q *taskQueue) takeAll() []task {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	tasks := q.tasks
+	q.tasks = nil
+	return tasks
+}
+
+func (q *taskQueue) list() []TaskInfo {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	infos := make([]TaskInfo, 0, len(q.tasks))
+	for _, t := range q.tasks {
+		infos = append(infos, t.TaskInfo)
+	}
+	return infos
+}
@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+const tracerName = "github.com/localhots/SimulaTR69/simulator"
+
+// WithTracerProvider makes the simulator trace its sessions with the ACS using
+// the given tracer provider. By default the global tracer provider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Simulator) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// Span attributes.
+const (
+	attrSerialNumber   = attribute.Key("cwmp.serial_number")
+	attrACSURL         = attribute.Key("cwmp.acs_url")
+	attrEvents         = attribute.Key("cwmp.events")
+	attrMethod         = attribute.Key("cwmp.method")
+	attrResponseMethod = attribute.Key("cwmp.response_method")
+	attrParameterCount = attribute.Key("cwmp.parameter_count")
+	attrFaultCode      = attribute.Key("cwmp.fault_code")
+	attrACSFaultCode   = attribute.Key("cwmp.acs_fault_code")
+	attrTermination    = attribute.Key("cwmp.session.termination_reason")
+	attrTask           = attribute.Key("cwmp.task")
+)
+
+// handleRPC handles a message received from the ACS within its own span.
+func (s *Simulator) handleRPC(ctx context.Context, env *rpc.EnvelopeDecoder) *rpc.EnvelopeEncoder {
+	method := s.methodName(env)
+	ctx, span := s.tracer.Start(ctx, "cwmp.handle "+method, trace.WithAttributes(
+		attrMethod.String(method),
+		attrParameterCount.Int(requestParameterCount(env)),
+	))
+	defer span.End()
+
+	if env.Body.Fault != nil {
+		span.SetAttributes(attrACSFaultCode.String(env.Body.Fault.Detail.Fault.FaultCode.String()))
+	}
+	resp := s.handleEnvelopeWithHooks(ctx, env)
+	span.SetAttributes(attrResponseMethod.String(resp.Method()))
+	if resp != nil && resp.Body.Fault != nil {
+		code := resp.Body.Fault.Detail.Fault.FaultCode
+		span.SetAttributes(attrFaultCode.String(code.String()))
+		span.SetStatus(codes.Error, code.String())
+	}
+	return resp
+}
+
+// runTask runs a task within its own span.
+func (s *Simulator) runTask(ctx context.Context, t task) taskFn {
+	ctx, span := s.tracer.Start(ctx, "cwmp.task "+t.Name, trace.WithAttributes(
+		attrTask.String(t.Name),
+		attrSerialNumber.String(s.dm.DeviceID().SerialNumber),
+	))
+	defer span.End()
+	s.taskRunHooks(ctx, t.Name)
+	return t.fn()
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// requestParameterCount returns the number of parameters in a message
+// received from the ACS.
+func requestParameterCount(env *rpc.EnvelopeDecoder) int {
+	b := env.Body
+	switch {
+	case b.SetParameterValues != nil:
+		return len(b.SetParameterValues.ParameterList.ParameterValues)
+	case b.GetParameterValues != nil:
+		return len(b.GetParameterValues.ParameterNames.Names)
+	case b.SetParameterAttributes != nil:
+		return len(b.SetParameterAttributes.ParameterList.ParameterAttributes)
+	case b.GetParameterAttributes != nil:
+		return len(b.GetParameterAttributes.ParameterNames.Names)
+	default:
+		return 0
+	}
+}
+
+// parameterCount returns the number of parameters in a message sent to the
+// ACS.
+func parameterCount(env *rpc.EnvelopeEncoder) int {
+	if env == nil {
+		return 0
+	}
+	b := env.Body
+	switch {
+	case b.Inform != nil:
+		return len(b.Inform.ParameterList.ParameterValues)
+	case b.GetParameterValuesResponse != nil:
+		return len(b.GetParameterValuesResponse.ParameterList.ParameterValues)
+	case b.GetParameterNamesResponse != nil:
+		return len(b.GetParameterNamesResponse.ParameterList.Parameters)
+	case b.GetParameterAttributesResponse != nil:
+		return len(b.GetParameterAttributesResponse.ParameterList.ParameterAttributes)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+func TestSessionTracing(t *testing.T) {
+	t.Parallel()
+
+	var traceparents []string
+	acs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer acs.Close()
+
+	state, err := datamodel.LoadState("")
+	require.NoError(t, err)
+	dm := datamodel.New(state.WithDefaults(map[string]datamodel.Parameter{
+		"Device.DeviceInfo.SerialNumber": {Path: "Device.DeviceInfo.SerialNumber", Value: "SIM-001"},
+		"Device.ManagementServer.URL":    {Path: "Device.ManagementServer.URL", Value: acs.URL},
+	}))
+	dm.AddEvent(rpc.EventBoot)
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	s := New(dm, WithTracerProvider(tp))
+	ctx := s.startSession(t.Context(), s.informHandler)
+	s.tasks.push("Reboot", func() taskFn { return nil })
+	s.processTasks(ctx)
+
+	spans := rec.Ended()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{
+		"cwmp.connect",
+		"cwmp.send Inform",
+		"cwmp.send Empty",
+		"cwmp.session",
+		"cwmp.task Reboot",
+	}, names)
+
+	// All spans belong to the same trace
+	traceID := spans[0].SpanContext().TraceID()
+	for _, span := range spans {
+		assert.Equal(t, traceID, span.SpanContext().TraceID(), span.Name())
+	}
+
+	// Trace context is sent to the ACS
+	require.Len(t, traceparents, 2)
+	for i, tp := range traceparents {
+		carrier := propagation.MapCarrier{"traceparent": tp}
+		ctx := propagation.TraceContext{}.Extract(t.Context(), carrier)
+		sc := trace.SpanContextFromContext(ctx)
+		assert.Equal(t, traceID, sc.TraceID())
+		// Parent is the span of the message sent
+		assert.Equal(t, spans[i+1].SpanContext().SpanID(), sc.SpanID())
+	}
+}
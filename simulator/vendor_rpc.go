@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+)
+
+// VendorRPCHandler handles a vendor specific RPC method. It receives the XML
+// of the request element and returns the XML content of the response
+// element, which is named after the method with a Response suffix. Errors
+// are sent to the ACS as faults, return an RPCFault to choose the fault code.
+type VendorRPCHandler func(ctx context.Context, dm *datamodel.DataModel, req []byte) ([]byte, error)
+
+// RPCFault is an error returned by vendor RPC handlers to respond with a
+// specific fault.
+type RPCFault struct {
+	Code    rpc.FaultCode
+	Message string
+}
+
+func (f *RPCFault) Error() string {
+	if f.Message == "" {
+		return f.Code.String()
+	}
+	return f.Message
+}
+
+// ErrInvalidVendorMethod is returned when a vendor specific method name
+// doesn't follow the X_<VENDOR>_<Name> format.
+var ErrInvalidVendorMethod = errors.New("invalid vendor method name")
+
+// ValidateVendorMethod checks the vendor specific method name.
+func ValidateVendorMethod(name string) error {
+	if !rpc.IsVendorMethod(name) {
+		return fmt.Errorf("%w: %s", ErrInvalidVendorMethod, name)
+	}
+	return nil
+}
+
+// WithVendorRPC registers a handler of a vendor specific RPC method, e.g.
+// X_DECADE_SpeedTest. Registered methods are advertised in GetRPCMethods
+// responses. Invalid method names are logged and ignored, use
+// ValidateVendorMethod or RegisterVendorRPC to check them.
+func WithVendorRPC(name string, h VendorRPCHandler) Option {
+	return func(s *Simulator) {
+		if err := s.RegisterVendorRPC(name, h); err != nil {
+			s.logger.Error(context.Background(), "Failed to register vendor RPC", log.Cause(err))
+		}
+	}
+}
+
+// RegisterVendorRPC registers a handler of a vendor specific RPC method, like
+// WithVendorRPC does, and returns an error if the method name is invalid. It
+// must be called before the simulator is started.
+func (s *Simulator) RegisterVendorRPC(name string, h VendorRPCHandler) error {
+	if err := ValidateVendorMethod(name); err != nil {
+		return err
+	}
+	if s.vendorRPCs == nil {
+		s.vendorRPCs = make(map[string]VendorRPCHandler)
+	}
+	s.vendorRPCs[name] = h
+	return nil
+}
+
+// vendorMethods returns sorted names of registered vendor specific methods.
+func (s *Simulator) vendorMethods() []string {
+	methods := make([]string, 0, len(s.vendorRPCs))
+	for name := range s.vendorRPCs {
+		methods = append(methods, name)
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// methodName returns the method name of a message received from the ACS.
+// Names of unknown methods are chosen by the ACS, they are reported as
+// Unknown to keep metric labels and span names bounded.
+func (s *Simulator) methodName(env *rpc.EnvelopeDecoder) string {
+	if env.Body.Vendor != nil {
+		if _, ok := s.vendorRPCs[env.Body.Vendor.XMLName.Local]; !ok {
+			return "Unknown"
+		}
+	}
+	return env.Method()
+}
+
+func (s *Simulator) handleVendorRPC(ctx context.Context, envID string, r *rpc.RawMessage) *rpc.EnvelopeEncoder {
+	method := r.XMLName.Local
+	h, ok := s.vendorRPCs[method]
+	if !ok {
+		s.logger.Warn(ctx, "Unknown method", log.F{"env_id": envID, "method": method})
+		return rpc.NewEnvelope(envID).WithFault(rpc.FaultMethodNotSupported)
+	}
+	s.logger.Info(ctx, "Received message", log.F{"method": method})
+
+	req, err := r.Element()
+	if err != nil {
+		return rpc.NewEnvelope(envID).WithFaultMsg(rpc.FaultInternalError, err.Error())
+	}
+	resp, err := h(ctx, s.dm, req)
+	if err != nil {
+		s.logger.Warn(ctx, "Vendor RPC failed", log.Cause(err), log.F{"method": method})
+		var fault *RPCFault
+		if errors.As(err, &fault) {
+			return rpc.NewEnvelope(envID).WithFaultMsg(fault.Code, fault.Error())
+		}
+		if code, ok := rpc.FaultCodeOf(err); ok {
+			return rpc.NewEnvelope(envID).WithFaultMsg(code, err.Error())
+		}
+		return rpc.NewEnvelope(envID).WithFaultMsg(rpc.FaultInternalError, err.Error())
+	}
+
+	env := rpc.NewEnvelope(envID)
+	env.Body.Vendor = &rpc.RawMessage{
+		XMLName:  xml.Name{Local: "cwmp:" + method + "Response"},
+		InnerXML: string(resp),
+	}
+	return env
+}
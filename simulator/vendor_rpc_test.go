@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+	"github.com/localhots/SimulaTR69/rpc"
+	"github.com/localhots/SimulaTR69/simulator/metrics"
+)
+
+func TestVendorRPC(t *testing.T) {
+	t.Parallel()
+
+	speedTest := func(_ context.Context, dm *datamodel.DataModel, req []byte) ([]byte, error) {
+		var r struct {
+			Server string
+		}
+		if err := xml.Unmarshal(req, &r); err != nil {
+			return nil, err
+		}
+		if r.Server == "" {
+			return nil, &RPCFault{Code: rpc.FaultInvalidArguments, Message: "server is required"}
+		}
+		return []byte("<Server>" + r.Server + "</Server><SerialNumber>" + dm.DeviceID().SerialNumber + "</SerialNumber><Mbps>940</Mbps>"), nil
+	}
+	m := metrics.New(prometheus.NewRegistry())
+	s := New(newTestDataModel(t),
+		WithMetrics(m),
+		WithVendorRPC("X_DECADE_SpeedTest", speedTest),
+		WithVendorRPC("X_DECADE_Broken", func(context.Context, *datamodel.DataModel, []byte) ([]byte, error) {
+			return nil, errors.New("boom")
+		}),
+		WithVendorRPC("SpeedTest", speedTest),
+	)
+	require.NoError(t, s.RegisterVendorRPC("X_EXAMPLE-COM_SpeedTest", speedTest))
+	require.ErrorIs(t, s.RegisterVendorRPC("X_example.com_SpeedTest", speedTest), ErrInvalidVendorMethod)
+	request := func(body string) *rpc.EnvelopeEncoder {
+		env, err := rpc.Decode([]byte(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cwmp="urn:dslforum-org:cwmp-1-0">
+<soapenv:Header><cwmp:ID soapenv:mustUnderstand="1">1</cwmp:ID></soapenv:Header>
+<soapenv:Body>` + body + `</soapenv:Body>
+</soapenv:Envelope>`))
+		require.NoError(t, err)
+		return s.handleEnvelopeWithHooks(t.Context(), env)
+	}
+
+	resp := request(`<cwmp:GetRPCMethods/>`)
+	methods := resp.Body.GetRPCMethodsResponse.MethodList.Methods
+	assert.Equal(t, []string{"X_DECADE_Broken", "X_DECADE_SpeedTest", "X_EXAMPLE-COM_SpeedTest"}, methods[len(methods)-3:])
+	assert.NotContains(t, methods, "SpeedTest")
+
+	resp = request(`<cwmp:X_DECADE_SpeedTest><Server>speed.acme-networks.com</Server></cwmp:X_DECADE_SpeedTest>`)
+	assert.Equal(t, "X_DECADE_SpeedTestResponse", resp.Method())
+	b, err := resp.Encode()
+	require.NoError(t, err)
+	dec, err := rpc.Decode(b)
+	require.NoError(t, err)
+	require.NotNil(t, dec.Body.Vendor)
+	assert.Equal(t, rpc.NSCWMP, dec.Body.Vendor.XMLName.Space)
+	assert.Equal(t, "X_DECADE_SpeedTestResponse", dec.Method())
+	assert.Equal(t, "<Server>speed.acme-networks.com</Server><SerialNumber></SerialNumber><Mbps>940</Mbps>", dec.Body.Vendor.InnerXML)
+
+	faultCode := func(env *rpc.EnvelopeEncoder) rpc.FaultCode {
+		require.NotNil(t, env.Body.Fault)
+		return env.Body.Fault.Detail.Fault.FaultCode
+	}
+	assert.Equal(t, rpc.FaultInvalidArguments, faultCode(request(`<cwmp:X_DECADE_SpeedTest/>`)))
+	assert.Equal(t, rpc.FaultInternalError, faultCode(request(`<cwmp:X_DECADE_Broken/>`)))
+	assert.Equal(t, rpc.FaultMethodNotSupported, faultCode(request(`<cwmp:X_DECADE_Unknown/>`)))
+
+	// Names of unknown methods don't make it into metric labels
+	calls := m.MethodCalls.(*prometheus.CounterVec)
+	assert.Equal(t, 1.0, testutil.ToFloat64(calls.WithLabelValues("Unknown")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(calls.WithLabelValues("X_DECADE_SpeedTest")))
+}
@@ -0,0 +1,556 @@
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/localhots/blip"
+	"github.com/localhots/blip/noctx/log"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+)
+
+//
+// XMPP server
+//
+
+// XMPP namespaces used by the connection request client.
+const (
+	nsXMPPStreams  = "http://etherx.jabber.org/streams"
+	nsXMPPClient   = "jabber:client"
+	nsXMPPTLS      = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsXMPPSASL     = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsXMPPBind     = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsXMPPSession  = "urn:ietf:params:xml:ns:xmpp-session"
+	nsXMPPStanzas  = "urn:ietf:params:xml:ns:xmpp-stanzas"
+	nsXMPPConnReq  = "urn:broadband-forum-org:cwmp:xmppConnReq-1-0"
+	xmppMaxBackoff = time.Minute
+)
+
+// xmppServer implements a connection request server over XMPP as described in
+// TR-069 Annex K. Unlike other connection request servers it doesn't listen on
+// a port. Instead it maintains a persistent connection to an XMPP server and
+// accepts connection requests delivered as IQ stanzas.
+type xmppServer struct {
+	cfg     Config
+	conf    datamodel.XMPPConnection
+	handler crHandlerFn
+	onBind  func(jid string)
+	logger  *blip.Logger
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	lock sync.Mutex
+	jid  string
+	conn net.Conn
+	// wlock serializes writes to conn, it is shared by all streams
+	wlock sync.Mutex
+}
+
+// xmppStream is a single XMPP stream over a network connection. Streams are
+// restarted after TLS negotiation and authentication.
+type xmppStream struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	dec   *xml.Decoder
+	wlock *sync.Mutex
+}
+
+type xmppFeatures struct {
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms *struct {
+		Names []string `xml:"mechanism"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind    *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+}
+
+type xmppIQ struct {
+	XMLName xml.Name `xml:"iq"`
+	Type    string   `xml:"type,attr"`
+	ID      string   `xml:"id,attr"`
+	From    string   `xml:"from,attr"`
+	To      string   `xml:"to,attr"`
+	Bind    *struct {
+		JID string `xml:"jid"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Ping              *struct{}        `xml:"urn:xmpp:ping ping"`
+	ConnectionRequest *xmppConnRequest `xml:"urn:broadband-forum-org:cwmp:xmppConnReq-1-0 connectionRequest"`
+}
+
+type xmppConnRequest struct {
+	Username string `xml:"username"`
+	Password string `xml:"password"`
+}
+
+func newXMPPServer(
+	ctx context.Context,
+	cfg Config,
+	conf datamodel.XMPPConnection,
+	h crHandlerFn,
+	onBind func(jid string),
+	logger *blip.Logger,
+) (server, error) {
+	if conf.Username == "" || conf.Domain == "" {
+		return nil, fmt.Errorf("xmpp connection %s: username and domain are required", conf.Path)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &xmppServer{
+		cfg:     cfg,
+		conf:    conf,
+		handler: h,
+		onBind:  onBind,
+		logger:  logger,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+// run maintains the XMPP connection, reconnecting with an exponential backoff
+// until the server is stopped.
+func (s *xmppServer) run(ctx context.Context) {
+	defer close(s.done)
+	backoff := time.Second
+	for {
+		err := s.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.logger.Error(ctx, "XMPP connection failed", log.Cause(err), log.F{
+				"retry_in": backoff.String(),
+			})
+		}
+		s.setJID("")
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, xmppMaxBackoff)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// session establishes an XMPP stream, authenticates and binds a resource,
+// then processes incoming stanzas until the connection is closed.
+//
+//nolint:gocyclo
+func (s *xmppServer) session(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.conn = conn
+	s.lock.Unlock()
+	defer func() { _ = conn.Close() }()
+
+	st, features, err := openXMPPStream(conn, &s.wlock, s.conf.Domain)
+	if err != nil {
+		return err
+	}
+
+	if s.conf.UseTLS {
+		if features.StartTLS == nil {
+			return errors.New("xmpp server doesn't support STARTTLS")
+		}
+		if err := st.write(`<starttls xmlns='%s'/>`, nsXMPPTLS); err != nil {
+			return err
+		}
+		if el, err := st.next(); err != nil {
+			return err
+		} else if el.Name.Local != "proceed" {
+			return fmt.Errorf("starttls: unexpected response: %s", el.Name.Local)
+		}
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: s.conf.Domain,
+			//nolint:gosec
+			InsecureSkipVerify: !s.cfg.XMPPVerifyTLS,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("tls handshake: %w", err)
+		}
+		s.lock.Lock()
+		s.conn = tlsConn
+		s.lock.Unlock()
+		st, features, err = openXMPPStream(tlsConn, &s.wlock, s.conf.Domain)
+		if err != nil {
+			return err
+		}
+	}
+
+	if features.Mechanisms == nil || !slices.Contains(features.Mechanisms.Names, "PLAIN") {
+		return errors.New("xmpp server doesn't support PLAIN authentication")
+	}
+	creds := base64.StdEncoding.EncodeToString([]byte("\x00" + s.conf.Username + "\x00" + s.conf.Password))
+	if err := st.write(`<auth xmlns='%s' mechanism='PLAIN'>%s</auth>`, nsXMPPSASL, creds); err != nil {
+		return err
+	}
+	if el, err := st.next(); err != nil {
+		return err
+	} else if el.Name.Local != "success" {
+		return fmt.Errorf("authentication failed: %s", el.Name.Local)
+	}
+
+	// Stream must be restarted without closing the connection, reusing the
+	// buffered reader to avoid losing any data
+	st.reset()
+	if features, err = st.open(s.conf.Domain); err != nil {
+		return err
+	}
+	if features.Bind == nil {
+		return errors.New("xmpp server doesn't support resource binding")
+	}
+	jid, err := st.bind(s.conf.Resource)
+	if err != nil {
+		return err
+	}
+	if features.Session != nil {
+		if err := st.establishSession(); err != nil {
+			return err
+		}
+	}
+	if err := st.write(`<presence/>`); err != nil {
+		return err
+	}
+
+	s.logger.Info(ctx, "Connected to XMPP server", log.F{"jid": jid})
+	s.setJID(jid)
+	if s.onBind != nil {
+		s.onBind(jid)
+	}
+
+	stopKeepAlive := s.keepAlive(st)
+	defer stopKeepAlive()
+
+	return s.serve(ctx, st)
+}
+
+func (s *xmppServer) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: s.cfg.ConnectionTimeout}
+	var errs []error
+	for _, addr := range s.addresses() {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("connect to xmpp server: %w", errors.Join(errs...))
+}
+
+// addresses returns a list of server addresses to connect to. If no servers
+// are configured explicitly they are discovered using DNS SRV records of the
+// domain, falling back to the domain itself.
+func (s *xmppServer) addresses() []string {
+	var addrs []string
+	for _, srv := range s.conf.Servers {
+		addrs = append(addrs, net.JoinHostPort(srv.Address, strconv.Itoa(srv.Port)))
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	if _, srvs, err := net.LookupSRV("xmpp-client", "tcp", s.conf.Domain); err == nil {
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+	}
+	return append(addrs, net.JoinHostPort(s.conf.Domain, "5222"))
+}
+
+func (s *xmppServer) serve(ctx context.Context, st *xmppStream) error {
+	for {
+		el, err := st.next()
+		if err != nil {
+			return err
+		}
+		if el.Name.Local != "iq" {
+			// Presence and messages are not relevant
+			if err := st.dec.Skip(); err != nil {
+				return fmt.Errorf("skip stanza: %w", err)
+			}
+			continue
+		}
+
+		var iq xmppIQ
+		if err := st.dec.DecodeElement(&iq, &el); err != nil {
+			return fmt.Errorf("decode iq: %w", err)
+		}
+		if iq.Type != "get" && iq.Type != "set" {
+			continue
+		}
+
+		switch {
+		case iq.ConnectionRequest != nil:
+			err = s.handleConnectionRequest(ctx, st, iq)
+		case iq.Ping != nil:
+			err = st.write(`<iq type='result' id='%s' to='%s'/>`, xmlEscape(iq.ID), xmlEscape(iq.From))
+		default:
+			err = st.write(`<iq type='error' id='%s' to='%s'><error type='cancel'>`+
+				`<service-unavailable xmlns='%s'/></error></iq>`,
+				xmlEscape(iq.ID), xmlEscape(iq.From), nsXMPPStanzas)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *xmppServer) handleConnectionRequest(ctx context.Context, st *xmppStream, iq xmppIQ) error {
+	s.logger.Info(ctx, "Received XMPP connection request", log.F{"from": iq.From})
+	err := s.handler(ctx, crParams{
+		un:   iq.ConnectionRequest.Username,
+		pw:   iq.ConnectionRequest.Password,
+		from: iq.From,
+		xmpp: true,
+	})
+
+	var errType, errCond string
+	switch {
+	case err == nil:
+		return st.write(`<iq type='result' id='%s' to='%s'/>`, xmlEscape(iq.ID), xmlEscape(iq.From))
+	case errors.Is(err, errForbidden):
+		errType, errCond = "auth", "not-authorized"
+	case errors.Is(err, errServiceUnavailable):
+		errType, errCond = "cancel", "service-unavailable"
+	default:
+		errType, errCond = "wait", "internal-server-error"
+	}
+	return st.write(`<iq type='error' id='%s' to='%s'>`+
+		`<connectionRequest xmlns='%s'><username>%s</username><password>%s</password></connectionRequest>`+
+		`<error type='%s'><%s xmlns='%s'/></error></iq>`,
+		xmlEscape(iq.ID), xmlEscape(iq.From),
+		nsXMPPConnReq, xmlEscape(iq.ConnectionRequest.Username), xmlEscape(iq.ConnectionRequest.Password),
+		errType, errCond, nsXMPPStanzas)
+}
+
+// keepAlive sends whitespace pings to the server in order to keep the
+// connection open. It returns a function that stops the pings.
+func (s *xmppServer) keepAlive(st *xmppStream) func() {
+	if s.conf.KeepAliveInterval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.conf.KeepAliveInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := st.write(" "); err != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+func (s *xmppServer) setJID(jid string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jid = jid
+}
+
+func (s *xmppServer) listenPort() int {
+	return 0
+}
+
+func (s *xmppServer) url() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.jid
+}
+
+func (s *xmppServer) stop(ctx context.Context) error {
+	s.cancel()
+	s.lock.Lock()
+	if s.conn != nil {
+		// Safe to ignore any errors here. The deadline unblocks a pending
+		// write that would otherwise hold the write lock.
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = s.conn.SetWriteDeadline(deadline)
+		}
+		s.wlock.Lock()
+		_, _ = io.WriteString(s.conn, "</stream:stream>")
+		s.wlock.Unlock()
+		_ = s.conn.Close()
+	}
+	s.lock.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop xmpp client: %w", ctx.Err())
+	}
+}
+
+//
+// XMPP stream
+//
+
+func openXMPPStream(conn net.Conn, wlock *sync.Mutex, domain string) (*xmppStream, *xmppFeatures, error) {
+	st := &xmppStream{
+		conn:  conn,
+		r:     bufio.NewReader(conn),
+		wlock: wlock,
+	}
+	st.reset()
+	features, err := st.open(domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, features, nil
+}
+
+// reset creates a new XML decoder on top of the existing buffered reader.
+func (st *xmppStream) reset() {
+	st.dec = xml.NewDecoder(st.r)
+}
+
+// open sends an opening stream header and waits for the server to advertise
+// stream features.
+func (st *xmppStream) open(domain string) (*xmppFeatures, error) {
+	err := st.write(`<?xml version='1.0'?><stream:stream to='%s' version='1.0' xmlns='%s' xmlns:stream='%s'>`,
+		xmlEscape(domain), nsXMPPClient, nsXMPPStreams)
+	if err != nil {
+		return nil, err
+	}
+
+	el, err := st.next()
+	if err != nil {
+		return nil, err
+	}
+	if el.Name.Space != nsXMPPStreams || el.Name.Local != "stream" {
+		return nil, fmt.Errorf("unexpected stream header: %s", el.Name.Local)
+	}
+
+	el, err = st.next()
+	if err != nil {
+		return nil, err
+	}
+	if el.Name.Local != "features" {
+		return nil, fmt.Errorf("expected stream features, got: %s", el.Name.Local)
+	}
+	var features xmppFeatures
+	if err := st.dec.DecodeElement(&features, &el); err != nil {
+		return nil, fmt.Errorf("decode stream features: %w", err)
+	}
+	return &features, nil
+}
+
+func (st *xmppStream) bind(resource string) (string, error) {
+	var err error
+	if resource == "" {
+		err = st.write(`<iq type='set' id='bind'><bind xmlns='%s'/></iq>`, nsXMPPBind)
+	} else {
+		err = st.write(`<iq type='set' id='bind'><bind xmlns='%s'><resource>%s</resource></bind></iq>`,
+			nsXMPPBind, xmlEscape(resource))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	iq, err := st.readIQ()
+	if err != nil {
+		return "", err
+	}
+	if iq.Type != "result" || iq.Bind == nil || iq.Bind.JID == "" {
+		return "", errors.New("resource binding failed")
+	}
+	return iq.Bind.JID, nil
+}
+
+// establishSession is only required by legacy servers that implement
+// RFC 3921.
+func (st *xmppStream) establishSession() error {
+	err := st.write(`<iq type='set' id='session'><session xmlns='%s'/></iq>`, nsXMPPSession)
+	if err != nil {
+		return err
+	}
+	iq, err := st.readIQ()
+	if err != nil {
+		return err
+	}
+	if iq.Type != "result" {
+		return errors.New("session establishment failed")
+	}
+	return nil
+}
+
+func (st *xmppStream) readIQ() (*xmppIQ, error) {
+	el, err := st.next()
+	if err != nil {
+		return nil, err
+	}
+	if el.Name.Local != "iq" {
+		return nil, fmt.Errorf("expected iq, got: %s", el.Name.Local)
+	}
+	var iq xmppIQ
+	if err := st.dec.DecodeElement(&iq, &el); err != nil {
+		return nil, fmt.Errorf("decode iq: %w", err)
+	}
+	return &iq, nil
+}
+
+// next returns the next start element, skipping anything else. Closing stream
+// tag results in io.EOF error.
+func (st *xmppStream) next() (xml.StartElement, error) {
+	for {
+		tok, err := st.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, fmt.Errorf("read xmpp stream: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsXMPPStreams && t.Name.Local == "error" {
+				_ = st.dec.Skip()
+				return xml.StartElement{}, errors.New("xmpp stream error")
+			}
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsXMPPStreams && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+func (st *xmppStream) write(format string, args ...any) error {
+	st.wlock.Lock()
+	defer st.wlock.Unlock()
+	if _, err := fmt.Fprintf(st.conn, format, args...); err != nil {
+		return fmt.Errorf("write xmpp stream: %w", err)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	// Writing to a strings.Builder never fails
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
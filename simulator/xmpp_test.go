@@ -0,0 +1,165 @@
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/localhots/blip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/localhots/SimulaTR69/datamodel"
+)
+
+func TestXMPPConnectionRequest(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	type result struct {
+		auth   string
+		iqType string
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		auth, iqType, err := fakeXMPPServer(conn)
+		results <- result{auth: auth, iqType: iqType, err: err}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	conf := datamodel.XMPPConnection{
+		Path:     "Device.XMPP.Connection.1",
+		Username: "cpe",
+		Password: "secret",
+		Domain:   "example.com",
+		Resource: "sim",
+		Servers:  []datamodel.XMPPServer{{Address: "127.0.0.1", Port: addr.Port}},
+	}
+	crs := make(chan crParams, 1)
+	handler := func(_ context.Context, p crParams) error {
+		crs <- p
+		return nil
+	}
+	bound := make(chan string, 1)
+	onBind := func(jid string) { bound <- jid }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv, err := newXMPPServer(ctx, DefaultConfig(), conf, handler, onBind, blip.New(blip.DefaultConfig()))
+	require.NoError(t, err)
+	defer func() { _ = srv.stop(ctx) }()
+
+	select {
+	case jid := <-bound:
+		assert.Equal(t, "cpe@example.com/sim", jid)
+	case <-ctx.Done():
+		t.Fatal("resource was not bound")
+	}
+
+	select {
+	case p := <-crs:
+		assert.True(t, p.xmpp)
+		assert.Equal(t, "acs", p.un)
+		assert.Equal(t, "pass", p.pw)
+		assert.Equal(t, "acs@example.com/acs", p.from)
+	case <-ctx.Done():
+		t.Fatal("connection request was not received")
+	}
+
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, "AGNwZQBzZWNyZXQ=", res.auth)
+	assert.Equal(t, "result", res.iqType)
+}
+
+// fakeXMPPServer performs a minimal server side of the XMPP handshake, sends
+// a connection request and returns the client credentials and the type of the
+// connection request response.
+func fakeXMPPServer(conn net.Conn) (auth, iqType string, err error) {
+	dec := xml.NewDecoder(bufio.NewReader(conn))
+	next := func() (xml.StartElement, error) {
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return xml.StartElement{}, err
+			}
+			if el, ok := tok.(xml.StartElement); ok {
+				return el, nil
+			}
+		}
+	}
+	openStream := func(features string) error {
+		if _, err := next(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(conn, `<?xml version='1.0'?>`+
+			`<stream:stream from='example.com' id='1' version='1.0' xmlns='jabber:client' xmlns:stream='%s'>`+
+			`<stream:features>%s</stream:features>`, nsXMPPStreams, features)
+		return err
+	}
+
+	if err := openStream(`<mechanisms xmlns='` + nsXMPPSASL + `'><mechanism>PLAIN</mechanism></mechanisms>`); err != nil {
+		return "", "", err
+	}
+	el, err := next()
+	if err != nil {
+		return "", "", err
+	}
+	if err := dec.DecodeElement(&auth, &el); err != nil {
+		return "", "", err
+	}
+	if _, err := fmt.Fprintf(conn, `<success xmlns='%s'/>`, nsXMPPSASL); err != nil {
+		return "", "", err
+	}
+
+	if err := openStream(`<bind xmlns='` + nsXMPPBind + `'/>`); err != nil {
+		return "", "", err
+	}
+	var iq xmppIQ
+	if el, err = next(); err != nil {
+		return "", "", err
+	}
+	if err := dec.DecodeElement(&iq, &el); err != nil {
+		return "", "", err
+	}
+	_, err = fmt.Fprintf(conn, `<iq type='result' id='%s'><bind xmlns='%s'><jid>cpe@example.com/sim</jid></bind></iq>`,
+		iq.ID, nsXMPPBind)
+	if err != nil {
+		return "", "", err
+	}
+	// Presence
+	if _, err := next(); err != nil {
+		return "", "", err
+	}
+
+	_, err = fmt.Fprintf(conn, `<iq type='get' id='cr1' from='acs@example.com/acs' to='cpe@example.com/sim'>`+
+		`<connectionRequest xmlns='%s'><username>acs</username><password>pass</password></connectionRequest></iq>`,
+		nsXMPPConnReq)
+	if err != nil {
+		return "", "", err
+	}
+	if el, err = next(); err != nil {
+		return "", "", err
+	}
+	var resp xmppIQ
+	if err := dec.DecodeElement(&resp, &el); err != nil {
+		return "", "", err
+	}
+	if resp.ID != "cr1" {
+		return "", "", fmt.Errorf("unexpected response id: %s", strconv.Quote(resp.ID))
+	}
+	return auth, resp.Type, nil
+}